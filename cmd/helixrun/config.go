@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/configreload"
+)
+
+func runConfig(args []string) error {
+	sub, args, err := subcommand("config", args, "validate")
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("config "+sub, flag.ContinueOnError)
+	common := registerCommonFlags(flags)
+	skipAuthDir := flags.Bool("skip-auth-dir", false, "do not check that auth-dir exists (Postgres token store)")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	problems, err := validateConfig(common, *skipAuthDir)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Printf("- %s\n", p)
+		}
+		return fmt.Errorf("%s: %d problem(s)", common.configPath, len(problems))
+	}
+	fmt.Printf("%s: ok\n", common.configPath)
+	return nil
+}
+
+// validateConfig renders the config and applies the config reload rules
+// (without the restart checks, as there is no running service to compare to).
+func validateConfig(common *commonFlags, skipAuthDir bool) ([]string, error) {
+	data, err := renderConfig(common.configPath, common.profile)
+	if err != nil {
+		return nil, err
+	}
+	authDirBase := ""
+	if !skipAuthDir {
+		absConfig, errAbs := filepath.Abs(common.configPath)
+		if errAbs != nil {
+			return nil, errAbs
+		}
+		authDirBase = filepath.Dir(absConfig)
+	}
+	return configreload.ValidateBytes(data, nil, authDirBase), nil
+}
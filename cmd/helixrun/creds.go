@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/cliproxy"
+	"helixrun-cliproxy-starter/internal/cliproxy/authdir"
+	"helixrun-cliproxy-starter/internal/cliproxy/authfiles"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// credStore is the credential backend a command operates on: the token store
+// selected by STORE_URL (or PGSTORE_DSN) or the auth-dir from cliproxy.yaml otherwise.
+type credStore interface {
+	authfiles.Store
+	String() string
+	List(ctx context.Context) ([]authfiles.File, error)
+	Delete(ctx context.Context, id string) error
+	Close() error
+}
+
+func runCreds(args []string) error {
+	sub, args, err := subcommand("creds", args, "list", "import", "export", "delete", "disable", "enable")
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("creds "+sub, flag.ContinueOnError)
+	common := registerCommonFlags(flags)
+	onConflict := flags.String("on-conflict", string(authfiles.ConflictSkip), "import: skip, overwrite or newer-wins")
+	dryRun := flags.Bool("dry-run", false, "import: report what would change without writing")
+	provider := flags.String("provider", "", "list: only credentials of this type")
+	expiresWithin := flags.Duration("expires-within", 0, "list: only credentials whose token expires within this duration")
+	reason := flags.String("reason", "", "disable: why the credential is taken out of rotation")
+	by := flags.String("by", os.Getenv("USER"), "disable/enable: who made the change")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	creds, err := openCredStore(ctx, common)
+	if err != nil {
+		return err
+	}
+	defer creds.Close()
+
+	switch sub {
+	case "list":
+		filter := store.AuthFilter{Provider: strings.TrimSpace(*provider)}
+		if *expiresWithin > 0 {
+			filter.ExpiresBefore = time.Now().Add(*expiresWithin)
+		}
+		return listCreds(ctx, creds, filter)
+	case "import":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: helixrun creds import [-on-conflict mode] [-dry-run] <dir|archive.tar[.gz]>")
+		}
+		mode, errMode := authfiles.ParseConflictMode(*onConflict)
+		if errMode != nil {
+			return errMode
+		}
+		return importCreds(ctx, creds, flags.Arg(0), authfiles.ImportOptions{Conflict: mode, DryRun: *dryRun})
+	case "export":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: helixrun creds export <dir|archive.tar[.gz]|->")
+		}
+		return exportCreds(ctx, creds, flags.Arg(0))
+	case "disable", "enable":
+		if flags.NArg() == 0 {
+			return fmt.Errorf("usage: helixrun creds %s [-reason text] [-by name] <id>...", sub)
+		}
+		tc, ok := creds.(*tokenCredStore)
+		if !ok {
+			return fmt.Errorf("creds %s requires STORE_URL; in file mode remove the file from %s instead", sub, creds)
+		}
+		for _, id := range flags.Args() {
+			summary, errSet := tc.store.SetDisabled(ctx, id, sub == "disable", *by, *reason)
+			if errors.Is(errSet, store.ErrNotFound) {
+				return fmt.Errorf("credential %s not found", id)
+			}
+			if errSet != nil {
+				return errSet
+			}
+			fmt.Printf("%sd %s\n", sub, summary.ID)
+		}
+		return nil
+	default:
+		if flags.NArg() == 0 {
+			return fmt.Errorf("usage: helixrun creds delete <id>...")
+		}
+		for _, id := range flags.Args() {
+			if err = creds.Delete(ctx, id); err != nil {
+				return err
+			}
+			fmt.Printf("deleted %s\n", id)
+		}
+		return nil
+	}
+}
+
+func openCredStore(ctx context.Context, common *commonFlags) (credStore, error) {
+	tokenStore, err := cliproxy.OpenTokenStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tokenStore != nil {
+		return &tokenCredStore{store: tokenStore}, nil
+	}
+	data, err := renderConfig(common.configPath, common.profile)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("load cliproxy config: %w", err)
+	}
+	absConfig, err := filepath.Abs(common.configPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := authdir.Resolve(cfg.AuthDir, filepath.Dir(absConfig))
+	if err != nil {
+		return nil, err
+	}
+	return fileCredStore(dir), nil
+}
+
+func listCreds(ctx context.Context, creds credStore, filter store.AuthFilter) error {
+	list, err := creds.List(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tEMAIL\tEXPIRES\tSTATUS\tUPDATED")
+	shown := 0
+	for _, c := range list {
+		meta := store.ParseAuthMeta(c.Content)
+		if !filter.Match(store.AuthSummary{ID: c.ID, AuthMeta: meta}) {
+			continue
+		}
+		expires := "-"
+		if meta.ExpiresAt != nil {
+			expires = meta.ExpiresAt.Local().Format(time.DateTime)
+		}
+		status := "enabled"
+		if meta.Disabled {
+			status = "disabled"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.ID, orDash(meta.Provider), orDash(meta.Email), expires, status, c.ModTime.Local().Format(time.DateTime))
+		shown++
+	}
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d credential(s) in %s\n", shown, creds)
+	return nil
+}
+
+// importCreds validates the auth files in source (a directory or tar archive)
+// and writes them into creds, reporting every file and a summary.
+func importCreds(ctx context.Context, creds credStore, source string, opts authfiles.ImportOptions) error {
+	files, err := authfiles.Read(source)
+	if err != nil {
+		return err
+	}
+	summary, err := authfiles.Import(ctx, creds, files, opts)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tID\tTYPE\tEMAIL\tNOTE")
+	for _, r := range summary.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Action, r.ID, orDash(r.Type), orDash(r.Email), r.Reason)
+	}
+	if errFlush := tw.Flush(); errFlush != nil && err == nil {
+		err = errFlush
+	}
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if opts.DryRun {
+		prefix = "dry run: "
+	}
+	fmt.Printf("%s%s (%s, on-conflict=%s)\n", prefix, summary, creds, opts.Conflict)
+	if summary.Failed() {
+		return fmt.Errorf("%d file(s) not imported", summary.Counts[authfiles.ActionInvalid]+summary.Counts[authfiles.ActionFailed])
+	}
+	return nil
+}
+
+// exportCreds writes every stored credential to a directory, a tar archive or,
+// for "-", an uncompressed tar stream on stdout.
+func exportCreds(ctx context.Context, creds credStore, target string) error {
+	files, err := creds.List(ctx)
+	if err != nil {
+		return err
+	}
+	if target == "-" {
+		if err = authfiles.WriteTar(os.Stdout, files, false); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d credential(s) exported\n", len(files))
+		return nil
+	}
+	if err = authfiles.Write(target, files); err != nil {
+		return err
+	}
+	fmt.Printf("%d credential(s) exported to %s\n", len(files), target)
+	return nil
+}
+
+func orDash(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
+
+// tokenCredStore operates on the token store backend and its local mirror.
+type tokenCredStore struct {
+	store *store.TokenStore
+}
+
+func (p *tokenCredStore) String() string {
+	return p.store.Backend().String() + " auth_store"
+}
+
+func (p *tokenCredStore) List(ctx context.Context) ([]authfiles.File, error) {
+	records, err := p.store.ListRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]authfiles.File, 0, len(records))
+	for _, rec := range records {
+		out = append(out, authfiles.File{ID: rec.ID, Content: rec.Content, ModTime: rec.UpdatedAt})
+	}
+	return out, nil
+}
+
+func (p *tokenCredStore) Get(ctx context.Context, id string) (*authfiles.File, error) {
+	rec, err := p.store.GetRecord(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &authfiles.File{ID: rec.ID, Content: rec.Content, ModTime: rec.UpdatedAt}, nil
+}
+
+func (p *tokenCredStore) Put(ctx context.Context, f authfiles.File) error {
+	return p.store.PutRecord(ctx, f.ID, f.Content)
+}
+
+func (p *tokenCredStore) GetMany(ctx context.Context, ids []string) (map[string]*authfiles.File, error) {
+	records, err := p.store.GetRecords(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*authfiles.File, len(records))
+	for id, rec := range records {
+		out[id] = &authfiles.File{ID: rec.ID, Content: rec.Content, ModTime: rec.UpdatedAt}
+	}
+	return out, nil
+}
+
+// PutMany writes all files with one bulk upsert where the backend supports it.
+func (p *tokenCredStore) PutMany(ctx context.Context, files []authfiles.File) error {
+	records := make([]store.AuthRecord, len(files))
+	for i, f := range files {
+		records[i] = store.AuthRecord{ID: f.ID, Content: f.Content}
+	}
+	return p.store.PutRecords(ctx, records)
+}
+
+func (p *tokenCredStore) Delete(ctx context.Context, id string) error {
+	err := p.store.DeleteRecord(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("credential %s not found", id)
+	}
+	return err
+}
+
+func (p *tokenCredStore) Close() error {
+	return p.store.Close()
+}
+
+// fileCredStore is a plain auth directory as used by CLIProxy in file mode.
+type fileCredStore string
+
+func (d fileCredStore) String() string {
+	return string(d)
+}
+
+func (d fileCredStore) List(context.Context) ([]authfiles.File, error) {
+	return authfiles.ReadDir(string(d))
+}
+
+func (d fileCredStore) Get(_ context.Context, id string) (*authfiles.File, error) {
+	path, err := authfiles.Path(string(d), id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &authfiles.File{ID: id, Content: content, ModTime: info.ModTime()}, nil
+}
+
+func (d fileCredStore) Put(_ context.Context, f authfiles.File) error {
+	return authfiles.WriteDir(string(d), []authfiles.File{f})
+}
+
+func (d fileCredStore) Delete(_ context.Context, id string) error {
+	path, err := authfiles.Path(string(d), id)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("credential %s not found", id)
+		}
+		return err
+	}
+	return nil
+}
+
+func (d fileCredStore) Close() error {
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/cliproxy"
+	"helixrun-cliproxy-starter/internal/cliproxy/authdir"
+	"helixrun-cliproxy-starter/internal/cliproxy/authfiles"
+)
+
+// doctor collects check results and prints them as they complete.
+type doctor struct {
+	failed int
+}
+
+func (d *doctor) ok(name, format string, args ...any) {
+	fmt.Printf("ok    %-14s %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(name, format string, args ...any) {
+	fmt.Printf("warn  %-14s %s\n", name, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(name, format string, args ...any) {
+	d.failed++
+	fmt.Printf("FAIL  %-14s %s\n", name, fmt.Sprintf(format, args...))
+}
+
+// runDoctor checks that a deployment is ready to serve: the config renders and
+// validates, the management password and credential store are set up, the
+// token store is reachable and the listen ports are free.
+func runDoctor(args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	common := registerCommonFlags(flags)
+	timeout := flags.Duration("timeout", 10*time.Second, "token store connection timeout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	d := &doctor{}
+	storeMode := strings.TrimSpace(os.Getenv("STORE_URL")) != "" || strings.TrimSpace(os.Getenv("PGSTORE_DSN")) != ""
+
+	data, err := renderConfig(common.configPath, common.profile)
+	if err != nil {
+		d.fail("config", "%v", err)
+	} else if cfg, errParse := parseConfig(data); errParse != nil {
+		d.fail("config", "parse: %v", errParse)
+	} else {
+		if problems, _ := validateConfig(common, true); len(problems) > 0 {
+			d.fail("config", "%s", strings.Join(problems, "; "))
+		} else {
+			d.ok("config", "%s (%d api key(s))", common.configPath, len(cfg.APIKeys))
+		}
+		if !storeMode {
+			d.checkAuthDir(common.configPath, cfg.AuthDir)
+		}
+		d.checkPort("cliproxy-port", cfg.Port)
+	}
+	d.checkPort("public-port", 8080)
+
+	if os.Getenv("LOCAL_MANAGEMENT_PASSWORD") == "" && os.Getenv("MANAGEMENT_PASSWORD") == "" {
+		d.warn("management", "LOCAL_MANAGEMENT_PASSWORD is not set; admin API only accepts loopback callers")
+	} else {
+		d.ok("management", "local management password set")
+	}
+
+	if storeMode {
+		d.checkStore(*timeout)
+	} else {
+		d.ok("store", "STORE_URL not set, using file mode")
+	}
+
+	if d.failed > 0 {
+		return fmt.Errorf("%d check(s) failed", d.failed)
+	}
+	return nil
+}
+
+func (d *doctor) checkAuthDir(configPath, raw string) {
+	absConfig, err := filepath.Abs(configPath)
+	if err != nil {
+		d.fail("auth-dir", "%v", err)
+		return
+	}
+	dir, err := authdir.Resolve(raw, filepath.Dir(absConfig))
+	if err != nil {
+		d.fail("auth-dir", "%v", err)
+		return
+	}
+	source, err := authfiles.ReadDir(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		d.warn("auth-dir", "%s does not exist yet; it is created on startup", dir)
+	case err != nil:
+		d.fail("auth-dir", "%v", err)
+	case len(source) == 0:
+		d.warn("auth-dir", "%s has no credentials", dir)
+	default:
+		d.ok("auth-dir", "%s (%d credential(s))", dir, len(source))
+	}
+}
+
+func (d *doctor) checkPort(name string, port int) {
+	addr := net.JoinHostPort("", strconv.Itoa(port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		d.warn(name, "%d is in use (is helixrun already running?)", port)
+		return
+	}
+	_ = ln.Close()
+	d.ok(name, "%d is free", port)
+}
+
+func (d *doctor) checkStore(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	tokenStore, err := cliproxy.OpenTokenStore(ctx)
+	if err != nil {
+		d.fail("store", "%v", err)
+		return
+	}
+	defer tokenStore.Close()
+	records, err := tokenStore.ListRecords(ctx)
+	if err != nil {
+		d.fail("store", "%v", err)
+		return
+	}
+	d.ok("store", "%s connected in %s, %d credential(s) in auth_store", tokenStore.Backend(), time.Since(start).Round(time.Millisecond), len(records))
+}
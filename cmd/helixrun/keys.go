@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"helixrun-cliproxy-starter/internal/cliproxy"
+	"helixrun-cliproxy-starter/internal/cliproxy/configreload"
+	"helixrun-cliproxy-starter/internal/cliproxy/configrender"
+	"helixrun-cliproxy-starter/internal/cliproxy/configsync"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// runKeys adds or removes entries of api-keys. The edit goes to the
+// config_store table when HELIXRUN_CONFIG_STORE is enabled, otherwise to the
+// config file in place; running servers pick it up through their config reload.
+func runKeys(args []string) error {
+	sub, args, err := subcommand("keys", args, "create", "revoke")
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("keys "+sub, flag.ContinueOnError)
+	common := registerCommonFlags(flags)
+	comment := flags.String("comment", "", "comment stored with the config version (config store only)")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+
+	var key string
+	switch {
+	case flags.NArg() > 1:
+		return fmt.Errorf("usage: helixrun keys %s <key>", sub)
+	case flags.NArg() == 1:
+		key = strings.TrimSpace(flags.Arg(0))
+	case sub == "revoke":
+		return fmt.Errorf("usage: helixrun keys revoke <key>")
+	default:
+		if key, err = generateAPIKey(); err != nil {
+			return err
+		}
+	}
+	if key == "" {
+		return fmt.Errorf("key is empty")
+	}
+
+	edit := func(keys []string) ([]string, error) {
+		if sub == "create" {
+			if slices.Contains(keys, key) {
+				return nil, fmt.Errorf("key already exists")
+			}
+			return append(keys, key), nil
+		}
+		idx := slices.Index(keys, key)
+		if idx == -1 {
+			return nil, fmt.Errorf("key not found")
+		}
+		return slices.Delete(keys, idx, idx+1), nil
+	}
+	if *comment == "" {
+		*comment = fmt.Sprintf("keys %s %s", sub, maskKey(key))
+	}
+
+	useStore, err := envBool("HELIXRUN_CONFIG_STORE", false)
+	if err != nil {
+		return err
+	}
+	if useStore {
+		err = editKeysInStore(common, edit, *comment)
+	} else {
+		err = editKeysInFile(common, edit)
+	}
+	if err != nil {
+		return err
+	}
+	if sub == "create" {
+		fmt.Println(key)
+	} else {
+		fmt.Printf("revoked %s\n", maskKey(key))
+	}
+	return nil
+}
+
+func editKeysInFile(common *commonFlags, edit func([]string) ([]string, error)) error {
+	absConfig, err := filepath.Abs(common.configPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(absConfig)
+	if err != nil {
+		return err
+	}
+	updated, err := editAPIKeys(data, edit)
+	if err != nil {
+		return err
+	}
+	rendered, err := configrender.RenderBytes(updated, absConfig, common.profile)
+	if err != nil {
+		return err
+	}
+	if problems := configreload.ValidateBytes(rendered, nil, filepath.Dir(absConfig)); len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	// Write in place so the CLIProxy watcher keeps its watch on the file.
+	return os.WriteFile(absConfig, updated, 0o600)
+}
+
+func editKeysInStore(common *commonFlags, edit func([]string) ([]string, error), comment string) error {
+	ctx := context.Background()
+	tokenStore, err := cliproxy.OpenTokenStore(ctx)
+	if err != nil {
+		return err
+	}
+	if tokenStore == nil {
+		return fmt.Errorf("HELIXRUN_CONFIG_STORE requires a Postgres STORE_URL or PGSTORE_DSN")
+	}
+	defer tokenStore.Close()
+	if tokenStore.DB() == nil {
+		return fmt.Errorf("HELIXRUN_CONFIG_STORE requires a Postgres STORE_URL or PGSTORE_DSN")
+	}
+	configStore, err := store.NewPostgresConfigStore(tokenStore.DB(), tokenStore.Schema())
+	if err != nil {
+		return err
+	}
+	latest, err := configStore.Latest(ctx)
+	if err != nil {
+		return fmt.Errorf("load stored config: %w", err)
+	}
+	updated, err := editAPIKeys([]byte(latest.Content), edit)
+	if err != nil {
+		return err
+	}
+	absConfig, err := filepath.Abs(common.configPath)
+	if err != nil {
+		return err
+	}
+	syncer := configsync.New(configStore, absConfig, configsync.Options{
+		SkipAuthDirCheck: true,
+		Render: func(content []byte) ([]byte, error) {
+			return configrender.RenderBytes(content, absConfig, common.profile)
+		},
+	})
+	v, err := syncer.Apply(ctx, string(updated), "helixrun-cli", comment, latest.Version)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "stored config version %d\n", v.Version)
+	return nil
+}
+
+// editAPIKeys rewrites the top-level api-keys list of a YAML document,
+// keeping the rest of the document (including comments) intact.
+func editAPIKeys(data []byte, edit func([]string) ([]string, error)) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config is not a mapping")
+	}
+	var list *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "api-keys" {
+			list = root.Content[i+1]
+			break
+		}
+	}
+	if list == nil {
+		list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "api-keys"}, list)
+	}
+	if list.Kind != yaml.SequenceNode {
+		// "api-keys:" with no entries parses as a null scalar.
+		*list = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+
+	keys := make([]string, 0, len(list.Content))
+	for _, item := range list.Content {
+		keys = append(keys, item.Value)
+	}
+	keys, err := edit(keys)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*yaml.Node, len(list.Content))
+	for _, item := range list.Content {
+		existing[item.Value] = item
+	}
+	list.Content = list.Content[:0]
+	list.Style = 0
+	for _, key := range keys {
+		if item, ok := existing[key]; ok {
+			list.Content = append(list.Content, item)
+			continue
+		}
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.DoubleQuotedStyle, Value: key})
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err = enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	if err = enc.Close(); err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// generateAPIKey returns a random key with a recognisable prefix.
+func generateAPIKey() (string, error) {
+	var b [24]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	return "hr-" + hex.EncodeToString(b[:]), nil
+}
+
+// maskKey keeps only enough of a key to recognise it in output and comments.
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
@@ -0,0 +1,197 @@
+// Command helixrun runs the HelixRun proxy and the operational tasks around it.
+//
+//	helixrun serve                         start CLIProxy and the public server
+//	helixrun migrate                       create or update the Postgres tables
+//	helixrun creds list|import|export|delete|disable|enable
+//	helixrun keys create|revoke            manage api-keys in cliproxy.yaml
+//	helixrun config validate               render and validate cliproxy.yaml
+//	helixrun doctor                        check configuration and connectivity
+//
+// Every command reads .env and .env.local first, so it sees the same settings
+// as the server.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	cliproxysdk "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/configrender"
+	"helixrun-cliproxy-starter/internal/dotenv"
+)
+
+const defaultConfigPath = "./config/cliproxy.yaml"
+
+const usage = `Usage: helixrun <command> [flags] [args]
+
+Commands:
+  serve                        start the embedded CLIProxy and the HelixRun server
+  migrate                      create or update the store tables (requires STORE_URL)
+  creds list                   list stored credentials
+  creds import <dir>           copy auth JSON files from dir into the credential store
+  creds export <dir>           write every stored credential into dir
+  creds delete <id>...         delete credentials by id
+  creds disable <id>...        take credentials out of rotation (requires STORE_URL)
+  creds enable <id>...         put disabled credentials back into rotation
+  keys create [key]            add an API key (generated when omitted)
+  keys revoke <key>            remove an API key
+  config validate              render and validate cliproxy.yaml
+  doctor                       check configuration, auth directory and database
+
+Common flags:
+  -config path                 CLIProxy config file (default ./config/cliproxy.yaml)
+  -profile name                overlay profile (default $HELIXRUN_PROFILE)
+
+Run "helixrun <command> -h" for command flags.
+`
+
+func main() {
+	// .env.local overrides .env; variables set in the real environment win over both.
+	if err := dotenv.Load(".env", ".env.local"); err != nil {
+		log.Fatalf("failed loading .env files: %v", err)
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command, args := os.Args[1], os.Args[2:]
+
+	var err error
+	switch command {
+	case "serve":
+		err = runServe(args)
+	case "migrate":
+		err = runMigrate(args)
+	case "creds":
+		err = runCreds(args)
+	case "keys":
+		err = runKeys(args)
+	case "config":
+		err = runConfig(args)
+	case "doctor":
+		err = runDoctor(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "helixrun: unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "helixrun %s: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+// commonFlags are accepted by every command that reads cliproxy.yaml.
+type commonFlags struct {
+	configPath string
+	profile    string
+}
+
+func registerCommonFlags(flags *flag.FlagSet) *commonFlags {
+	c := &commonFlags{}
+	flags.StringVar(&c.configPath, "config", defaultConfigPath, "CLIProxy config file")
+	// HELIXRUN_PROFILE selects an overlay such as config/cliproxy.prod.yaml.
+	flags.StringVar(&c.profile, "profile", strings.TrimSpace(os.Getenv("HELIXRUN_PROFILE")), "config overlay profile")
+	return c
+}
+
+// subcommand splits args into a sub-command name and its arguments.
+func subcommand(group string, args []string, names ...string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("missing sub-command, expected one of: %s", strings.Join(names, ", "))
+	}
+	for _, name := range names {
+		if args[0] == name {
+			return name, args[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("unknown %s sub-command %q, expected one of: %s", group, args[0], strings.Join(names, ", "))
+}
+
+// renderConfig returns the effective configuration the server would load,
+// without writing the rendered file.
+func renderConfig(path, profile string) ([]byte, error) {
+	needed, err := configrender.NeedsRender(path, profile)
+	if err != nil {
+		return nil, err
+	}
+	if needed {
+		return configrender.Render(path, profile)
+	}
+	return os.ReadFile(path)
+}
+
+// parseConfig loads rendered configuration bytes through the CLIProxy loader.
+func parseConfig(data []byte) (*cliproxysdk.Config, error) {
+	tmp, err := os.CreateTemp("", "cliproxy-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, errWrite := tmp.Write(data)
+	if err = errors.Join(errWrite, tmp.Close()); err != nil {
+		return nil, err
+	}
+	return cliproxysdk.LoadConfig(tmp.Name())
+}
+
+func envBool(key string, def bool) (bool, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return b, nil
+}
+
+func envFloat(key string, def float64) (float64, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return f, nil
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+func envInt(key string, def int) (int, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
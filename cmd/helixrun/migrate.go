@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"helixrun-cliproxy-starter/internal/cliproxy"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// runMigrate creates every HelixRun table in the store named by STORE_URL (or
+// PGSTORE_DSN). The server creates tables lazily as features are enabled;
+// migrate lets an operator prepare the database ahead of a rollout. SQLite and
+// S3 backends only hold auth_store; the remaining tables need Postgres.
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	tokenStore, err := cliproxy.OpenTokenStore(ctx)
+	if err != nil {
+		return err
+	}
+	if tokenStore == nil {
+		return fmt.Errorf("STORE_URL is not set")
+	}
+	defer tokenStore.Close()
+	fmt.Printf("auth_store (%s): ok\n", tokenStore.Backend())
+	if tokenStore.DB() == nil {
+		fmt.Println("config_store, request_log, response_cache, credential_pools, credential_cooldowns, event_subscriptions: skipped (Postgres only)")
+		return nil
+	}
+
+	db, schema := tokenStore.DB(), tokenStore.Schema()
+	configStore, err := store.NewPostgresConfigStore(db, schema)
+	if err != nil {
+		return err
+	}
+	requestLog, err := store.NewPostgresRequestLog(db, schema)
+	if err != nil {
+		return err
+	}
+	responseCache, err := store.NewPostgresResponseCache(db, schema, 0)
+	if err != nil {
+		return err
+	}
+	poolStore, err := store.NewPostgresPoolStore(db, schema)
+	if err != nil {
+		return err
+	}
+	cooldownStore, err := store.NewPostgresCooldownStore(db, schema)
+	if err != nil {
+		return err
+	}
+	eventStore, err := store.NewPostgresEventStore(db, schema)
+	if err != nil {
+		return err
+	}
+	tables := []struct {
+		name   string
+		ensure func(context.Context) error
+	}{
+		{"config_store", configStore.EnsureSchema},
+		{"request_log", requestLog.EnsureSchema},
+		{"response_cache", responseCache.EnsureSchema},
+		{"credential_pools", poolStore.EnsureSchema},
+		{"credential_cooldowns", cooldownStore.EnsureSchema},
+		{"event_subscriptions", eventStore.EnsureSchema},
+	}
+	for _, table := range tables {
+		if err = table.ensure(ctx); err != nil {
+			return err
+		}
+		fmt.Printf("%s: ok\n", table.name)
+	}
+	return nil
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	cliproxysdk "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy"
+
+	"helixrun-cliproxy-starter/internal/cliproxy"
+	"helixrun-cliproxy-starter/internal/cliproxy/configreload"
+	"helixrun-cliproxy-starter/internal/cliproxy/configrender"
+	"helixrun-cliproxy-starter/internal/cliproxy/cooldowns"
+	"helixrun-cliproxy-starter/internal/cliproxy/credpool"
+	"helixrun-cliproxy-starter/internal/cliproxy/errorlogs"
+	"helixrun-cliproxy-starter/internal/cliproxy/events"
+	"helixrun-cliproxy-starter/internal/cliproxy/healthprobe"
+	"helixrun-cliproxy-starter/internal/cliproxy/router"
+	"helixrun-cliproxy-starter/internal/cliproxy/tokenrefresh"
+	"helixrun-cliproxy-starter/internal/redact"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// runServe starts the embedded CLIProxy and the public HelixRun server and
+// blocks until SIGINT/SIGTERM.
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	common := registerCommonFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	configPath, profile := common.configPath, common.profile
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle SIGINT/SIGTERM for graceful shutdown.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		log.Println("received shutdown signal")
+		cancel()
+	}()
+
+	effectiveConfigPath, err := configrender.Prepare(configPath, profile)
+	if err != nil {
+		return fmt.Errorf("render cliproxy config: %w", err)
+	}
+	cfg, err := cliproxysdk.LoadConfig(effectiveConfigPath)
+	if err != nil {
+		return fmt.Errorf("load cliproxy config: %w", err)
+	}
+
+	localManagementKey := strings.TrimSpace(os.Getenv("LOCAL_MANAGEMENT_PASSWORD"))
+	if localManagementKey == "" {
+		localManagementKey = strings.TrimSpace(os.Getenv("MANAGEMENT_PASSWORD"))
+	}
+	if localManagementKey == "" {
+		localManagementKey = cfg.RemoteManagement.SecretKey
+		if localManagementKey != "" && strings.HasPrefix(localManagementKey, "$2") {
+			log.Println("warning: LOCAL_MANAGEMENT_PASSWORD not set; using hashed remote secret for local traffic")
+		}
+		if localManagementKey == "" {
+			log.Println("warning: no management key configured; management endpoints require manual headers")
+		}
+	}
+
+	configStore, err := envBool("HELIXRUN_CONFIG_STORE", false)
+	if err != nil {
+		return fmt.Errorf("invalid config store settings: %w", err)
+	}
+	configStoreInterval, err := envDuration("HELIXRUN_CONFIG_STORE_INTERVAL", 0)
+	if err != nil {
+		return fmt.Errorf("invalid config store settings: %w", err)
+	}
+	configReloadEnabled, err := envBool("HELIXRUN_CONFIG_RELOAD", true)
+	if err != nil {
+		return fmt.Errorf("invalid config reload settings: %w", err)
+	}
+	authSyncInterval, err := envDuration("HELIXRUN_AUTH_SYNC_INTERVAL", time.Minute)
+	if err != nil {
+		return fmt.Errorf("invalid auth sync settings: %w", err)
+	}
+
+	tokenRefresh, err := tokenRefreshConfig()
+	if err != nil {
+		return fmt.Errorf("invalid token refresh settings: %w", err)
+	}
+	healthProbe, err := healthProbeConfig()
+	if err != nil {
+		return fmt.Errorf("invalid credential probe settings: %w", err)
+	}
+	credentialPools, err := credentialPoolConfig()
+	if err != nil {
+		return fmt.Errorf("invalid credential pool settings: %w", err)
+	}
+	cooldownSync, err := cooldownConfig()
+	if err != nil {
+		return fmt.Errorf("invalid cooldown sync settings: %w", err)
+	}
+	eventBus, err := eventsConfig()
+	if err != nil {
+		return fmt.Errorf("invalid event settings: %w", err)
+	}
+
+	// Start embedded CLIProxyAPI service
+	cpSvc, err := cliproxy.Start(ctx, cliproxy.StartOptions{
+		ConfigPath:              configPath,
+		LocalManagementPassword: localManagementKey,
+		Profile:                 profile,
+		StageConfig:             configReloadEnabled,
+		Config:                  cfg,
+		ConfigStore:             configStore,
+		ConfigStoreInterval:     configStoreInterval,
+		AuthSyncInterval:        authSyncInterval,
+		TokenRefresh:            tokenRefresh,
+		HealthProbe:             healthProbe,
+		CredentialPools:         credentialPools,
+		Cooldowns:               cooldownSync,
+		Events:                  eventBus,
+	})
+	if err != nil {
+		return fmt.Errorf("start embedded CLIProxyAPI: %w", err)
+	}
+	// Until the public server runs, a setup error stops what was started so far.
+	var (
+		requestLog *router.RequestLogger
+		serving    bool
+	)
+	defer func() {
+		if serving {
+			return
+		}
+		if requestLog != nil {
+			requestLog.Close()
+		}
+		stopCLIProxy(cpSvc)
+	}()
+
+	// Reverse proxy from HelixRun public HTTP server to local CLIProxyAPI
+	cliproxyBase, err := url.Parse("http://127.0.0.1:8317")
+	if err != nil {
+		return fmt.Errorf("invalid cliproxy base URL: %w", err)
+	}
+
+	redactor, redactErrorBodies, err := newRedactor()
+	if err != nil {
+		return fmt.Errorf("configure redaction: %w", err)
+	}
+
+	responseCache, err := newResponseCache(ctx, cpSvc)
+	if err != nil {
+		return fmt.Errorf("configure response cache: %w", err)
+	}
+
+	requestLog, err = newRequestLogger(ctx, cpSvc, redactor)
+	if err != nil {
+		return fmt.Errorf("configure request log: %w", err)
+	}
+
+	errorLogs, err := newErrorLogIndex(configPath)
+	if err != nil {
+		return fmt.Errorf("configure error log retention: %w", err)
+	}
+	go errorLogs.Run(ctx, 0)
+
+	var configReload *configreload.Reloader
+	if configReloadEnabled {
+		if configReload, err = newConfigReloader(configPath, profile, cpSvc); err != nil {
+			return fmt.Errorf("configure config reload: %w", err)
+		}
+		go configReload.Run(ctx)
+	}
+
+	httpSrv := router.New(":8080", cliproxyBase, localManagementKey, router.Options{
+		Cache:             responseCache,
+		RequestLog:        requestLog,
+		ErrorLogs:         errorLogs,
+		ConfigReload:      configReload,
+		ConfigSync:        cpSvc.ConfigSync(),
+		TokenStore:        cpSvc.TokenStore(),
+		TokenRefresh:      cpSvc.TokenRefresh(),
+		HealthProbe:       cpSvc.HealthProbe(),
+		CredentialPools:   cpSvc.CredentialPools(),
+		Cooldowns:         cpSvc.Cooldowns(),
+		Events:            cpSvc.Events(),
+		Redactor:          redactor,
+		RedactErrorBodies: redactErrorBodies,
+	})
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("HelixRun public server listening on %s (proxying to %s)", httpSrv.Addr(), cliproxyBase.String())
+		if err := httpSrv.Start(); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+	serving = true
+
+	select {
+	case <-ctx.Done():
+		log.Println("context cancelled, shutting down servers")
+	case err = <-serveErr:
+		err = fmt.Errorf("http server: %w", err)
+		log.Printf("%v; shutting down", err)
+	}
+	shutdown(httpSrv, cpSvc, requestLog)
+	return err
+}
+
+// shutdown stops components in dependency order: the public server is marked
+// unready and drained first, then the request log is flushed, and only then is
+// the embedded CLIProxy (and its Postgres store) stopped, so streamed
+// completions are not cut off underneath the proxy.
+func shutdown(httpSrv *router.Server, cpSvc *cliproxy.Service, requestLog *router.RequestLogger) {
+	readyDelay, err := envDuration("HELIXRUN_SHUTDOWN_READY_DELAY", 0)
+	if err != nil {
+		log.Printf("warning: %v", err)
+	}
+	drainTimeout, err := envDuration("HELIXRUN_SHUTDOWN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		log.Printf("warning: %v", err)
+		drainTimeout = 30 * time.Second
+	}
+
+	httpSrv.MarkDraining()
+	if readyDelay > 0 {
+		log.Printf("readiness withdrawn; waiting %s before closing listeners", readyDelay)
+		time.Sleep(readyDelay)
+	}
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	if err := httpSrv.Shutdown(drainCtx); err != nil {
+		log.Printf("error shutting down HelixRun HTTP server: %v", err)
+	}
+	cancel()
+
+	if requestLog != nil {
+		requestLog.Close()
+	}
+
+	stopCLIProxy(cpSvc)
+	log.Println("shutdown complete")
+}
+
+// stopCLIProxy stops the embedded CLIProxy and its token store.
+func stopCLIProxy(cpSvc *cliproxy.Service) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := cpSvc.Shutdown(ctx); err != nil {
+		log.Printf("error shutting down CLIProxyAPI: %v", err)
+	}
+}
+
+// newResponseCache builds the opt-in response cache from HELIXRUN_CACHE_* settings.
+// HELIXRUN_CACHE selects the backend ("memory" or "postgres"); empty disables caching.
+func newResponseCache(ctx context.Context, cpSvc *cliproxy.Service) (*router.ResponseCache, error) {
+	backendName := strings.ToLower(strings.TrimSpace(os.Getenv("HELIXRUN_CACHE")))
+	if backendName == "" || backendName == "off" || backendName == "false" {
+		return nil, nil
+	}
+	ttl, err := envDuration("HELIXRUN_CACHE_TTL", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxEntries, err := envInt("HELIXRUN_CACHE_MAX_ENTRIES", 1000)
+	if err != nil {
+		return nil, err
+	}
+	maxBytes, err := envInt("HELIXRUN_CACHE_MAX_BYTES", 64<<20)
+	if err != nil {
+		return nil, err
+	}
+	maxBodyBytes, err := envInt("HELIXRUN_CACHE_MAX_BODY_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var backend router.CacheBackend
+	switch backendName {
+	case "memory":
+		backend = router.NewMemoryCache(maxEntries, int64(maxBytes))
+	case "postgres":
+		tokenStore := cpSvc.TokenStore()
+		if tokenStore.DB() == nil {
+			return nil, fmt.Errorf("HELIXRUN_CACHE=postgres requires a Postgres STORE_URL or PGSTORE_DSN")
+		}
+		pgCache, errCache := store.NewPostgresResponseCache(tokenStore.DB(), tokenStore.Schema(), maxEntries)
+		if errCache != nil {
+			return nil, errCache
+		}
+		if errCache = pgCache.EnsureSchema(ctx); errCache != nil {
+			return nil, errCache
+		}
+		backend = pgCache
+	default:
+		return nil, fmt.Errorf("unknown HELIXRUN_CACHE backend %q", backendName)
+	}
+	log.Printf("response cache enabled (backend=%s)", backendName)
+	return router.NewResponseCache(backend, router.CacheConfig{
+		TTL:          ttl,
+		MaxBodyBytes: int64(maxBodyBytes),
+	}), nil
+}
+
+// newRequestLogger builds the Postgres request log from HELIXRUN_REQUEST_LOG_* settings.
+func newRequestLogger(ctx context.Context, cpSvc *cliproxy.Service, redactor *redact.Redactor) (*router.RequestLogger, error) {
+	enabled, err := envBool("HELIXRUN_REQUEST_LOG", false)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	tokenStore := cpSvc.TokenStore()
+	if tokenStore.DB() == nil {
+		return nil, fmt.Errorf("HELIXRUN_REQUEST_LOG requires a Postgres STORE_URL or PGSTORE_DSN")
+	}
+	sampleRate, err := envFloat("HELIXRUN_REQUEST_LOG_SAMPLE", 1)
+	if err != nil {
+		return nil, err
+	}
+	alwaysErrors, err := envBool("HELIXRUN_REQUEST_LOG_ERRORS", true)
+	if err != nil {
+		return nil, err
+	}
+	maxBody, err := envInt("HELIXRUN_REQUEST_LOG_MAX_BODY_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+	retention, err := envDuration("HELIXRUN_REQUEST_LOG_RETENTION", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pgLog, err := store.NewPostgresRequestLog(tokenStore.DB(), tokenStore.Schema())
+	if err != nil {
+		return nil, err
+	}
+	if err = pgLog.EnsureSchema(ctx); err != nil {
+		return nil, err
+	}
+	log.Printf("request log enabled (sample=%.2f, errors=%t)", sampleRate, alwaysErrors)
+	return router.NewRequestLogger(pgLog, router.RequestLogConfig{
+		SampleRate:      sampleRate,
+		AlwaysLogErrors: alwaysErrors,
+		MaxBodyBytes:    maxBody,
+		Retention:       retention,
+		Redactor:        redactor,
+	}), nil
+}
+
+// newRedactor builds the secret redaction rules from HELIXRUN_REDACT_* settings.
+// Custom patterns are "name=regex" pairs separated by ";;" so regexes may contain ";".
+func newRedactor() (*redact.Redactor, bool, error) {
+	disableDefaults, err := envBool("HELIXRUN_REDACT_DISABLE_DEFAULTS", false)
+	if err != nil {
+		return nil, false, err
+	}
+	emails, err := envBool("HELIXRUN_REDACT_EMAILS", false)
+	if err != nil {
+		return nil, false, err
+	}
+	errorBodies, err := envBool("HELIXRUN_REDACT_ERROR_BODIES", true)
+	if err != nil {
+		return nil, false, err
+	}
+	redactor, err := redact.New(redact.Config{
+		DisableDefaults: disableDefaults,
+		Emails:          emails,
+		Patterns:        strings.Split(os.Getenv("HELIXRUN_REDACT_PATTERNS"), ";;"),
+		Headers:         strings.Split(os.Getenv("HELIXRUN_REDACT_HEADERS"), ","),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return redactor, errorBodies, nil
+}
+
+// newErrorLogIndex indexes CLIProxy's error-*.log files and applies the
+// HELIXRUN_ERROR_LOG_MAX_AGE / HELIXRUN_ERROR_LOG_MAX_BYTES retention limits.
+func newErrorLogIndex(configPath string) (*errorlogs.Index, error) {
+	maxAge, err := envDuration("HELIXRUN_ERROR_LOG_MAX_AGE", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	maxBytes, err := envInt("HELIXRUN_ERROR_LOG_MAX_BYTES", 256<<20)
+	if err != nil {
+		return nil, err
+	}
+	absConfig, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return errorlogs.New(errorlogs.DefaultDir(absConfig), errorlogs.Retention{
+		MaxAge:        maxAge,
+		MaxTotalBytes: int64(maxBytes),
+	}), nil
+}
+
+// tokenRefreshConfig reads the HELIXRUN_TOKEN_REFRESH_* settings; the
+// scheduler runs unless HELIXRUN_TOKEN_REFRESH=false.
+func tokenRefreshConfig() (*tokenrefresh.Config, error) {
+	enabled, err := envBool("HELIXRUN_TOKEN_REFRESH", true)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	cfg := &tokenrefresh.Config{}
+	if cfg.Lead, err = envDuration("HELIXRUN_TOKEN_REFRESH_LEAD", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Interval, err = envDuration("HELIXRUN_TOKEN_REFRESH_INTERVAL", 0); err != nil {
+		return nil, err
+	}
+	if cfg.AlertRepeat, err = envDuration("HELIXRUN_ALERT_REPEAT", 0); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// healthProbeConfig reads the HELIXRUN_HEALTH_PROBE_* settings. Probes are
+// enabled unless HELIXRUN_HEALTH_PROBE=false; HELIXRUN_HEALTH_PROBE_INTERVAL=0
+// keeps them on-demand only. HELIXRUN_HEALTH_PROBE_MODELS pins the probe model
+// per provider as "provider=model" pairs separated by commas.
+func healthProbeConfig() (*healthprobe.Config, error) {
+	enabled, err := envBool("HELIXRUN_HEALTH_PROBE", true)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	cfg := &healthprobe.Config{Models: make(map[string]string)}
+	if cfg.Interval, err = envDuration("HELIXRUN_HEALTH_PROBE_INTERVAL", 30*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout, err = envDuration("HELIXRUN_HEALTH_PROBE_TIMEOUT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Concurrency, err = envInt("HELIXRUN_HEALTH_PROBE_CONCURRENCY", 0); err != nil {
+		return nil, err
+	}
+	for _, pair := range strings.Split(os.Getenv("HELIXRUN_HEALTH_PROBE_MODELS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		provider, model, ok := strings.Cut(pair, "=")
+		provider, model = strings.ToLower(strings.TrimSpace(provider)), strings.TrimSpace(model)
+		if !ok || provider == "" || model == "" {
+			return nil, fmt.Errorf("invalid HELIXRUN_HEALTH_PROBE_MODELS entry %q (want provider=model)", pair)
+		}
+		cfg.Models[provider] = model
+	}
+	return cfg, nil
+}
+
+// credentialPoolConfig enables credential pools with HELIXRUN_CREDENTIAL_POOLS=true
+// (they need a Postgres token store). HELIXRUN_CREDENTIAL_POOLS_INTERVAL sets
+// how often pools changed on other replicas are picked up.
+func credentialPoolConfig() (*credpool.Config, error) {
+	enabled, err := envBool("HELIXRUN_CREDENTIAL_POOLS", false)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	cfg := &credpool.Config{}
+	if cfg.Interval, err = envDuration("HELIXRUN_CREDENTIAL_POOLS_INTERVAL", 0); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// cooldownConfig shares credential cooldowns through Postgres unless
+// HELIXRUN_COOLDOWN_SYNC=false. HELIXRUN_COOLDOWN_SYNC_INTERVAL sets how often
+// cooldowns recorded by other replicas are applied.
+func cooldownConfig() (*cooldowns.Config, error) {
+	enabled, err := envBool("HELIXRUN_COOLDOWN_SYNC", true)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	cfg := &cooldowns.Config{}
+	if cfg.Interval, err = envDuration("HELIXRUN_COOLDOWN_SYNC_INTERVAL", 0); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// eventsConfig delivers operational events to the stored subscriptions unless
+// HELIXRUN_EVENTS=false. HELIXRUN_EVENTS_MAX_ATTEMPTS, _BACKOFF and
+// _RETENTION tune retries and the delivery log; HELIXRUN_SMTP_* configure the
+// mail server for email subscriptions.
+func eventsConfig() (*events.Config, error) {
+	enabled, err := envBool("HELIXRUN_EVENTS", true)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	cfg := &events.Config{
+		SMTP: events.SMTPConfig{
+			Addr:     strings.TrimSpace(os.Getenv("HELIXRUN_SMTP_ADDR")),
+			Username: strings.TrimSpace(os.Getenv("HELIXRUN_SMTP_USERNAME")),
+			Password: os.Getenv("HELIXRUN_SMTP_PASSWORD"),
+			From:     strings.TrimSpace(os.Getenv("HELIXRUN_SMTP_FROM")),
+		},
+	}
+	if cfg.Interval, err = envDuration("HELIXRUN_EVENTS_INTERVAL", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxAttempts, err = envInt("HELIXRUN_EVENTS_MAX_ATTEMPTS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Backoff, err = envDuration("HELIXRUN_EVENTS_BACKOFF", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Retention, err = envDuration("HELIXRUN_EVENTS_RETENTION", 0); err != nil {
+		return nil, err
+	}
+	if cfg.SMTP.Addr != "" && cfg.SMTP.From == "" && cfg.SMTP.Username == "" {
+		return nil, fmt.Errorf("HELIXRUN_SMTP_FROM is required when HELIXRUN_SMTP_ADDR is set without a username")
+	}
+	return cfg, nil
+}
+
+// newConfigReloader watches cliproxy.yaml for edits; HELIXRUN_CONFIG_RELOAD=false
+// disables it. HELIXRUN_CONFIG_RELOAD_INTERVAL sets the polling interval. The
+// sources are rendered on every check and CLIProxy only sees the staged copy
+// once it validated.
+func newConfigReloader(configPath, profile string, cpSvc *cliproxy.Service) (*configreload.Reloader, error) {
+	interval, err := envDuration("HELIXRUN_CONFIG_RELOAD_INTERVAL", 0)
+	if err != nil {
+		return nil, err
+	}
+	absConfig, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	opts := configreload.Options{
+		Interval:         interval,
+		SkipAuthDirCheck: cpSvc.TokenStore() != nil,
+		Events:           cpSvc.Events(),
+		Render: func() ([]byte, error) {
+			return configrender.Effective(absConfig, profile)
+		},
+	}
+	return configreload.New(absConfig, cpSvc.ConfigPath(), cpSvc.Config(), opts)
+}
@@ -0,0 +1,70 @@
+// Package authdir resolves the auth-dir setting from cliproxy.yaml into an
+// absolute, existing directory.
+package authdir
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var windowsAbs = regexp.MustCompile(`^(?:[A-Za-z]:[\\/]|\\\\)`)
+
+// Resolve turns raw into an absolute path. "~" expands to the home directory,
+// relative paths are taken relative to configDir and backslashes are accepted
+// as separators on every platform. Windows drive or UNC paths are rejected on
+// other platforms because they cannot point anywhere useful there.
+func Resolve(raw, configDir string) (string, error) {
+	dir := strings.TrimSpace(raw)
+	if dir == "" {
+		return "", fmt.Errorf("auth-dir is empty")
+	}
+	if runtime.GOOS != "windows" {
+		if windowsAbs.MatchString(dir) {
+			return "", fmt.Errorf("auth-dir %q is a Windows path; use a path relative to the config file (e.g. \"../auths\") or ~/...", raw)
+		}
+		dir = strings.ReplaceAll(dir, `\`, "/")
+	}
+	if dir == "~" || strings.HasPrefix(dir, "~/") || strings.HasPrefix(dir, `~\`) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("resolve auth-dir %q: %w", raw, err)
+		}
+		dir = filepath.Join(home, filepath.FromSlash(strings.TrimLeft(dir[1:], `/\`)))
+	}
+	dir = filepath.FromSlash(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(configDir, dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// Ensure creates dir with owner-only permissions when missing and checks that
+// it is a writable directory.
+func Ensure(dir string) error {
+	info, err := os.Stat(dir)
+	switch {
+	case os.IsNotExist(err):
+		if err = os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("create auth-dir %s: %w", dir, err)
+		}
+	case err != nil:
+		return fmt.Errorf("stat auth-dir %s: %w", dir, err)
+	case !info.IsDir():
+		return fmt.Errorf("auth-dir %s is not a directory", dir)
+	case runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0:
+		log.Printf("warning: auth-dir %s is accessible by other users (mode %s); consider chmod 700", dir, info.Mode().Perm())
+	}
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("auth-dir %s is not writable: %w", dir, err)
+	}
+	name := probe.Name()
+	_ = probe.Close()
+	_ = os.Remove(name)
+	return nil
+}
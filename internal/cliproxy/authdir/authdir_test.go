@@ -0,0 +1,124 @@
+package authdir
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("expectations use Unix paths")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configDir := "/srv/helixrun/config"
+
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{raw: "../auths", want: "/srv/helixrun/auths"},
+		{raw: "auths", want: "/srv/helixrun/config/auths"},
+		{raw: "./auths/../tokens/", want: "/srv/helixrun/config/tokens"},
+		{raw: "  ../auths  ", want: "/srv/helixrun/auths"},
+		{raw: "/var/lib/helixrun/auths", want: "/var/lib/helixrun/auths"},
+		{raw: "~", want: home},
+		{raw: "~/.cli-proxy-api", want: filepath.Join(home, ".cli-proxy-api")},
+		{raw: `~\.cli-proxy-api`, want: filepath.Join(home, ".cli-proxy-api")},
+		{raw: `..\auths\codex`, want: "/srv/helixrun/auths/codex"},
+		{raw: "~other/auths", want: "/srv/helixrun/config/~other/auths"},
+		{raw: "", wantErr: "auth-dir is empty"},
+		{raw: "   ", wantErr: "auth-dir is empty"},
+		{raw: `C:\Users\me\auths`, wantErr: "is a Windows path"},
+		{raw: "c:/auths", wantErr: "is a Windows path"},
+		{raw: `\\fileserver\share\auths`, wantErr: "is a Windows path"},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(tt.raw, configDir)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Resolve(%q) = %q, %v; want error %q", tt.raw, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not meaningful on Windows")
+	}
+	root := t.TempDir()
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	private := filepath.Join(root, "private")
+	shared := filepath.Join(root, "shared")
+	readOnly := filepath.Join(root, "read-only")
+	for dir, mode := range map[string]os.FileMode{private: 0o700, shared: 0o755, readOnly: 0o500} {
+		if err := os.Mkdir(dir, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(dir, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { _ = os.Chmod(readOnly, 0o700) })
+
+	tests := []struct {
+		name     string
+		dir      string
+		wantErr  string
+		wantWarn bool
+	}{
+		{name: "missing is created", dir: filepath.Join(root, "new", "auths")},
+		{name: "private", dir: private},
+		{name: "readable by others", dir: shared, wantWarn: true},
+		{name: "not a directory", dir: file, wantErr: "is not a directory"},
+		{name: "not writable", dir: readOnly, wantErr: "is not writable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.dir == readOnly && os.Geteuid() == 0 {
+				t.Skip("root can write to any directory")
+			}
+			var logged bytes.Buffer
+			log.SetOutput(&logged)
+			defer log.SetOutput(os.Stderr)
+
+			err := Ensure(tt.dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Ensure error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Ensure: %v", err)
+			}
+			info, err := os.Stat(tt.dir)
+			if err != nil || !info.IsDir() {
+				t.Fatalf("stat %s: %v", tt.dir, err)
+			}
+			if tt.dir != shared && info.Mode().Perm() != 0o700 {
+				t.Fatalf("mode = %s, want 0700", info.Mode().Perm())
+			}
+			if warned := strings.Contains(logged.String(), "accessible by other users"); warned != tt.wantWarn {
+				t.Fatalf("warning logged = %v, want %v (log %q)", warned, tt.wantWarn, logged.String())
+			}
+			if entries, _ := os.ReadDir(tt.dir); len(entries) != 0 {
+				t.Fatalf("write check left %d file(s) behind", len(entries))
+			}
+		})
+	}
+}
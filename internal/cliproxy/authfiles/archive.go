@@ -0,0 +1,204 @@
+package authfiles
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxFileSize bounds a single auth file read from an archive.
+const maxFileSize = 1 << 20
+
+// IsArchive reports whether p names a tar archive (.tar, .tar.gz or .tgz).
+func IsArchive(p string) bool {
+	lower := strings.ToLower(p)
+	return strings.HasSuffix(lower, ".tar") || isGzip(lower)
+}
+
+func isGzip(lower string) bool {
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+// Read loads auth files from a directory or a tar archive.
+func Read(p string) ([]File, error) {
+	if !IsArchive(p) {
+		return ReadDir(p)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTar(f, isGzip(strings.ToLower(p)))
+}
+
+// Write stores files in a directory or, when p names an archive, a tar file.
+func Write(p string, files []File) error {
+	if !IsArchive(p) {
+		return WriteDir(p, files)
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err = WriteTar(f, files, isGzip(strings.ToLower(p))); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadDir returns every *.json file below dir, sorted by id.
+func ReadDir(dir string) ([]File, error) {
+	var out []File
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() || !isAuthFile(d.Name()) {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		out = append(out, File{ID: filepath.ToSlash(rel), Content: content, ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", dir, err)
+	}
+	sortFiles(out)
+	return out, nil
+}
+
+// WriteDir writes files below dir with owner-only permissions and their
+// modification times, so a later newer-wins import compares correctly.
+func WriteDir(dir string, files []File) error {
+	for _, f := range files {
+		p, err := Path(dir, f.ID)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			return err
+		}
+		if err = os.WriteFile(p, f.Content, 0o600); err != nil {
+			return err
+		}
+		if !f.ModTime.IsZero() {
+			if err = os.Chtimes(p, f.ModTime, f.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadTar returns the *.json entries of a tar stream.
+func ReadTar(r io.Reader, gzipped bool) ([]File, error) {
+	if gzipped {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	var out []File
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !isAuthFile(hdr.Name) {
+			continue
+		}
+		id := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if _, err = Path(".", id); err != nil {
+			return nil, err
+		}
+		if hdr.Size > maxFileSize {
+			return nil, fmt.Errorf("read archive: %s is larger than %d bytes", id, maxFileSize)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %s: %w", id, err)
+		}
+		out = append(out, File{ID: id, Content: content, ModTime: hdr.ModTime})
+	}
+	sortFiles(out)
+	return out, nil
+}
+
+// WriteTar writes files as a tar stream, optionally gzip-compressed.
+func WriteTar(w io.Writer, files []File, gzipped bool) error {
+	var zw *gzip.Writer
+	if gzipped {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.ID,
+			Mode:    0o600,
+			Size:    int64(len(f.Content)),
+			ModTime: f.ModTime,
+			Format:  tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write archive: %w", err)
+		}
+		if _, err := tw.Write(f.Content); err != nil {
+			return fmt.Errorf("write archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("write archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// Path maps a slash-separated id to a path inside dir, rejecting ids
+// that would escape it.
+func Path(dir, id string) (string, error) {
+	clean := path.Clean(strings.TrimSpace(id))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) || strings.Contains(clean, "\\") {
+		return "", fmt.Errorf("invalid auth file id %q", id)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+func isAuthFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".json")
+}
+
+func sortFiles(files []File) {
+	sort.Slice(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+}
@@ -0,0 +1,296 @@
+// Package authfiles validates, imports and exports CLIProxy auth JSON files.
+//
+// An auth file is identified by its slash-separated path relative to the auth
+// directory (e.g. "gemini-me@example.com.json"), the same id used as the
+// primary key of auth_store.
+package authfiles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// File is one auth JSON document.
+type File struct {
+	ID      string
+	Content []byte
+	ModTime time.Time
+}
+
+// Store is a credential backend that files are imported into.
+type Store interface {
+	// Get returns the stored file, or nil when id does not exist.
+	Get(ctx context.Context, id string) (*File, error)
+	Put(ctx context.Context, f File) error
+}
+
+// BatchStore is a Store that can read and write many files in one round
+// trip. Import uses it when available.
+type BatchStore interface {
+	Store
+	// GetMany returns the stored files keyed by id; missing ids are absent.
+	GetMany(ctx context.Context, ids []string) (map[string]*File, error)
+	// PutMany writes all files or none of them.
+	PutMany(ctx context.Context, files []File) error
+}
+
+// Meta is what Validate learned about a file.
+type Meta struct {
+	Type  string
+	Email string
+	// Warnings are non-fatal findings, such as a missing e-mail.
+	Warnings []string
+}
+
+// tokenFields are the credential fields used by the CLIProxy providers
+// (OAuth tokens, API keys, cookies and Vertex service accounts).
+var tokenFields = []string{
+	"access_token", "refresh_token", "id_token", "api_key", "cookie",
+	"accessToken", "refreshToken", "service_account",
+}
+
+// Validate checks that content is an auth file CLIProxy can load: a JSON
+// object with a provider type and at least one credential, either at the top
+// level or in a nested object such as Gemini's "token".
+func Validate(content []byte) (Meta, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return Meta{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if doc == nil {
+		return Meta{}, fmt.Errorf("not a JSON object")
+	}
+	var meta Meta
+	typ, _ := doc["type"].(string)
+	meta.Type = strings.TrimSpace(typ)
+	if meta.Type == "" {
+		return meta, fmt.Errorf("missing \"type\"")
+	}
+	switch email := doc["email"].(type) {
+	case nil:
+		meta.Warnings = append(meta.Warnings, "no email")
+	case string:
+		meta.Email = strings.TrimSpace(email)
+		if meta.Email != "" && !strings.Contains(meta.Email, "@") {
+			return meta, fmt.Errorf("malformed email %q", meta.Email)
+		}
+	default:
+		return meta, fmt.Errorf("\"email\" is not a string")
+	}
+	if !hasToken(doc, 2) {
+		return meta, fmt.Errorf("no credential field (%s)", strings.Join(tokenFields, ", "))
+	}
+	return meta, nil
+}
+
+func hasToken(doc map[string]any, depth int) bool {
+	for _, field := range tokenFields {
+		switch v := doc[field].(type) {
+		case string:
+			if strings.TrimSpace(v) != "" {
+				return true
+			}
+		case map[string]any:
+			if len(v) > 0 {
+				return true
+			}
+		}
+	}
+	if depth <= 1 {
+		return false
+	}
+	for _, v := range doc {
+		if nested, ok := v.(map[string]any); ok && hasToken(nested, depth-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConflictMode decides what happens when an imported id already exists.
+type ConflictMode string
+
+const (
+	// ConflictSkip keeps the stored file.
+	ConflictSkip ConflictMode = "skip"
+	// ConflictOverwrite replaces the stored file.
+	ConflictOverwrite ConflictMode = "overwrite"
+	// ConflictNewerWins replaces the stored file only when the imported one is newer.
+	ConflictNewerWins ConflictMode = "newer-wins"
+)
+
+// ParseConflictMode parses a ConflictMode name.
+func ParseConflictMode(s string) (ConflictMode, error) {
+	switch mode := ConflictMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case ConflictSkip, ConflictOverwrite, ConflictNewerWins:
+		return mode, nil
+	case "":
+		return ConflictSkip, nil
+	default:
+		return "", fmt.Errorf("unknown conflict mode %q (skip, overwrite, newer-wins)", s)
+	}
+}
+
+// Action is the outcome of importing one file.
+type Action string
+
+const (
+	ActionCreated   Action = "created"
+	ActionUpdated   Action = "updated"
+	ActionUnchanged Action = "unchanged"
+	ActionSkipped   Action = "skipped"
+	ActionInvalid   Action = "invalid"
+	ActionFailed    Action = "failed"
+)
+
+// Result reports what happened to one file.
+type Result struct {
+	ID     string
+	Type   string
+	Email  string
+	Action Action
+	// Reason explains skipped, invalid and failed files and carries validation warnings.
+	Reason string
+}
+
+// Summary collects the results of an import.
+type Summary struct {
+	Results []Result
+	Counts  map[Action]int
+}
+
+// Failed reports whether any file was invalid or could not be written.
+func (s Summary) Failed() bool {
+	return s.Counts[ActionInvalid] > 0 || s.Counts[ActionFailed] > 0
+}
+
+// String renders the counts, e.g. "3 created, 1 updated, 0 unchanged, ...".
+func (s Summary) String() string {
+	actions := []Action{ActionCreated, ActionUpdated, ActionUnchanged, ActionSkipped, ActionInvalid, ActionFailed}
+	parts := make([]string, 0, len(actions))
+	for _, a := range actions {
+		parts = append(parts, fmt.Sprintf("%d %s", s.Counts[a], a))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ImportOptions tunes Import.
+type ImportOptions struct {
+	Conflict ConflictMode
+	// DryRun reports what would happen without writing anything.
+	DryRun bool
+}
+
+// Import validates files and writes them into st. Invalid files and write
+// failures are reported in the summary and do not stop the import; only
+// errors reading from st abort it. When st is a BatchStore the existing files
+// are read with one GetMany and all writes go out in one PutMany, so either
+// every write succeeds or all of them are reported as failed.
+func Import(ctx context.Context, st Store, files []File, opts ImportOptions) (Summary, error) {
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictSkip
+	}
+	summary := Summary{Counts: make(map[Action]int)}
+	batch, isBatch := st.(BatchStore)
+	var stored map[string]*File
+	if isBatch {
+		ids := make([]string, 0, len(files))
+		for _, f := range files {
+			ids = append(ids, f.ID)
+		}
+		var err error
+		if stored, err = batch.GetMany(ctx, ids); err != nil {
+			return summary, err
+		}
+	}
+	// Files accepted earlier in this import shadow the stored copy, so a
+	// duplicate id is compared against what the import will have written.
+	accepted := make(map[string]*File)
+	var (
+		pending   []File
+		pendingAt []int
+	)
+	for _, f := range files {
+		res := Result{ID: f.ID}
+		meta, err := Validate(f.Content)
+		res.Type, res.Email = meta.Type, meta.Email
+		if err != nil {
+			res.Action, res.Reason = ActionInvalid, err.Error()
+			summary.add(res)
+			continue
+		}
+		res.Reason = strings.Join(meta.Warnings, "; ")
+
+		existing, ok := accepted[f.ID]
+		switch {
+		case ok:
+		case isBatch:
+			existing = stored[f.ID]
+		default:
+			if existing, err = st.Get(ctx, f.ID); err != nil {
+				return summary, err
+			}
+		}
+		switch {
+		case existing == nil:
+			res.Action = ActionCreated
+		case sameJSON(existing.Content, f.Content):
+			res.Action = ActionUnchanged
+		case opts.Conflict == ConflictOverwrite:
+			res.Action = ActionUpdated
+		case opts.Conflict == ConflictNewerWins && f.ModTime.After(existing.ModTime):
+			res.Action = ActionUpdated
+		case opts.Conflict == ConflictNewerWins:
+			res.Action = ActionSkipped
+			res.Reason = fmt.Sprintf("stored copy is newer (%s >= %s)", existing.ModTime.UTC().Format(time.RFC3339), f.ModTime.UTC().Format(time.RFC3339))
+		default:
+			res.Action, res.Reason = ActionSkipped, "already exists"
+		}
+		if res.Action == ActionCreated || res.Action == ActionUpdated {
+			accepted[f.ID] = &f
+			switch {
+			case opts.DryRun:
+			case isBatch:
+				pending = append(pending, f)
+				pendingAt = append(pendingAt, len(summary.Results))
+			default:
+				if err = st.Put(ctx, f); err != nil {
+					res.Action, res.Reason = ActionFailed, err.Error()
+					delete(accepted, f.ID)
+				}
+			}
+		}
+		summary.add(res)
+	}
+	if len(pending) > 0 {
+		if err := batch.PutMany(ctx, pending); err != nil {
+			for _, i := range pendingAt {
+				res := &summary.Results[i]
+				summary.Counts[res.Action]--
+				res.Action, res.Reason = ActionFailed, err.Error()
+				summary.Counts[ActionFailed]++
+			}
+		}
+	}
+	return summary, nil
+}
+
+func (s *Summary) add(r Result) {
+	s.Results = append(s.Results, r)
+	s.Counts[r.Action]++
+}
+
+// sameJSON compares two documents semantically, falling back to bytes for invalid JSON.
+func sameJSON(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	ca, errA := json.Marshal(va)
+	cb, errB := json.Marshal(vb)
+	return errA == nil && errB == nil && bytes.Equal(ca, cb)
+}
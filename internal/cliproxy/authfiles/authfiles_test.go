@@ -0,0 +1,261 @@
+package authfiles
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryStore is an in-process Store; failPut makes every write fail.
+type memoryStore struct {
+	files   map[string]File
+	failPut error
+	puts    int
+}
+
+func newMemoryStore(files ...File) *memoryStore {
+	m := &memoryStore{files: make(map[string]File)}
+	for _, f := range files {
+		m.files[f.ID] = f
+	}
+	return m
+}
+
+func (m *memoryStore) Get(_ context.Context, id string) (*File, error) {
+	f, ok := m.files[id]
+	if !ok {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+func (m *memoryStore) Put(_ context.Context, f File) error {
+	if m.failPut != nil {
+		return m.failPut
+	}
+	m.puts++
+	m.files[f.ID] = f
+	return nil
+}
+
+// batchStore adds the BatchStore methods to memoryStore.
+type batchStore struct {
+	*memoryStore
+}
+
+func (b batchStore) GetMany(ctx context.Context, ids []string) (map[string]*File, error) {
+	out := make(map[string]*File)
+	for _, id := range ids {
+		if f, _ := b.Get(ctx, id); f != nil {
+			out[id] = f
+		}
+	}
+	return out, nil
+}
+
+func (b batchStore) PutMany(ctx context.Context, files []File) error {
+	if b.failPut != nil {
+		return b.failPut
+	}
+	for _, f := range files {
+		if err := b.Put(ctx, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Meta
+		wantErr string
+	}{
+		{
+			name:    "codex",
+			content: `{"type":"codex","email":"me@example.com","access_token":"at","refresh_token":"rt"}`,
+			want:    Meta{Type: "codex", Email: "me@example.com"},
+		},
+		{
+			name:    "gemini nested token",
+			content: `{"type":"gemini","email":"me@example.com","token":{"access_token":"at"}}`,
+			want:    Meta{Type: "gemini", Email: "me@example.com"},
+		},
+		{
+			name:    "api key without email",
+			content: `{"type":"openai-compat","api_key":"sk-1"}`,
+			want:    Meta{Type: "openai-compat", Warnings: []string{"no email"}},
+		},
+		{name: "invalid JSON", content: `{"type":`, wantErr: "invalid JSON"},
+		{name: "not an object", content: `null`, wantErr: "not a JSON object"},
+		{name: "array", content: `[]`, wantErr: "invalid JSON"},
+		{name: "missing type", content: `{"email":"me@example.com","access_token":"at"}`, wantErr: `missing "type"`},
+		{name: "malformed email", content: `{"type":"codex","email":"me","access_token":"at"}`, wantErr: "malformed email"},
+		{name: "email not a string", content: `{"type":"codex","email":42,"access_token":"at"}`, wantErr: `"email" is not a string`},
+		{name: "no credential", content: `{"type":"codex","email":"me@example.com","access_token":" "}`, wantErr: "no credential field"},
+		{name: "credential nested too deep", content: `{"type":"gemini","a":{"b":{"access_token":"at"}}}`, wantErr: "no credential field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Validate([]byte(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if got.Type != tt.want.Type || got.Email != tt.want.Email || strings.Join(got.Warnings, ";") != strings.Join(tt.want.Warnings, ";") {
+				t.Fatalf("Validate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportConflictModes(t *testing.T) {
+	older := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	const (
+		stored   = `{"type":"codex","email":"a@example.com","access_token":"old"}`
+		imported = `{"type":"codex","email":"a@example.com","access_token":"new"}`
+	)
+
+	// The import source is a directory laid out as in file mode.
+	dir := t.TempDir()
+	source := []File{
+		{ID: "codex-a.json", Content: []byte(imported), ModTime: newer},
+		{ID: "codex-b.json", Content: []byte(imported), ModTime: older},
+		{ID: "codex-same.json", Content: []byte(`{ "access_token":"old", "email":"a@example.com", "type":"codex" }`), ModTime: newer},
+		{ID: "gemini/new.json", Content: []byte(`{"type":"gemini","email":"n@example.com","token":{"access_token":"t"}}`), ModTime: newer},
+		{ID: "broken.json", Content: []byte(`{"type":"codex"}`), ModTime: newer},
+	}
+	if err := WriteDir(dir, source); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mode ConflictMode
+		want map[string]Action
+	}{
+		{ConflictSkip, map[string]Action{
+			"codex-a.json": ActionSkipped, "codex-b.json": ActionSkipped, "codex-same.json": ActionUnchanged,
+			"gemini/new.json": ActionCreated, "broken.json": ActionInvalid,
+		}},
+		{ConflictOverwrite, map[string]Action{
+			"codex-a.json": ActionUpdated, "codex-b.json": ActionUpdated, "codex-same.json": ActionUnchanged,
+			"gemini/new.json": ActionCreated, "broken.json": ActionInvalid,
+		}},
+		{ConflictNewerWins, map[string]Action{
+			"codex-a.json": ActionUpdated, "codex-b.json": ActionSkipped, "codex-same.json": ActionUnchanged,
+			"gemini/new.json": ActionCreated, "broken.json": ActionInvalid,
+		}},
+	}
+	for _, tt := range tests {
+		for _, batch := range []bool{false, true} {
+			name := string(tt.mode)
+			if batch {
+				name += "/batch"
+			}
+			t.Run(name, func(t *testing.T) {
+				// The stored copies sit between the two imported modification times.
+				at := older.Add(30 * time.Minute)
+				mem := newMemoryStore(
+					File{ID: "codex-a.json", Content: []byte(stored), ModTime: at},
+					File{ID: "codex-b.json", Content: []byte(stored), ModTime: at},
+					File{ID: "codex-same.json", Content: []byte(stored), ModTime: at},
+				)
+				var st Store = mem
+				if batch {
+					st = batchStore{mem}
+				}
+				summary, err := Import(context.Background(), st, files, ImportOptions{Conflict: tt.mode})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(summary.Results) != len(tt.want) {
+					t.Fatalf("results = %+v, want %d", summary.Results, len(tt.want))
+				}
+				for _, res := range summary.Results {
+					if res.Action != tt.want[res.ID] {
+						t.Errorf("%s: action = %s (%s), want %s", res.ID, res.Action, res.Reason, tt.want[res.ID])
+					}
+					content := string(mem.files[res.ID].Content)
+					switch res.Action {
+					case ActionCreated, ActionUpdated:
+						if content == stored || content == "" {
+							t.Errorf("%s: store not written", res.ID)
+						}
+					case ActionSkipped, ActionUnchanged:
+						if content != stored {
+							t.Errorf("%s: store changed to %s", res.ID, content)
+						}
+					}
+				}
+				if !summary.Failed() {
+					t.Fatalf("Failed() = false, want true for the invalid file")
+				}
+			})
+		}
+	}
+}
+
+func TestImportDryRunWritesNothing(t *testing.T) {
+	mem := newMemoryStore()
+	files := []File{{ID: "codex-a.json", Content: []byte(`{"type":"codex","email":"a@example.com","access_token":"at"}`)}}
+	summary, err := Import(context.Background(), mem, files, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Counts[ActionCreated] != 1 || mem.puts != 0 {
+		t.Fatalf("summary %s with %d write(s), want 1 created and no writes", summary, mem.puts)
+	}
+}
+
+func TestImportReportsWriteFailures(t *testing.T) {
+	files := []File{
+		{ID: "codex-a.json", Content: []byte(`{"type":"codex","email":"a@example.com","access_token":"at"}`)},
+		{ID: "codex-b.json", Content: []byte(`{"type":"codex","email":"b@example.com","access_token":"bt"}`)},
+	}
+	for _, batch := range []bool{false, true} {
+		mem := newMemoryStore()
+		mem.failPut = errors.New("store down")
+		var st Store = mem
+		if batch {
+			st = batchStore{mem}
+		}
+		summary, err := Import(context.Background(), st, files, ImportOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Counts[ActionFailed] != 2 || summary.Counts[ActionCreated] != 0 || !summary.Failed() {
+			t.Fatalf("batch=%v: summary %s, want 2 failed", batch, summary)
+		}
+		for _, res := range summary.Results {
+			if res.Reason != "store down" {
+				t.Errorf("batch=%v: %s reason = %q, want the store error", batch, res.ID, res.Reason)
+			}
+		}
+	}
+}
+
+func TestPathRejectsEscapes(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"", ".", "..", "../x.json", "a/../../x.json", "/etc/x.json", `a\..\x.json`} {
+		if p, err := Path(dir, id); err == nil {
+			t.Errorf("Path(%q) = %s, want an error", id, p)
+		}
+	}
+	if p, err := Path(dir, "gemini/a.json"); err != nil || p != filepath.Join(dir, "gemini", "a.json") {
+		t.Fatalf("Path(gemini/a.json) = %s, %v", p, err)
+	}
+}
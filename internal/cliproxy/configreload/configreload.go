@@ -0,0 +1,323 @@
+// Package configreload watches cliproxy.yaml, validates edits and only then
+// hands them to the embedded CLIProxy.
+//
+// CLIProxy loads and watches a staged copy of the configuration rather than
+// the file users edit. The reloader renders (or copies) the source on every
+// check and writes the staged copy only when the result is valid, so a broken
+// edit never reaches CLIProxy, not even briefly. Edits CLIProxy makes to the
+// staged copy through its management API are written back to the source when
+// the source is used verbatim.
+package configreload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	cliproxysdk "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/authdir"
+	"helixrun-cliproxy-starter/internal/cliproxy/events"
+)
+
+const defaultInterval = 2 * time.Second
+
+// Options tunes the reloader.
+type Options struct {
+	// Interval between file checks; defaults to two seconds.
+	Interval time.Duration
+	// SkipAuthDirCheck disables auth-dir validation, e.g. when the Postgres
+	// store mirrors auth files into its own directory.
+	SkipAuthDirCheck bool
+	// Render produces the effective configuration from the source, e.g. by
+	// resolving templates and profiles; when nil the source is used verbatim.
+	Render func() ([]byte, error)
+	// Events receives a config.reload_failed event for every rejected version.
+	Events *events.Bus
+}
+
+// Status reports the outcome of the most recent reload attempts.
+type Status struct {
+	Path        string    `json:"path"`
+	Staged      string    `json:"staged"`
+	Hash        string    `json:"hash"`
+	LoadedAt    time.Time `json:"loaded_at"`
+	LastCheck   time.Time `json:"last_check,omitempty"`
+	Applied     int       `json:"applied"`
+	RolledBack  int       `json:"rolled_back"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+	Problems    []string  `json:"problems,omitempty"`
+}
+
+// Reloader polls the source configuration and stages valid versions.
+type Reloader struct {
+	source string
+	staged string
+	opts   Options
+
+	mu      sync.Mutex
+	running *cliproxysdk.Config
+	// lastGood is the content of the staged copy as last written or adopted.
+	lastGood []byte
+	rejected string
+	status   Status
+}
+
+// New creates a reloader that validates source and writes valid versions to
+// staged, the file CLIProxy watches. running is the configuration the service
+// was started with; the current staged content becomes the first good version.
+func New(source, staged string, running *cliproxysdk.Config, opts Options) (*Reloader, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if source == staged {
+		return nil, fmt.Errorf("config reload: %s must not be watched by CLIProxy directly", source)
+	}
+	data, err := os.ReadFile(staged)
+	if err != nil {
+		return nil, fmt.Errorf("config reload: read %s: %w", staged, err)
+	}
+	now := time.Now()
+	return &Reloader{
+		source:   source,
+		staged:   staged,
+		opts:     opts,
+		running:  running,
+		lastGood: data,
+		status:   Status{Path: source, Staged: staged, Hash: hashOf(data), LoadedAt: now},
+	}, nil
+}
+
+// Status returns a snapshot of the reload state.
+func (r *Reloader) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.status
+	st.Problems = append([]string(nil), r.status.Problems...)
+	return st
+}
+
+// Run checks the file periodically until ctx is cancelled.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Check(); err != nil {
+				log.Printf("config reload: %v", err)
+			}
+		}
+	}
+}
+
+// Check compares the source configuration with the last good version. A
+// change is validated; valid changes are written to the staged copy, invalid
+// ones are saved next to the source as <name>.rejected and CLIProxy keeps
+// running the last good version.
+func (r *Reloader) Check() (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.LastCheck = time.Now()
+
+	if err := r.adoptStagedEdits(); err != nil {
+		return r.status, err
+	}
+	data, problems, err := r.current()
+	if err != nil {
+		r.fail(err.Error(), nil)
+		return r.status, err
+	}
+	key := strings.Join(problems, "; ")
+	if problems == nil {
+		key = hashOf(data)
+		if key == r.status.Hash {
+			return r.status, nil
+		}
+		problems = ValidateBytes(data, r.running, r.authDirBase())
+	}
+	if len(problems) == 0 {
+		// Write in place rather than rename so the CLIProxy file watcher keeps its watch.
+		if errWrite := os.WriteFile(r.staged, data, 0o600); errWrite != nil {
+			return r.status, fmt.Errorf("write staged config: %w", errWrite)
+		}
+		r.lastGood = data
+		r.rejected = ""
+		r.status.Hash = key
+		r.status.LoadedAt = time.Now()
+		r.status.Applied++
+		r.status.LastError = ""
+		r.status.Problems = nil
+		log.Printf("config reload: accepted %s (%s)", r.source, key[:12])
+		return r.status, nil
+	}
+
+	msg := strings.Join(problems, "; ")
+	if key == r.rejected {
+		// The source stays broken until someone fixes it; report once.
+		return r.status, fmt.Errorf("rejected invalid configuration: %s", msg)
+	}
+	r.rejected = key
+	r.fail("rejected invalid configuration", problems)
+	if data != nil {
+		if errSave := os.WriteFile(r.source+".rejected", data, 0o600); errSave != nil {
+			log.Printf("config reload: save rejected copy: %v", errSave)
+		}
+	}
+	r.status.RolledBack++
+	log.Printf("config reload: rejected %s, kept last good version: %s", r.source, msg)
+	r.opts.Events.Publish(events.Event{
+		Type:     events.TypeConfigReloadFailed,
+		Severity: events.SeverityWarning,
+		Subject:  r.source,
+		Message:  "rejected invalid configuration, kept last good version: " + msg,
+		Data:     map[string]any{"problems": problems, "rejected_copy": r.source + ".rejected"},
+	})
+	return r.status, fmt.Errorf("rejected invalid configuration: %s", msg)
+}
+
+// adoptStagedEdits picks up changes CLIProxy wrote to the staged copy, e.g.
+// through its management API. They are already live. When the source is used
+// verbatim (it still equals the last good version) they are written back to
+// it; rendered sources keep winning on their next change.
+func (r *Reloader) adoptStagedEdits() error {
+	staged, err := os.ReadFile(r.staged)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read %s: %w", r.staged, err)
+	}
+	if bytes.Equal(staged, r.lastGood) || len(bytes.TrimSpace(staged)) == 0 {
+		return nil
+	}
+	source, err := os.ReadFile(r.source)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", r.source, err)
+	}
+	if bytes.Equal(source, r.lastGood) {
+		if err = os.WriteFile(r.source, staged, 0o600); err != nil {
+			return fmt.Errorf("write back %s: %w", r.source, err)
+		}
+		r.status.Hash = hashOf(staged)
+		log.Printf("config reload: wrote CLIProxy edit of %s back to %s", r.staged, r.source)
+	}
+	r.lastGood = staged
+	return nil
+}
+
+// current returns the candidate configuration. Render failures are reported as
+// problems so they are rejected like invalid edits.
+func (r *Reloader) current() ([]byte, []string, error) {
+	if r.opts.Render != nil {
+		data, err := r.opts.Render()
+		if err != nil {
+			return nil, []string{err.Error()}, nil
+		}
+		return data, nil, nil
+	}
+	data, err := os.ReadFile(r.source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s: %w", r.source, err)
+	}
+	return data, nil, nil
+}
+
+// authDirBase is the directory relative auth-dir values resolve against, or ""
+// when auth-dir checks are disabled.
+func (r *Reloader) authDirBase() string {
+	if r.opts.SkipAuthDirCheck {
+		return ""
+	}
+	return filepath.Dir(r.source)
+}
+
+func (r *Reloader) fail(msg string, problems []string) {
+	r.status.LastError = msg
+	r.status.LastErrorAt = time.Now()
+	r.status.Problems = problems
+}
+
+// ValidateBytes parses data as a CLIProxy configuration and validates it.
+func ValidateBytes(data []byte, running *cliproxysdk.Config, authDirBase string) []string {
+	tmp, err := os.CreateTemp("", "cliproxy-*.yaml")
+	if err != nil {
+		return []string{fmt.Sprintf("create temp file: %v", err)}
+	}
+	defer os.Remove(tmp.Name())
+	_, errWrite := tmp.Write(data)
+	errClose := tmp.Close()
+	if err = errors.Join(errWrite, errClose); err != nil {
+		return []string{fmt.Sprintf("write temp file: %v", err)}
+	}
+	cfg, err := cliproxysdk.LoadConfig(tmp.Name())
+	if err != nil {
+		return []string{fmt.Sprintf("parse: %v", err)}
+	}
+	return Validate(cfg, running, authDirBase)
+}
+
+// Validate reports problems that make cfg unsafe to apply to a service started
+// with running. A nil running config skips the restart-only checks. auth-dir is
+// resolved against authDirBase (the config file's directory); "" skips it.
+func Validate(cfg, running *cliproxysdk.Config, authDirBase string) []string {
+	var problems []string
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port %d is out of range", cfg.Port))
+	}
+	if running != nil {
+		if cfg.Port != running.Port {
+			problems = append(problems, fmt.Sprintf("port change %d -> %d requires a restart", running.Port, cfg.Port))
+		}
+		if cfg.Host != running.Host {
+			problems = append(problems, fmt.Sprintf("host change %q -> %q requires a restart", running.Host, cfg.Host))
+		}
+	}
+
+	if authDirBase != "" {
+		if dir, err := authdir.Resolve(cfg.AuthDir, authDirBase); err != nil {
+			problems = append(problems, err.Error())
+		} else if info, errStat := os.Stat(dir); errStat != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("auth-dir %q does not exist", cfg.AuthDir))
+		} else if running != nil && running.AuthDir != "" && dir != running.AuthDir {
+			problems = append(problems, fmt.Sprintf("auth-dir change %s -> %s requires a restart", running.AuthDir, dir))
+		}
+	}
+
+	seen := make(map[string]struct{}, len(cfg.APIKeys))
+	for i, key := range cfg.APIKeys {
+		switch {
+		case strings.TrimSpace(key) == "":
+			problems = append(problems, fmt.Sprintf("api-keys[%d] is empty", i))
+		case strings.TrimSpace(key) != key:
+			problems = append(problems, fmt.Sprintf("api-keys[%d] has surrounding whitespace", i))
+		default:
+			if _, dup := seen[key]; dup {
+				problems = append(problems, fmt.Sprintf("api-keys[%d] is a duplicate", i))
+			}
+			seen[key] = struct{}{}
+		}
+	}
+
+	if cfg.RemoteManagement.AllowRemote && strings.TrimSpace(cfg.RemoteManagement.SecretKey) == "" {
+		problems = append(problems, "remote-management.allow-remote requires remote-management.secret-key")
+	}
+	return problems
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
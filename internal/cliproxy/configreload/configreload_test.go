@@ -0,0 +1,140 @@
+package configreload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cliproxysdk "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy"
+)
+
+const goodConfig = "port: 8317\napi-keys:\n  - key-a\n"
+
+// newTestReloader stages goodConfig the way Start does and returns a reloader
+// for it together with the source and staged paths.
+func newTestReloader(t *testing.T) (*Reloader, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	source := filepath.Join(dir, "cliproxy.yaml")
+	staged := filepath.Join(dir, ".cliproxy.rendered.yaml")
+	writeFile(t, source, goodConfig)
+	writeFile(t, staged, goodConfig)
+	running, err := cliproxysdk.LoadConfig(staged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(source, staged, running, Options{SkipAuthDirCheck: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, source, staged
+}
+
+func TestCheckKeepsInvalidEditAwayFromCLIProxy(t *testing.T) {
+	r, source, staged := newTestReloader(t)
+
+	bad := "port: 9000\napi-keys:\n  - key-a\n  - key-a\n"
+	writeFile(t, source, bad)
+	st, err := r.Check()
+	if err == nil {
+		t.Fatal("Check accepted an invalid edit")
+	}
+	if st.RolledBack != 1 || len(st.Problems) != 2 {
+		t.Fatalf("status = %+v, want one rejection with two problems", st)
+	}
+	if got := readFile(t, staged); got != goodConfig {
+		t.Fatalf("staged copy = %q, want the last good version", got)
+	}
+	if got := readFile(t, source+".rejected"); got != bad {
+		t.Fatalf("rejected copy = %q, want %q", got, bad)
+	}
+	if got := readFile(t, source); got != bad {
+		t.Fatalf("source = %q; the user's edit must be left for them to fix", got)
+	}
+
+	// The same broken source is reported but not counted again.
+	if st, err = r.Check(); err == nil || st.RolledBack != 1 {
+		t.Fatalf("second Check = %+v, %v", st, err)
+	}
+
+	good := "port: 8317\napi-keys:\n  - key-b\n"
+	writeFile(t, source, good)
+	if st, err = r.Check(); err != nil {
+		t.Fatalf("Check valid edit: %v", err)
+	}
+	if st.Applied != 1 || st.LastError != "" {
+		t.Fatalf("status = %+v, want one applied edit and no error", st)
+	}
+	if got := readFile(t, staged); got != good {
+		t.Fatalf("staged copy = %q, want %q", got, good)
+	}
+}
+
+func TestCheckWritesManagementEditsBack(t *testing.T) {
+	r, source, staged := newTestReloader(t)
+
+	edited := "port: 8317\napi-keys:\n  - key-a\n  - key-c\n"
+	writeFile(t, staged, edited)
+	st, err := r.Check()
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if got := readFile(t, source); got != edited {
+		t.Fatalf("source = %q, want the management API edit %q", got, edited)
+	}
+	if got := readFile(t, staged); got != edited {
+		t.Fatalf("staged copy = %q, want %q", got, edited)
+	}
+	if st.Applied != 0 {
+		t.Fatalf("Applied = %d; an adopted edit is already live", st.Applied)
+	}
+}
+
+func TestCheckKeepsManagementEditsOfRenderedConfig(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "cliproxy.yaml")
+	staged := filepath.Join(dir, ".cliproxy.rendered.yaml")
+	writeFile(t, source, "port: ${PORT}\napi-keys:\n  - key-a\n")
+	writeFile(t, staged, goodConfig)
+	render := func() ([]byte, error) { return []byte(goodConfig), nil }
+	r, err := New(source, staged, nil, Options{SkipAuthDirCheck: true, Render: render})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := "port: 8317\napi-keys:\n  - key-c\n"
+	writeFile(t, staged, edited)
+	if _, err = r.Check(); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if got := readFile(t, staged); got != edited {
+		t.Fatalf("staged copy = %q; the edit must survive until the sources change", got)
+	}
+	if got := readFile(t, source); got != "port: ${PORT}\napi-keys:\n  - key-a\n" {
+		t.Fatalf("template source was overwritten: %q", got)
+	}
+}
+
+func TestNewRejectsWatchedSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cliproxy.yaml")
+	writeFile(t, path, goodConfig)
+	if _, err := New(path, path, nil, Options{}); err == nil {
+		t.Fatal("New accepted a source CLIProxy watches directly")
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,265 @@
+// Package configrender preprocesses cliproxy.yaml before CLIProxy loads it.
+//
+// It merges an optional profile overlay (cliproxy.<profile>.yaml next to the
+// base file) over the base document and resolves references in scalar values:
+//
+//	${NAME}          value of environment variable NAME (an error when unset)
+//	${NAME:-default} value of NAME, or default when unset or empty
+//	${file:/path}    contents of a file, without the trailing newline
+//	$${...}          a literal "${...}"
+//
+// Relative ${file:...} paths are resolved against the base file's directory.
+package configrender
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OverlayPath returns the overlay file for profile, e.g. config/cliproxy.prod.yaml.
+func OverlayPath(base, profile string) string {
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + profile + ext
+}
+
+// RenderedPath returns where the effective configuration is written.
+func RenderedPath(base string) string {
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(filepath.Base(base), ext)
+	return filepath.Join(filepath.Dir(base), "."+name+".rendered"+ext)
+}
+
+// NeedsRender reports whether base must be preprocessed: a profile is selected
+// or the file contains references.
+func NeedsRender(base, profile string) (bool, error) {
+	if profile != "" {
+		return true, nil
+	}
+	data, err := os.ReadFile(base)
+	if err != nil {
+		return false, fmt.Errorf("config render: read %s: %w", base, err)
+	}
+	return bytes.Contains(data, []byte("${")), nil
+}
+
+// Prepare renders base into RenderedPath when needed and returns the path CLIProxy should load.
+func Prepare(base, profile string) (string, error) {
+	needed, err := NeedsRender(base, profile)
+	if err != nil || !needed {
+		return base, err
+	}
+	return Stage(base, profile)
+}
+
+// Stage writes the effective configuration to RenderedPath even when nothing
+// needs rendering, so CLIProxy can watch a copy that only changes once an edit
+// to base has been validated. It returns the staged path.
+func Stage(base, profile string) (string, error) {
+	data, err := Effective(base, profile)
+	if err != nil {
+		return "", err
+	}
+	target := RenderedPath(base)
+	// The output holds resolved secrets, so keep it private to the owner.
+	if err = os.WriteFile(target, data, 0o600); err != nil {
+		return "", fmt.Errorf("config render: write %s: %w", target, err)
+	}
+	return target, nil
+}
+
+// Effective returns the configuration CLIProxy should run: the rendered
+// document when base needs rendering, otherwise base verbatim.
+func Effective(base, profile string) ([]byte, error) {
+	needed, err := NeedsRender(base, profile)
+	if err != nil {
+		return nil, err
+	}
+	if needed {
+		return Render(base, profile)
+	}
+	data, err := os.ReadFile(base)
+	if err != nil {
+		return nil, fmt.Errorf("config render: read %s: %w", base, err)
+	}
+	return data, nil
+}
+
+// Render merges the profile overlay over base and resolves references.
+func Render(base, profile string) ([]byte, error) {
+	data, err := os.ReadFile(base)
+	if err != nil {
+		return nil, fmt.Errorf("config render: read %s: %w", base, err)
+	}
+	return RenderBytes(data, base, profile)
+}
+
+// RenderBytes renders data as if it were the content of the file at base.
+func RenderBytes(data []byte, base, profile string) ([]byte, error) {
+	doc, err := parseDocument(data, base)
+	if err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		overlayPath := OverlayPath(base, profile)
+		overlay, errOverlay := readDocument(overlayPath)
+		if errOverlay != nil {
+			return nil, errOverlay
+		}
+		merge(doc, overlay)
+	}
+	r := resolver{dir: filepath.Dir(base)}
+	r.walk(doc)
+	if len(r.errs) > 0 {
+		return nil, fmt.Errorf("config render: %s", strings.Join(r.errs, "; "))
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err = enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("config render: encode: %w", err)
+	}
+	if err = enc.Close(); err != nil {
+		return nil, fmt.Errorf("config render: encode: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func readDocument(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config render: read %s: %w", path, err)
+	}
+	return parseDocument(data, path)
+}
+
+func parseDocument(data []byte, path string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("config render: parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	return &doc, nil
+}
+
+// merge overlays src onto dst: mappings merge key by key, everything else
+// (scalars and sequences) is replaced.
+func merge(dst, src *yaml.Node) {
+	if dst.Kind == yaml.DocumentNode && src.Kind == yaml.DocumentNode {
+		merge(dst.Content[0], src.Content[0])
+		return
+	}
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		*dst = *src
+		return
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value == key.Value {
+				merge(dst.Content[j+1], value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
+
+type resolver struct {
+	dir  string
+	errs []string
+}
+
+func (r *resolver) walk(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		// Only values are resolved; keys are left alone.
+		for i := 1; i < len(n.Content); i += 2 {
+			r.walk(n.Content[i])
+		}
+		return
+	}
+	for _, child := range n.Content {
+		r.walk(child)
+	}
+	if n.Kind != yaml.ScalarNode || !strings.Contains(n.Value, "${") {
+		return
+	}
+	value, err := r.expand(n.Value)
+	if err != nil {
+		r.errs = append(r.errs, fmt.Sprintf("line %d: %v", n.Line, err))
+		return
+	}
+	n.Value = value
+	// Unquoted values are re-typed after substitution so "port: ${PORT}" stays an integer.
+	if n.Style == 0 {
+		n.Tag = ""
+	}
+}
+
+func (r *resolver) expand(s string) (string, error) {
+	var out strings.Builder
+	for {
+		idx := strings.Index(s, "${")
+		if idx == -1 {
+			out.WriteString(s)
+			return out.String(), nil
+		}
+		if idx > 0 && s[idx-1] == '$' {
+			// "$${" escapes a literal "${".
+			out.WriteString(s[:idx-1])
+			out.WriteString("${")
+			s = s[idx+2:]
+			continue
+		}
+		end := strings.Index(s[idx:], "}")
+		if end == -1 {
+			return "", fmt.Errorf("unterminated reference in %q", s)
+		}
+		out.WriteString(s[:idx])
+		value, err := r.lookup(s[idx+2 : idx+end])
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(value)
+		s = s[idx+end+1:]
+	}
+}
+
+func (r *resolver) lookup(ref string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		path = strings.TrimSpace(path)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	name, def, hasDefault := strings.Cut(ref, ":-")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("empty reference")
+	}
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	if hasDefault {
+		return def, nil
+	}
+	if _, set := os.LookupEnv(name); set {
+		return "", nil
+	}
+	return "", fmt.Errorf("environment variable %s is not set", name)
+}
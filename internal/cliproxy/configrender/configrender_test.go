@@ -0,0 +1,48 @@
+package configrender
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStage(t *testing.T) {
+	t.Setenv("CONFIGRENDER_TEST_PORT", "8317")
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"verbatim without references", "# comment kept\nport: 8317\n", "# comment kept\nport: 8317\n"},
+		{"rendered with references", "port: ${CONFIGRENDER_TEST_PORT}\n", "port: 8317\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := filepath.Join(t.TempDir(), "cliproxy.yaml")
+			if err := os.WriteFile(base, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			path, err := Stage(base, "")
+			if err != nil {
+				t.Fatalf("Stage: %v", err)
+			}
+			if path != RenderedPath(base) {
+				t.Fatalf("Stage = %s, want %s", path, RenderedPath(base))
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("staged = %q, want %q", got, tt.want)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != 0o600 {
+				t.Fatalf("mode = %o, want 600", perm)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+// Package configsync mirrors the versioned cliproxy.yaml kept in Postgres to
+// the local config file and propagates new versions to every replica.
+package configsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	cliproxysdk "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/configreload"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+const defaultInterval = 10 * time.Second
+
+// ValidationError lists the problems that prevented a config from being stored.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Store keeps the config versions; *store.PostgresConfigStore implements it.
+type Store interface {
+	Latest(ctx context.Context) (*store.ConfigVersion, error)
+	LatestVersion(ctx context.Context) (int64, error)
+	Get(ctx context.Context, version int64) (*store.ConfigVersion, error)
+	List(ctx context.Context, limit int) ([]store.ConfigVersion, error)
+	Put(ctx context.Context, content, author, comment string, baseVersion int64) (*store.ConfigVersion, error)
+}
+
+// Options tunes the syncer.
+type Options struct {
+	// Interval between checks for versions written by other replicas; defaults to ten seconds.
+	Interval time.Duration
+	// SkipAuthDirCheck disables auth-dir validation (the Postgres token store mirrors auths elsewhere).
+	SkipAuthDirCheck bool
+	// Render turns stored content into the effective configuration for validation
+	// when the file is a template; nil validates the content as is.
+	Render func(content []byte) ([]byte, error)
+}
+
+// Syncer keeps the local config file in step with the newest stored version.
+type Syncer struct {
+	store Store
+	path  string
+	opts  Options
+
+	mu      sync.Mutex
+	running *cliproxysdk.Config
+	applied int64
+}
+
+// New creates a syncer that mirrors st into path.
+func New(st Store, path string, opts Options) *Syncer {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	return &Syncer{store: st, path: path, opts: opts}
+}
+
+// Bootstrap seeds an empty table from the local file, or writes the newest
+// stored version to the local file, and returns the mirrored version.
+func (s *Syncer) Bootstrap(ctx context.Context) (*store.ConfigVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest, err := s.store.Latest(ctx)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		data, errRead := os.ReadFile(s.path)
+		if errRead != nil {
+			return nil, fmt.Errorf("config sync: read %s: %w", s.path, errRead)
+		}
+		if latest, err = s.store.Put(ctx, string(data), "bootstrap", "imported from "+filepath.Base(s.path), 0); err != nil {
+			return nil, err
+		}
+		log.Printf("config sync: seeded config_store with %s as version %d", s.path, latest.Version)
+	case err != nil:
+		return nil, err
+	default:
+		if errWrite := s.writeLocal(latest); errWrite != nil {
+			return nil, errWrite
+		}
+	}
+	s.applied = latest.Version
+
+	return latest, nil
+}
+
+// SetRunning records the configuration the service runs with, used to reject
+// edits that need a restart.
+func (s *Syncer) SetRunning(cfg *cliproxysdk.Config) {
+	s.mu.Lock()
+	s.running = cfg
+	s.mu.Unlock()
+}
+
+// Run polls for versions written by other replicas until ctx is cancelled.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.pull(ctx); err != nil {
+				log.Printf("config sync: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Syncer) pull(ctx context.Context) error {
+	version, err := s.store.LatestVersion(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version <= s.applied {
+		return nil
+	}
+	latest, err := s.store.Latest(ctx)
+	if err != nil {
+		return err
+	}
+	if err = s.writeLocal(latest); err != nil {
+		return err
+	}
+	s.applied = latest.Version
+	log.Printf("config sync: applied version %d", latest.Version)
+	return nil
+}
+
+// Applied returns the version currently mirrored to the local file.
+func (s *Syncer) Applied() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applied
+}
+
+// Versions lists stored versions newest first.
+func (s *Syncer) Versions(ctx context.Context, limit int) ([]store.ConfigVersion, error) {
+	return s.store.List(ctx, limit)
+}
+
+// Version returns a stored version including its content.
+func (s *Syncer) Version(ctx context.Context, version int64) (*store.ConfigVersion, error) {
+	return s.store.Get(ctx, version)
+}
+
+// Apply validates content, stores it as a new version and mirrors it locally.
+// A non-zero baseVersion guards against overwriting a concurrent edit.
+func (s *Syncer) Apply(ctx context.Context, content, author, comment string, baseVersion int64) (*store.ConfigVersion, error) {
+	if problems := s.validate(content); len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	v, err := s.store.Put(ctx, content, author, comment, baseVersion)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v.Version > s.applied {
+		if err = s.writeLocal(v); err != nil {
+			return v, err
+		}
+		s.applied = v.Version
+	}
+	return v, nil
+}
+
+// Rollback stores the content of an earlier version as a new version.
+func (s *Syncer) Rollback(ctx context.Context, version int64, author string) (*store.ConfigVersion, error) {
+	old, err := s.store.Get(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.Apply(ctx, old.Content, author, fmt.Sprintf("rollback to version %d", version), 0)
+}
+
+// Diff renders a unified diff between two stored versions.
+func (s *Syncer) Diff(ctx context.Context, from, to int64) (string, error) {
+	a, err := s.store.Get(ctx, from)
+	if err != nil {
+		return "", err
+	}
+	b, err := s.store.Get(ctx, to)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(fmt.Sprintf("version %d", from), fmt.Sprintf("version %d", to), a.Content, b.Content), nil
+}
+
+func (s *Syncer) validate(content string) []string {
+	data := []byte(content)
+	if s.opts.Render != nil {
+		rendered, err := s.opts.Render(data)
+		if err != nil {
+			return []string{err.Error()}
+		}
+		data = rendered
+	}
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+	authDirBase := ""
+	if !s.opts.SkipAuthDirCheck {
+		authDirBase = filepath.Dir(s.path)
+	}
+	return configreload.ValidateBytes(data, running, authDirBase)
+}
+
+// writeLocal updates the file in place (no rename) so the CLIProxy watcher keeps its watch.
+func (s *Syncer) writeLocal(v *store.ConfigVersion) error {
+	if current, err := os.ReadFile(s.path); err == nil && store.ConfigHash(string(current)) == v.Hash {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("config sync: create config directory: %w", err)
+	}
+	if err := os.WriteFile(s.path, []byte(v.Content), 0o600); err != nil {
+		return fmt.Errorf("config sync: write %s: %w", s.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package configsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// memoryStore is an in-process Store with the conflict and de-duplication
+// rules of PostgresConfigStore.Put.
+type memoryStore struct {
+	mu       sync.Mutex
+	versions []store.ConfigVersion
+}
+
+func (m *memoryStore) Latest(context.Context) (*store.ConfigVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.versions) == 0 {
+		return nil, store.ErrNotFound
+	}
+	v := m.versions[len(m.versions)-1]
+	return &v, nil
+}
+
+func (m *memoryStore) LatestVersion(context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.versions)), nil
+}
+
+func (m *memoryStore) Get(_ context.Context, version int64) (*store.ConfigVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if version < 1 || version > int64(len(m.versions)) {
+		return nil, store.ErrNotFound
+	}
+	v := m.versions[version-1]
+	return &v, nil
+}
+
+func (m *memoryStore) List(context.Context, int) ([]store.ConfigVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]store.ConfigVersion, 0, len(m.versions))
+	for i := len(m.versions) - 1; i >= 0; i-- {
+		out = append(out, m.versions[i])
+	}
+	return out, nil
+}
+
+func (m *memoryStore) Put(_ context.Context, content, author, comment string, baseVersion int64) (*store.ConfigVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	latest := int64(len(m.versions))
+	if baseVersion != 0 && baseVersion != latest {
+		return nil, fmt.Errorf("memory config store: %w: base %d, latest %d", store.ErrVersionConflict, baseVersion, latest)
+	}
+	hash := store.ConfigHash(content)
+	if latest > 0 && m.versions[latest-1].Hash == hash {
+		v := m.versions[latest-1]
+		return &v, nil
+	}
+	v := store.ConfigVersion{Version: latest + 1, Hash: hash, Author: author, Comment: comment, Content: content, CreatedAt: time.Now()}
+	m.versions = append(m.versions, v)
+	return &v, nil
+}
+
+const (
+	configV1 = "port: 8317\n"
+	configV2 = "port: 8317\ndebug: true\n"
+	configV3 = "port: 8317\nrequest-retry: 2\n"
+)
+
+// newReplica returns a syncer over st mirroring to cliproxy.yaml in its own
+// directory, which starts out holding content.
+func newReplica(t *testing.T, st Store, content string) (*Syncer, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cliproxy.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return New(st, path, Options{SkipAuthDirCheck: true}), path
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBootstrap(t *testing.T) {
+	ctx := context.Background()
+	st := &memoryStore{}
+
+	// The first replica seeds the empty store from its file.
+	first, _ := newReplica(t, st, configV1)
+	v, err := first.Bootstrap(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 1 || v.Hash != store.ConfigHash(configV1) || v.Author != "bootstrap" || first.Applied() != 1 {
+		t.Fatalf("seeded version %+v, applied %d; want version 1 of the local file", v, first.Applied())
+	}
+
+	// Later replicas take the stored version over their own file.
+	second, path := newReplica(t, st, configV2)
+	if v, err = second.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 1 || second.Applied() != 1 || readFile(t, path) != configV1 {
+		t.Fatalf("bootstrap mirrored version %d (applied %d) as %q, want version 1", v.Version, second.Applied(), readFile(t, path))
+	}
+	if n, _ := st.LatestVersion(ctx); n != 1 {
+		t.Fatalf("store holds %d versions, want 1", n)
+	}
+}
+
+func TestApplyRejectsStaleBaseVersion(t *testing.T) {
+	ctx := context.Background()
+	st := &memoryStore{}
+	a, pathA := newReplica(t, st, configV1)
+	b, pathB := newReplica(t, st, configV1)
+	for _, s := range []*Syncer{a, b} {
+		if _, err := s.Bootstrap(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both replicas edit version 1; the second write loses.
+	v, err := a.Apply(ctx, configV2, "alice", "enable debug", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 2 || a.Applied() != 2 || readFile(t, pathA) != configV2 {
+		t.Fatalf("replica a: version %d, applied %d, file %q; want version 2 mirrored", v.Version, a.Applied(), readFile(t, pathA))
+	}
+	if _, err = b.Apply(ctx, configV3, "bob", "retry twice", 1); !errors.Is(err, store.ErrVersionConflict) {
+		t.Fatalf("stale Apply error = %v, want ErrVersionConflict", err)
+	}
+	if b.Applied() != 1 || readFile(t, pathB) != configV1 {
+		t.Fatalf("replica b after conflict: applied %d, file %q; want version 1 untouched", b.Applied(), readFile(t, pathB))
+	}
+
+	// The losing replica picks the winner up on its next poll.
+	if err = b.pull(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if b.Applied() != 2 || readFile(t, pathB) != configV2 {
+		t.Fatalf("replica b after pull: applied %d, file %q; want version 2", b.Applied(), readFile(t, pathB))
+	}
+
+	// A zero base version always writes.
+	if v, err = b.Apply(ctx, configV3, "bob", "retry twice", 0); err != nil || v.Version != 3 {
+		t.Fatalf("unguarded Apply = %+v, %v; want version 3", v, err)
+	}
+}
+
+func TestApplyIdenticalContentKeepsVersion(t *testing.T) {
+	ctx := context.Background()
+	st := &memoryStore{}
+	s, _ := newReplica(t, st, configV1)
+	if _, err := s.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.Apply(ctx, configV1, "alice", "no-op", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 1 || v.Author != "bootstrap" {
+		t.Fatalf("Apply of identical content = version %d by %s, want the existing version 1", v.Version, v.Author)
+	}
+	if n, _ := st.LatestVersion(ctx); n != 1 {
+		t.Fatalf("store holds %d versions, want 1", n)
+	}
+}
+
+func TestPullSkipsRewriteWhenHashMatches(t *testing.T) {
+	ctx := context.Background()
+	st := &memoryStore{}
+	a, _ := newReplica(t, st, configV1)
+	b, pathB := newReplica(t, st, configV1)
+	for _, s := range []*Syncer{a, b} {
+		if _, err := s.Bootstrap(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Replica b's file already holds what a is about to store.
+	if err := os.WriteFile(pathB, []byte(configV2), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(pathB, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Apply(ctx, configV2, "alice", "enable debug", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.pull(ctx); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(pathB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Applied() != 2 || !info.ModTime().Equal(old) {
+		t.Fatalf("pull: applied %d, modtime %s; want version 2 applied without rewriting the file", b.Applied(), info.ModTime())
+	}
+
+	// Nothing newer: pull leaves everything alone.
+	if err = b.pull(ctx); err != nil || b.Applied() != 2 {
+		t.Fatalf("second pull: applied %d, %v", b.Applied(), err)
+	}
+}
+
+func TestApplyRejectsInvalidConfig(t *testing.T) {
+	ctx := context.Background()
+	st := &memoryStore{}
+	s, path := newReplica(t, st, configV1)
+	if _, err := s.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.Apply(ctx, "port: 0\n", "alice", "", 1)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Problems) == 0 {
+		t.Fatalf("Apply error = %v, want a ValidationError", err)
+	}
+	if n, _ := st.LatestVersion(ctx); n != 1 || readFile(t, path) != configV1 {
+		t.Fatalf("invalid config stored (%d versions) or mirrored (%q)", n, readFile(t, path))
+	}
+}
+
+func TestRollbackStoresOldContentAsNewVersion(t *testing.T) {
+	ctx := context.Background()
+	st := &memoryStore{}
+	s, path := newReplica(t, st, configV1)
+	if _, err := s.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Apply(ctx, configV2, "alice", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.Rollback(ctx, 1, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 3 || v.Hash != store.ConfigHash(configV1) || readFile(t, path) != configV1 {
+		t.Fatalf("Rollback = version %d hash %s, file %q; want version 3 with version 1's content", v.Version, v.Hash, readFile(t, path))
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	got := unifiedDiff("version 1", "version 2", "port: 8317\nhost: \"\"\n", "port: 8317\nhost: 127.0.0.1\n")
+	want := "--- version 1\n+++ version 2\n@@ -1,2 +1,2 @@\n port: 8317\n-host: \"\"\n+host: 127.0.0.1\n"
+	if got != want {
+		t.Fatalf("unifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+	if got = unifiedDiff("a", "b", configV1, configV1); got != "--- a\n+++ b\n" {
+		t.Fatalf("unifiedDiff of identical content = %q, want headers only", got)
+	}
+}
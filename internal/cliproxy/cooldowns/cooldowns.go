@@ -0,0 +1,555 @@
+// Package cooldowns persists CLIProxy's per-credential cooldowns in Postgres.
+//
+// CLIProxy stops using a credential (or one of its models) for a while after
+// a 429, 401/403, 404 or 5xx, but keeps that state in memory only. The
+// Tracker records every cooldown the auth manager sets, applies cooldowns
+// recorded by other replicas or before a restart to the local manager, and
+// lifts a local cooldown once its row is cleared, so all replicas agree on
+// which credentials are resting and until when.
+package cooldowns
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	cliproxysdk "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/events"
+	"helixrun-cliproxy-starter/internal/redact"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	queueSize       = 1024
+	maxMessageLen   = 200
+	// tolerance absorbs timestamp rounding between replicas and Postgres.
+	tolerance = time.Second
+	// retention keeps expired rows around briefly for the admin view.
+	retention = time.Hour
+)
+
+// Cooldown reasons, derived from the upstream status code.
+const (
+	ReasonQuota           = "quota"
+	ReasonUnauthorized    = "unauthorized"
+	ReasonPaymentRequired = "payment_required"
+	ReasonNotFound        = "not_found"
+	ReasonUpstream        = "upstream"
+	ReasonError           = "error"
+)
+
+// Store persists cooldowns; *store.PostgresCooldownStore implements it.
+type Store interface {
+	Put(ctx context.Context, c store.Cooldown) error
+	Delete(ctx context.Context, authID, model string) (bool, error)
+	DeleteAll(ctx context.Context, authID string) (int64, error)
+	Active(ctx context.Context, now time.Time) ([]store.Cooldown, error)
+	Prune(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Config tunes the tracker.
+type Config struct {
+	// Interval is how often cooldowns recorded elsewhere are applied; zero uses 10s.
+	Interval time.Duration
+}
+
+type key struct {
+	authID string
+	model  string
+}
+
+// event is a manager callback handed from the request path to the worker.
+type event struct {
+	authID     string
+	model      string
+	success    bool
+	statusCode int
+	registered bool
+}
+
+// Tracker mirrors the auth manager's cooldowns to a Store and back.
+type Tracker struct {
+	store    Store
+	interval time.Duration
+	replica  string
+	queue    chan event
+
+	mu      sync.Mutex
+	manager *coreauth.Manager
+	bus     *events.Bus
+	// rows is the Store content as of the last sync, plus rows written since.
+	rows map[key]store.Cooldown
+}
+
+// New returns a Tracker over st. Attach the manager with SetManager and
+// install Hook on it.
+func New(st Store, cfg Config) *Tracker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	replica, _ := os.Hostname()
+	return &Tracker{
+		store:    st,
+		interval: cfg.Interval,
+		replica:  replica,
+		queue:    make(chan event, queueSize),
+		rows:     make(map[key]store.Cooldown),
+	}
+}
+
+// SetManager attaches the auth manager whose cooldowns are tracked.
+func (t *Tracker) SetManager(manager *coreauth.Manager) {
+	t.mu.Lock()
+	t.manager = manager
+	t.mu.Unlock()
+}
+
+// SetEvents publishes a quota exhaustion event on bus whenever a credential
+// starts a quota cooldown.
+func (t *Tracker) SetEvents(bus *events.Bus) {
+	t.mu.Lock()
+	t.bus = bus
+	t.mu.Unlock()
+}
+
+// Hook returns the auth manager hook that reports results and newly loaded
+// credentials to the tracker. It never blocks the request path; events are
+// dropped when the queue is full.
+func (t *Tracker) Hook() coreauth.Hook {
+	return trackerHook{t}
+}
+
+type trackerHook struct {
+	t *Tracker
+}
+
+func (h trackerHook) OnAuthRegistered(_ context.Context, auth *coreauth.Auth) {
+	if auth != nil {
+		h.t.enqueue(event{authID: auth.ID, registered: true})
+	}
+}
+
+func (h trackerHook) OnAuthUpdated(context.Context, *coreauth.Auth) {}
+
+func (h trackerHook) OnResult(_ context.Context, result coreauth.Result) {
+	ev := event{authID: result.AuthID, model: result.Model, success: result.Success}
+	if result.Error != nil {
+		ev.statusCode = result.Error.StatusCode()
+	}
+	h.t.enqueue(ev)
+}
+
+func (t *Tracker) enqueue(ev event) {
+	select {
+	case t.queue <- ev:
+	default:
+		log.Printf("cooldowns: queue full, dropping update for %s", ev.authID)
+	}
+}
+
+// Run records manager events and syncs with the store every interval until
+// ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context) {
+	if err := t.Sync(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("cooldowns: sync: %v", err)
+	}
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-t.queue:
+			t.handle(ctx, ev)
+		case <-ticker.C:
+			if err := t.Sync(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("cooldowns: sync: %v", err)
+			}
+		}
+	}
+}
+
+// handle records the cooldown a result left behind, or removes the row of a
+// credential that works again.
+func (t *Tracker) handle(ctx context.Context, ev event) {
+	manager := t.currentManager()
+	if manager == nil || ev.authID == "" {
+		return
+	}
+	if ev.registered {
+		t.applyStored(ctx, manager, ev.authID)
+		return
+	}
+	k := key{authID: ev.authID, model: ev.model}
+	if ev.success {
+		t.mu.Lock()
+		_, known := t.rows[k]
+		delete(t.rows, k)
+		t.mu.Unlock()
+		if known {
+			if _, err := t.store.Delete(ctx, k.authID, k.model); err != nil {
+				log.Printf("cooldowns: clear %s: %v", k.authID, err)
+			}
+		}
+		return
+	}
+	auth, ok := manager.GetByID(ev.authID)
+	if !ok {
+		return
+	}
+	c, ok := cooldownOf(auth, ev.model, time.Now())
+	if !ok {
+		return
+	}
+	c.Reason, c.StatusCode, c.Replica = reasonFor(ev.statusCode), ev.statusCode, t.replica
+	c.Message = redact.Default().String(truncate(c.Message, maxMessageLen))
+	if err := t.store.Put(ctx, c); err != nil {
+		log.Printf("cooldowns: record %s: %v", ev.authID, err)
+		return
+	}
+	c.UpdatedAt = time.Now()
+	t.mu.Lock()
+	_, known := t.rows[k]
+	t.rows[k] = c
+	bus := t.bus
+	t.mu.Unlock()
+	if c.QuotaExceeded && !known {
+		bus.Publish(events.Event{
+			Type:     events.TypeCredentialQuotaExhausted,
+			Severity: events.SeverityWarning,
+			Subject:  c.AuthID,
+			Message:  fmt.Sprintf("%s quota exhausted until %s", orAll(c.Model), c.ResetAt.UTC().Format(time.RFC3339)),
+			Data:     map[string]any{"provider": auth.Provider, "model": c.Model, "reset_at": c.ResetAt, "backoff_level": c.BackoffLevel},
+		})
+	}
+}
+
+// Sync applies the stored cooldowns to the manager and lifts local cooldowns
+// whose rows were cleared since the last sync.
+func (t *Tracker) Sync(ctx context.Context) error {
+	now := time.Now()
+	active, err := t.store.Active(ctx, now)
+	if err != nil {
+		return err
+	}
+	if _, err = t.store.Prune(ctx, now.Add(-retention)); err != nil {
+		return err
+	}
+	rows := make(map[key]store.Cooldown, len(active))
+	for _, c := range active {
+		rows[key{authID: c.AuthID, model: c.Model}] = c
+	}
+	t.mu.Lock()
+	previous := t.rows
+	t.rows = rows
+	manager := t.manager
+	t.mu.Unlock()
+	if manager == nil {
+		return nil
+	}
+	for k, c := range rows {
+		if auth, ok := manager.GetByID(k.authID); ok {
+			t.apply(ctx, manager, auth, c)
+		}
+	}
+	for k, c := range previous {
+		if _, still := rows[k]; still || !c.ResetAt.After(now) {
+			continue
+		}
+		if auth, ok := manager.GetByID(k.authID); ok {
+			t.lift(ctx, manager, auth, k.model, c.ResetAt)
+		}
+	}
+	return nil
+}
+
+// Active returns the stored cooldowns that have not reset yet.
+func (t *Tracker) Active(ctx context.Context) ([]store.Cooldown, error) {
+	return t.store.Active(ctx, time.Now())
+}
+
+// Clear removes the cooldown of authID for model, or every cooldown of the
+// credential when model is empty, here and (on their next sync) on the other
+// replicas. It returns store.ErrNotFound when nothing was cooling down.
+func (t *Tracker) Clear(ctx context.Context, authID, model string) error {
+	var (
+		n   int64
+		err error
+	)
+	if model == "" {
+		n, err = t.store.DeleteAll(ctx, authID)
+	} else {
+		var found bool
+		if found, err = t.store.Delete(ctx, authID, model); found {
+			n = 1
+		}
+	}
+	if err != nil {
+		return err
+	}
+	cleared := false
+	if manager := t.currentManager(); manager != nil {
+		if auth, ok := manager.GetByID(authID); ok {
+			cleared = t.liftAll(ctx, manager, auth, model)
+		}
+	}
+	t.mu.Lock()
+	for k := range t.rows {
+		if k.authID == authID && (model == "" || k.model == model) {
+			delete(t.rows, k)
+		}
+	}
+	t.mu.Unlock()
+	if n == 0 && !cleared {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (t *Tracker) applyStored(ctx context.Context, manager *coreauth.Manager, authID string) {
+	t.mu.Lock()
+	var stored []store.Cooldown
+	for k, c := range t.rows {
+		if k.authID == authID {
+			stored = append(stored, c)
+		}
+	}
+	t.mu.Unlock()
+	for _, c := range stored {
+		if auth, ok := manager.GetByID(authID); ok {
+			t.apply(ctx, manager, auth, c)
+		}
+	}
+}
+
+// apply puts auth into the stored cooldown c unless it is already cooling
+// down at least as long.
+func (t *Tracker) apply(ctx context.Context, manager *coreauth.Manager, auth *coreauth.Auth, c store.Cooldown) {
+	now := time.Now()
+	if !c.ResetAt.After(now) {
+		return
+	}
+	if local, ok := cooldownOf(auth, c.Model, now); ok && !local.ResetAt.Before(c.ResetAt.Add(-tolerance)) {
+		return
+	}
+	message := c.Message
+	if message == "" {
+		message = c.Reason
+	}
+	quota := coreauth.QuotaState{}
+	if c.QuotaExceeded {
+		quota = coreauth.QuotaState{Exceeded: true, Reason: ReasonQuota, NextRecoverAt: c.ResetAt, BackoffLevel: c.BackoffLevel}
+	}
+	if c.Model != "" {
+		if auth.ModelStates == nil {
+			auth.ModelStates = make(map[string]*coreauth.ModelState)
+		}
+		state := auth.ModelStates[c.Model]
+		if state == nil {
+			state = &coreauth.ModelState{}
+			auth.ModelStates[c.Model] = state
+		}
+		state.Unavailable = true
+		state.Status = coreauth.StatusError
+		state.StatusMessage = message
+		state.NextRetryAfter = c.ResetAt
+		state.Quota = quota
+		state.UpdatedAt = now
+		aggregate(auth, now)
+	} else {
+		auth.Unavailable = true
+		auth.NextRetryAfter = c.ResetAt
+		auth.Quota = quota
+	}
+	auth.Status = coreauth.StatusError
+	auth.StatusMessage = message
+	auth.UpdatedAt = now
+	if _, err := manager.Update(ctx, auth); err != nil {
+		log.Printf("cooldowns: apply %s: %v", auth.ID, err)
+		return
+	}
+	if c.Model != "" {
+		registry := cliproxysdk.GlobalModelRegistry()
+		if c.QuotaExceeded {
+			registry.SetModelQuotaExceeded(auth.ID, c.Model)
+		}
+		if suspender, ok := registry.(modelSuspender); ok {
+			suspender.SuspendClientModel(auth.ID, c.Model, c.Reason)
+		}
+	}
+	log.Printf("cooldowns: %s %s cooling down until %s (%s, recorded by %s)", auth.ID, orAll(c.Model), c.ResetAt.Local().Format(time.DateTime), c.Reason, c.Replica)
+}
+
+// lift ends the local cooldown of auth for model if it is still the one that
+// was stored (reset at resetAt).
+func (t *Tracker) lift(ctx context.Context, manager *coreauth.Manager, auth *coreauth.Auth, model string, resetAt time.Time) {
+	local, ok := cooldownOf(auth, model, time.Now())
+	if !ok || local.ResetAt.Sub(resetAt).Abs() > tolerance {
+		return
+	}
+	t.liftAll(ctx, manager, auth, model)
+}
+
+// liftAll ends the local cooldowns of auth for model, or for the credential
+// and all of its models when model is empty. It reports whether any was set.
+func (t *Tracker) liftAll(ctx context.Context, manager *coreauth.Manager, auth *coreauth.Auth, model string) bool {
+	now := time.Now()
+	var models []string
+	if model != "" {
+		models = []string{model}
+	} else {
+		for m := range auth.ModelStates {
+			models = append(models, m)
+		}
+	}
+	changed := false
+	for _, m := range models {
+		if _, ok := cooldownOf(auth, m, now); !ok {
+			continue
+		}
+		state := auth.ModelStates[m]
+		state.Unavailable = false
+		state.Status = coreauth.StatusActive
+		state.StatusMessage = ""
+		state.NextRetryAfter = time.Time{}
+		state.LastError = nil
+		state.Quota = coreauth.QuotaState{}
+		state.UpdatedAt = now
+		changed = true
+		registry := cliproxysdk.GlobalModelRegistry()
+		registry.ClearModelQuotaExceeded(auth.ID, m)
+		if suspender, ok := registry.(modelSuspender); ok {
+			suspender.ResumeClientModel(auth.ID, m)
+		}
+	}
+	if changed {
+		aggregate(auth, now)
+	}
+	if model == "" && auth.Unavailable {
+		auth.Unavailable = false
+		auth.NextRetryAfter = time.Time{}
+		auth.Quota = coreauth.QuotaState{}
+		changed = true
+	}
+	if !changed {
+		return false
+	}
+	auth.Status = coreauth.StatusActive
+	auth.StatusMessage = ""
+	auth.LastError = nil
+	auth.UpdatedAt = now
+	if _, err := manager.Update(ctx, auth); err != nil {
+		log.Printf("cooldowns: lift %s: %v", auth.ID, err)
+		return false
+	}
+	log.Printf("cooldowns: %s %s cooldown lifted", auth.ID, orAll(model))
+	return true
+}
+
+func (t *Tracker) currentManager() *coreauth.Manager {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.manager
+}
+
+// modelSuspender is implemented by CLIProxy's model registry; suspended
+// models are hidden from the model list of that credential.
+type modelSuspender interface {
+	SuspendClientModel(clientID, modelID, reason string)
+	ResumeClientModel(clientID, modelID string)
+}
+
+// cooldownOf reports the cooldown auth is in for model ("" for the whole
+// credential) as of now.
+func cooldownOf(auth *coreauth.Auth, model string, now time.Time) (store.Cooldown, bool) {
+	c := store.Cooldown{AuthID: auth.ID, Model: model}
+	if model != "" {
+		state, ok := auth.ModelStates[model]
+		if !ok || state == nil || !state.Unavailable || !state.NextRetryAfter.After(now) {
+			return c, false
+		}
+		c.ResetAt, c.Message = state.NextRetryAfter, state.StatusMessage
+		c.QuotaExceeded, c.BackoffLevel = state.Quota.Exceeded, state.Quota.BackoffLevel
+		return c, true
+	}
+	if !auth.Unavailable || !auth.NextRetryAfter.After(now) {
+		return c, false
+	}
+	c.ResetAt, c.Message = auth.NextRetryAfter, auth.StatusMessage
+	c.QuotaExceeded, c.BackoffLevel = auth.Quota.Exceeded, auth.Quota.BackoffLevel
+	return c, true
+}
+
+// aggregate recomputes the credential-wide availability from its model
+// states the way the auth manager does after every result.
+func aggregate(auth *coreauth.Auth, now time.Time) {
+	if len(auth.ModelStates) == 0 {
+		return
+	}
+	allUnavailable := true
+	var earliest time.Time
+	quota := coreauth.QuotaState{}
+	for _, state := range auth.ModelStates {
+		if state == nil {
+			continue
+		}
+		unavailable := state.Status == coreauth.StatusDisabled ||
+			(state.Unavailable && (state.NextRetryAfter.IsZero() || state.NextRetryAfter.After(now)))
+		if unavailable && state.NextRetryAfter.After(now) && (earliest.IsZero() || state.NextRetryAfter.Before(earliest)) {
+			earliest = state.NextRetryAfter
+		}
+		if !unavailable {
+			allUnavailable = false
+		}
+		if state.Quota.Exceeded {
+			if !quota.Exceeded || (!state.Quota.NextRecoverAt.IsZero() && state.Quota.NextRecoverAt.Before(quota.NextRecoverAt)) {
+				quota.NextRecoverAt = state.Quota.NextRecoverAt
+			}
+			quota.Exceeded, quota.Reason = true, ReasonQuota
+			quota.BackoffLevel = max(quota.BackoffLevel, state.Quota.BackoffLevel)
+		}
+	}
+	auth.Unavailable = allUnavailable
+	auth.NextRetryAfter = time.Time{}
+	if allUnavailable {
+		auth.NextRetryAfter = earliest
+	}
+	auth.Quota = quota
+}
+
+func reasonFor(statusCode int) string {
+	switch statusCode {
+	case 429:
+		return ReasonQuota
+	case 401:
+		return ReasonUnauthorized
+	case 402, 403:
+		return ReasonPaymentRequired
+	case 404:
+		return ReasonNotFound
+	case 408, 500, 502, 503, 504:
+		return ReasonUpstream
+	default:
+		return ReasonError
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+func orAll(model string) string {
+	if model == "" {
+		return "(all models)"
+	}
+	return model
+}
@@ -0,0 +1,259 @@
+package cooldowns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// memoryStore is an in-process Store shared by the replicas of a test.
+type memoryStore struct {
+	mu   sync.Mutex
+	rows map[key]store.Cooldown
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{rows: make(map[key]store.Cooldown)}
+}
+
+func (m *memoryStore) Put(_ context.Context, c store.Cooldown) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.UpdatedAt = time.Now()
+	m.rows[key{authID: c.AuthID, model: c.Model}] = c
+	return nil
+}
+
+func (m *memoryStore) Delete(_ context.Context, authID, model string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key{authID: authID, model: model}
+	_, ok := m.rows[k]
+	delete(m.rows, k)
+	return ok, nil
+}
+
+func (m *memoryStore) DeleteAll(_ context.Context, authID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for k := range m.rows {
+		if k.authID == authID {
+			delete(m.rows, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memoryStore) Active(_ context.Context, now time.Time) ([]store.Cooldown, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []store.Cooldown
+	for _, c := range m.rows {
+		if c.ResetAt.After(now) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryStore) Prune(_ context.Context, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for k, c := range m.rows {
+		if c.ResetAt.Before(cutoff) {
+			delete(m.rows, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memoryStore) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.rows)
+}
+
+// newReplica returns a tracker over st with its own manager holding auths.
+func newReplica(t *testing.T, st Store, replica string, auths ...*coreauth.Auth) (*Tracker, *coreauth.Manager) {
+	t.Helper()
+	manager := coreauth.NewManager(nil, nil, nil)
+	for _, auth := range auths {
+		if _, err := manager.Register(context.Background(), auth.Clone()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tracker := New(st, Config{})
+	tracker.replica = replica
+	tracker.SetManager(manager)
+	return tracker, manager
+}
+
+func getAuth(t *testing.T, manager *coreauth.Manager, id string) *coreauth.Auth {
+	t.Helper()
+	auth, ok := manager.GetByID(id)
+	if !ok {
+		t.Fatalf("auth %s not registered", id)
+	}
+	return auth
+}
+
+// coolDown puts auth into a cooldown in manager the way the auth manager
+// does after a failed request.
+func coolDown(t *testing.T, manager *coreauth.Manager, id, model string, resetAt time.Time, quota bool) {
+	t.Helper()
+	auth := getAuth(t, manager, id)
+	q := coreauth.QuotaState{}
+	if quota {
+		q = coreauth.QuotaState{Exceeded: true, Reason: ReasonQuota, NextRecoverAt: resetAt, BackoffLevel: 2}
+	}
+	if model == "" {
+		auth.Unavailable, auth.NextRetryAfter, auth.Quota = true, resetAt, q
+	} else {
+		auth.ModelStates = map[string]*coreauth.ModelState{model: {
+			Unavailable: true, Status: coreauth.StatusError, NextRetryAfter: resetAt, Quota: q, StatusMessage: "rate limited",
+		}}
+		aggregate(auth, time.Now())
+	}
+	auth.Status = coreauth.StatusError
+	if _, err := manager.Update(context.Background(), auth); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCooldownIsSharedAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	auths := []*coreauth.Auth{
+		{ID: "codex-a.json", Provider: "codex"},
+		{ID: "gemini-b.json", Provider: "gemini"},
+	}
+	st := newMemoryStore()
+	trackerA, managerA := newReplica(t, st, "replica-a", auths...)
+	trackerB, managerB := newReplica(t, st, "replica-b", auths...)
+
+	// Replica A sees a 429 on one of gemini-b's models and a 401 on codex-a.
+	resetAt := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	coolDown(t, managerA, "gemini-b.json", "gemini-2.5-pro", resetAt, true)
+	trackerA.handle(ctx, event{authID: "gemini-b.json", model: "gemini-2.5-pro", statusCode: 429})
+	coolDown(t, managerA, "codex-a.json", "", resetAt, false)
+	trackerA.handle(ctx, event{authID: "codex-a.json", statusCode: 401})
+
+	if n := st.len(); n != 2 {
+		t.Fatalf("store holds %d cooldown(s), want 2", n)
+	}
+	row := st.rows[key{authID: "gemini-b.json", model: "gemini-2.5-pro"}]
+	if row.Reason != ReasonQuota || !row.QuotaExceeded || row.Replica != "replica-a" || !row.ResetAt.Equal(resetAt) {
+		t.Fatalf("stored row = %+v, want a quota cooldown recorded by replica-a until %s", row, resetAt)
+	}
+
+	// Replica B picks both up on its next sync.
+	if err := trackerB.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b := getAuth(t, managerB, "gemini-b.json")
+	state := b.ModelStates["gemini-2.5-pro"]
+	if state == nil || !state.Unavailable || !state.NextRetryAfter.Equal(resetAt) || !state.Quota.Exceeded || state.Quota.BackoffLevel != 2 {
+		t.Fatalf("replica-b model state = %+v, want the quota cooldown until %s", state, resetAt)
+	}
+	a := getAuth(t, managerB, "codex-a.json")
+	if !a.Unavailable || !a.NextRetryAfter.Equal(resetAt) || a.Status != coreauth.StatusError {
+		t.Fatalf("replica-b codex-a = unavailable %v until %s, want until %s", a.Unavailable, a.NextRetryAfter, resetAt)
+	}
+
+	// A longer local cooldown is not shortened by a stored one.
+	longer := resetAt.Add(time.Hour)
+	coolDown(t, managerB, "codex-a.json", "", longer, false)
+	if err := trackerB.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if a = getAuth(t, managerB, "codex-a.json"); !a.NextRetryAfter.Equal(longer) {
+		t.Fatalf("replica-b codex-a retries at %s, want its own %s", a.NextRetryAfter, longer)
+	}
+}
+
+func TestClearResetsSharedRowAndLocalState(t *testing.T) {
+	ctx := context.Background()
+	auth := &coreauth.Auth{ID: "gemini-b.json", Provider: "gemini"}
+	st := newMemoryStore()
+	trackerA, managerA := newReplica(t, st, "replica-a", auth)
+	trackerB, managerB := newReplica(t, st, "replica-b", auth)
+
+	resetAt := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	coolDown(t, managerA, "gemini-b.json", "gemini-2.5-pro", resetAt, true)
+	trackerA.handle(ctx, event{authID: "gemini-b.json", model: "gemini-2.5-pro", statusCode: 429})
+	if err := trackerB.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// An operator resets the credential through replica B.
+	if err := trackerB.Clear(ctx, "gemini-b.json", ""); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if n := st.len(); n != 0 {
+		t.Fatalf("store holds %d cooldown(s) after reset, want 0", n)
+	}
+	if len(trackerB.rows) != 0 {
+		t.Fatalf("replica-b still tracks %v", trackerB.rows)
+	}
+	b := getAuth(t, managerB, "gemini-b.json")
+	if state := b.ModelStates["gemini-2.5-pro"]; state.Unavailable || b.Unavailable || b.Status != coreauth.StatusActive || state.Quota.Exceeded {
+		t.Fatalf("replica-b after reset: auth unavailable %v, model state %+v", b.Unavailable, state)
+	}
+
+	// Replica A lifts its own copy of the cooldown on its next sync.
+	if err := trackerA.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a := getAuth(t, managerA, "gemini-b.json")
+	if state := a.ModelStates["gemini-2.5-pro"]; state.Unavailable || a.Unavailable || a.Status != coreauth.StatusActive {
+		t.Fatalf("replica-a after reset: auth unavailable %v, model state %+v", a.Unavailable, state)
+	}
+
+	if err := trackerB.Clear(ctx, "gemini-b.json", ""); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second Clear error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSuccessClearsRecordedCooldown(t *testing.T) {
+	ctx := context.Background()
+	st := newMemoryStore()
+	tracker, manager := newReplica(t, st, "replica-a", &coreauth.Auth{ID: "codex-a.json", Provider: "codex"})
+
+	coolDown(t, manager, "codex-a.json", "", time.Now().Add(time.Minute), false)
+	tracker.handle(ctx, event{authID: "codex-a.json", statusCode: 503})
+	if row := st.rows[key{authID: "codex-a.json"}]; row.Reason != ReasonUpstream || row.StatusCode != 503 {
+		t.Fatalf("stored row = %+v, want an upstream cooldown", row)
+	}
+	tracker.handle(ctx, event{authID: "codex-a.json", success: true})
+	if n := st.len(); n != 0 {
+		t.Fatalf("store holds %d cooldown(s) after a success, want 0", n)
+	}
+}
+
+func TestReasonFor(t *testing.T) {
+	tests := map[int]string{
+		429: ReasonQuota,
+		401: ReasonUnauthorized,
+		402: ReasonPaymentRequired,
+		403: ReasonPaymentRequired,
+		404: ReasonNotFound,
+		408: ReasonUpstream,
+		502: ReasonUpstream,
+		400: ReasonError,
+		0:   ReasonError,
+	}
+	for code, want := range tests {
+		if got := reasonFor(code); got != want {
+			t.Errorf("reasonFor(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
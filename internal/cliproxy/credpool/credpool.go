@@ -0,0 +1,373 @@
+// Package credpool routes requests through named pools of stored credentials.
+//
+// Pools, their members and the bindings of client API keys and model names to
+// pools live in Postgres and are reloaded periodically, so every replica
+// routes alike. The pool Selector wraps the auth manager's selector: a request
+// whose API key or model is bound to a pool is only served by that pool's
+// credentials, chosen by the pool's strategy. Unbound requests keep
+// CLIProxy's default round-robin over all credentials.
+package credpool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	maxWeight       = 1000
+)
+
+// Selection strategies.
+const (
+	// StrategyRoundRobin cycles through the pool's available credentials.
+	StrategyRoundRobin = "round-robin"
+	// StrategyWeighted spreads requests in proportion to member weights.
+	StrategyWeighted = "weighted"
+	// StrategyLeastRecentlyUsed picks the credential idle the longest.
+	StrategyLeastRecentlyUsed = "least-recently-used"
+	// StrategyQuotaAware prefers credentials that have not hit a quota limit
+	// recently, then the one idle the longest.
+	StrategyQuotaAware = "quota-aware"
+)
+
+var strategies = []string{StrategyRoundRobin, StrategyWeighted, StrategyLeastRecentlyUsed, StrategyQuotaAware}
+
+var poolNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Store persists pools; *store.PostgresPoolStore implements it.
+type Store interface {
+	ListPools(ctx context.Context) ([]store.CredentialPool, error)
+	PutPool(ctx context.Context, name, strategy, description string) error
+	DeletePool(ctx context.Context, name string) error
+	PutPoolMember(ctx context.Context, pool, authID string, weight int) error
+	DeletePoolMember(ctx context.Context, pool, authID string) error
+	ListPoolBindings(ctx context.Context) ([]store.PoolBinding, error)
+	PutPoolBinding(ctx context.Context, b store.PoolBinding) error
+	DeletePoolBinding(ctx context.Context, kind, match string) error
+}
+
+// ValidationError reports a pool, member or binding that cannot be stored.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func invalidf(format string, args ...any) error {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
+
+// Config tunes the pool router.
+type Config struct {
+	// Interval is how often pools are reloaded to pick up other replicas'
+	// changes; zero uses 10s.
+	Interval time.Duration
+}
+
+// MemberStatus is a pool member with the picks this replica made for it.
+type MemberStatus struct {
+	store.PoolMember
+	Picks int64 `json:"picks"`
+	// LastPick is when this replica last picked the credential, through any pool.
+	LastPick *time.Time `json:"last_pick,omitempty"`
+}
+
+// PoolStatus is a pool as currently loaded, with per-member pick counters.
+type PoolStatus struct {
+	store.CredentialPool
+	Members []MemberStatus `json:"members"`
+}
+
+// snapshot is the immutable routing table built on every load.
+type snapshot struct {
+	pools map[string]*store.CredentialPool
+	// apiKeys maps API key hashes to pool names.
+	apiKeys map[string]string
+	// models maps exact model names to pool names.
+	models map[string]string
+	// patterns holds glob bindings, longest pattern first.
+	patterns []store.PoolBinding
+	bindings []store.PoolBinding
+	loadedAt time.Time
+}
+
+// Router loads pools from a Store and routes requests through them.
+type Router struct {
+	store    Store
+	interval time.Duration
+	state    atomic.Pointer[snapshot]
+
+	mu     sync.Mutex
+	cycles map[string]*coreauth.RoundRobinSelector
+	picks  map[string]int64
+	last   map[string]time.Time
+
+	// check reports whether a single credential is usable for a model,
+	// reusing CLIProxy's own cooldown rules.
+	check coreauth.RoundRobinSelector
+}
+
+// New returns a Router over st. Call Load before serving traffic.
+func New(st Store, cfg Config) *Router {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	r := &Router{
+		store:    st,
+		interval: cfg.Interval,
+		cycles:   make(map[string]*coreauth.RoundRobinSelector),
+		picks:    make(map[string]int64),
+		last:     make(map[string]time.Time),
+	}
+	r.state.Store(&snapshot{pools: map[string]*store.CredentialPool{}})
+	return r
+}
+
+// Load reads pools and bindings from the store and swaps the routing table.
+func (r *Router) Load(ctx context.Context) error {
+	pools, err := r.store.ListPools(ctx)
+	if err != nil {
+		return err
+	}
+	bindings, err := r.store.ListPoolBindings(ctx)
+	if err != nil {
+		return err
+	}
+	snap := &snapshot{
+		pools:    make(map[string]*store.CredentialPool, len(pools)),
+		apiKeys:  make(map[string]string),
+		models:   make(map[string]string),
+		bindings: bindings,
+		loadedAt: time.Now(),
+	}
+	for i := range pools {
+		snap.pools[pools[i].Name] = &pools[i]
+	}
+	for _, b := range bindings {
+		switch {
+		case b.Kind == store.BindingAPIKey:
+			snap.apiKeys[b.Match] = b.Pool
+		case b.Kind == store.BindingModel && strings.ContainsAny(b.Match, "*?["):
+			snap.patterns = append(snap.patterns, b)
+		case b.Kind == store.BindingModel:
+			snap.models[strings.ToLower(b.Match)] = b.Pool
+		}
+	}
+	sort.SliceStable(snap.patterns, func(i, j int) bool { return len(snap.patterns[i].Match) > len(snap.patterns[j].Match) })
+	r.state.Store(snap)
+	return nil
+}
+
+// Run reloads pools every interval until ctx is cancelled.
+func (r *Router) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Load(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("credential pools: reload: %v", err)
+			}
+		}
+	}
+}
+
+// Pools returns the loaded pools with this replica's pick counters, the
+// bindings and the time of the last load.
+func (r *Router) Pools() ([]PoolStatus, []store.PoolBinding, time.Time) {
+	snap := r.state.Load()
+	names := make([]string, 0, len(snap.pools))
+	for name := range snap.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]PoolStatus, 0, len(names))
+	for _, name := range names {
+		pool := snap.pools[name]
+		status := PoolStatus{CredentialPool: *pool, Members: make([]MemberStatus, 0, len(pool.Members))}
+		for _, m := range pool.Members {
+			ms := MemberStatus{PoolMember: m, Picks: r.picks[name+"\x00"+m.AuthID]}
+			if at, ok := r.last[m.AuthID]; ok {
+				ms.LastPick = &at
+			}
+			status.Members = append(status.Members, ms)
+		}
+		out = append(out, status)
+	}
+	bindings := snap.bindings
+	if bindings == nil {
+		bindings = []store.PoolBinding{}
+	}
+	return out, bindings, snap.loadedAt
+}
+
+// PutPool creates or updates a pool.
+func (r *Router) PutPool(ctx context.Context, name, strategy, description string) error {
+	if !poolNamePattern.MatchString(name) {
+		return invalidf("invalid pool name %q", name)
+	}
+	if strategy == "" {
+		strategy = StrategyRoundRobin
+	}
+	if !validStrategy(strategy) {
+		return invalidf("unknown strategy %q (want %s)", strategy, strings.Join(strategies, ", "))
+	}
+	if err := r.store.PutPool(ctx, name, strategy, strings.TrimSpace(description)); err != nil {
+		return err
+	}
+	return r.Load(ctx)
+}
+
+// DeletePool removes a pool with its members and bindings.
+func (r *Router) DeletePool(ctx context.Context, name string) error {
+	if err := r.store.DeletePool(ctx, name); err != nil {
+		return err
+	}
+	return r.Load(ctx)
+}
+
+// PutMember adds a credential to a pool; weight zero means 1.
+func (r *Router) PutMember(ctx context.Context, pool, authID string, weight int) error {
+	authID = strings.TrimSpace(authID)
+	if authID == "" {
+		return invalidf("credential id is empty")
+	}
+	if weight == 0 {
+		weight = 1
+	}
+	if weight < 1 || weight > maxWeight {
+		return invalidf("weight must be between 1 and %d", maxWeight)
+	}
+	if err := r.store.PutPoolMember(ctx, pool, authID, weight); err != nil {
+		return err
+	}
+	return r.Load(ctx)
+}
+
+// DeleteMember removes a credential from a pool.
+func (r *Router) DeleteMember(ctx context.Context, pool, authID string) error {
+	if err := r.store.DeletePoolMember(ctx, pool, authID); err != nil {
+		return err
+	}
+	return r.Load(ctx)
+}
+
+// BindAPIKey routes every request made with key to pool.
+func (r *Router) BindAPIKey(ctx context.Context, key, pool string) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return invalidf("api key is empty")
+	}
+	return r.bind(ctx, store.PoolBinding{Kind: store.BindingAPIKey, Match: HashAPIKey(key), Hint: keyHint(key), Pool: pool})
+}
+
+// BindModel routes requests for model to pool. model may be a glob such as
+// "gemini-2.5-*"; exact names win over patterns, longer patterns over shorter.
+func (r *Router) BindModel(ctx context.Context, model, pool string) error {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return invalidf("model is empty")
+	}
+	if _, err := path.Match(model, ""); err != nil {
+		return invalidf("invalid model pattern %q", model)
+	}
+	return r.bind(ctx, store.PoolBinding{Kind: store.BindingModel, Match: model, Pool: pool})
+}
+
+func (r *Router) bind(ctx context.Context, b store.PoolBinding) error {
+	if err := r.store.PutPoolBinding(ctx, b); err != nil {
+		return err
+	}
+	return r.Load(ctx)
+}
+
+// Unbind removes a binding; for store.BindingAPIKey, match is the key's hash.
+func (r *Router) Unbind(ctx context.Context, kind, match string) error {
+	if err := r.store.DeletePoolBinding(ctx, kind, match); err != nil {
+		return err
+	}
+	return r.Load(ctx)
+}
+
+// PoolFor returns the pool bound to apiKey or, failing that, to model.
+func (r *Router) PoolFor(apiKey, model string) (*store.CredentialPool, bool) {
+	snap := r.state.Load()
+	if apiKey != "" {
+		if name, ok := snap.apiKeys[HashAPIKey(apiKey)]; ok {
+			pool, ok := snap.pools[name]
+			return pool, ok
+		}
+	}
+	model = strings.ToLower(strings.TrimSpace(model))
+	if model == "" {
+		return nil, false
+	}
+	if name, ok := snap.models[model]; ok {
+		pool, ok := snap.pools[name]
+		return pool, ok
+	}
+	for _, b := range snap.patterns {
+		if matched, _ := path.Match(strings.ToLower(b.Match), model); matched {
+			pool, ok := snap.pools[b.Pool]
+			return pool, ok
+		}
+	}
+	return nil, false
+}
+
+// HashAPIKey returns the hex SHA-256 under which an API key binding is stored.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// keyHint renders a short, non-reversible hint of key (e.g. "heli...-key").
+func keyHint(key string) string {
+	if len(key) <= 8 {
+		return "***"
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
+
+// apiKeyFrom returns the client API key CLIProxy authenticated the request
+// with; its handlers put the gin context into the execution context.
+func apiKeyFrom(ctx context.Context) string {
+	c, ok := ctx.Value("gin").(*gin.Context)
+	if !ok || c == nil {
+		return ""
+	}
+	key, _ := c.Get("apiKey")
+	s, _ := key.(string)
+	return s
+}
+
+func validStrategy(strategy string) bool {
+	for _, s := range strategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package credpool
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// Selector wraps next (round-robin when nil) so that requests bound to a pool
+// are served by that pool's credentials only. Unbound requests go to next.
+func (r *Router) Selector(next coreauth.Selector) coreauth.Selector {
+	if next == nil {
+		next = &coreauth.RoundRobinSelector{}
+	}
+	return poolSelector{router: r, next: next}
+}
+
+type poolSelector struct {
+	router *Router
+	next   coreauth.Selector
+}
+
+func (s poolSelector) Pick(ctx context.Context, provider, model string, opts cliproxyexecutor.Options, auths []*coreauth.Auth) (*coreauth.Auth, error) {
+	pool, ok := s.router.PoolFor(apiKeyFrom(ctx), model)
+	if !ok {
+		return s.next.Pick(ctx, provider, model, opts, auths)
+	}
+	weights := make(map[string]int, len(pool.Members))
+	for _, m := range pool.Members {
+		weights[m.AuthID] = m.Weight
+	}
+	members := make([]*coreauth.Auth, 0, len(auths))
+	for _, auth := range auths {
+		if auth != nil {
+			if _, ok := weights[auth.ID]; ok {
+				members = append(members, auth)
+			}
+		}
+	}
+	if len(members) == 0 {
+		return nil, &coreauth.Error{Code: "auth_not_found", Message: fmt.Sprintf("credential pool %q has no %s credential for %s", pool.Name, provider, model)}
+	}
+
+	var picked *coreauth.Auth
+	if pool.Strategy == StrategyRoundRobin || pool.Strategy == "" {
+		var err error
+		if picked, err = s.router.cycle(pool.Name).Pick(ctx, provider, model, opts, members); err != nil {
+			return nil, err
+		}
+	} else {
+		available := s.router.available(ctx, provider, model, opts, members)
+		if len(available) == 0 {
+			// Let CLIProxy's selector report the cooldown (429 with a reset time).
+			return s.router.check.Pick(ctx, provider, model, opts, members)
+		}
+		switch pool.Strategy {
+		case StrategyWeighted:
+			picked = pickWeighted(available, weights)
+		case StrategyQuotaAware:
+			picked = s.router.pickQuotaAware(available, model)
+		default:
+			picked = s.router.pickLeastRecent(available)
+		}
+	}
+	s.router.record(pool, picked.ID)
+	return picked, nil
+}
+
+// cycle returns the round-robin cursor of a pool.
+func (r *Router) cycle(pool string) *coreauth.RoundRobinSelector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sel, ok := r.cycles[pool]
+	if !ok {
+		sel = &coreauth.RoundRobinSelector{}
+		r.cycles[pool] = sel
+	}
+	return sel
+}
+
+// available drops the candidates CLIProxy would not use for model right now
+// (cooldowns, quota backoff, unavailable models).
+func (r *Router) available(ctx context.Context, provider, model string, opts cliproxyexecutor.Options, auths []*coreauth.Auth) []*coreauth.Auth {
+	out := make([]*coreauth.Auth, 0, len(auths))
+	for _, auth := range auths {
+		if _, err := r.check.Pick(ctx, provider, model, opts, []*coreauth.Auth{auth}); err == nil {
+			out = append(out, auth)
+		}
+	}
+	return out
+}
+
+func (r *Router) record(pool *store.CredentialPool, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.picks[pool.Name+"\x00"+id]++
+	r.last[id] = time.Now()
+}
+
+// pickWeighted draws a credential with probability proportional to its weight.
+func pickWeighted(auths []*coreauth.Auth, weights map[string]int) *coreauth.Auth {
+	total := 0
+	for _, auth := range auths {
+		total += max(weights[auth.ID], 1)
+	}
+	n := rand.IntN(total)
+	for _, auth := range auths {
+		if n -= max(weights[auth.ID], 1); n < 0 {
+			return auth
+		}
+	}
+	return auths[len(auths)-1]
+}
+
+// pickLeastRecent returns the credential this replica picked longest ago
+// (never picked first), breaking ties by id.
+func (r *Router) pickLeastRecent(auths []*coreauth.Auth) *coreauth.Auth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var best *coreauth.Auth
+	var bestAt time.Time
+	for _, auth := range auths {
+		at := r.last[auth.ID]
+		if best == nil || at.Before(bestAt) || (at.Equal(bestAt) && auth.ID < best.ID) {
+			best, bestAt = auth, at
+		}
+	}
+	return best
+}
+
+// pickQuotaAware returns the credential with the lowest quota backoff for
+// model, the least recently used among equals. The backoff level grows with
+// every 429 and resets after a success, so credentials that were recently
+// rate limited are used last.
+func (r *Router) pickQuotaAware(auths []*coreauth.Auth, model string) *coreauth.Auth {
+	lowest := -1
+	var preferred []*coreauth.Auth
+	for _, auth := range auths {
+		level := quotaLevel(auth, model)
+		switch {
+		case lowest < 0 || level < lowest:
+			lowest, preferred = level, []*coreauth.Auth{auth}
+		case level == lowest:
+			preferred = append(preferred, auth)
+		}
+	}
+	return r.pickLeastRecent(preferred)
+}
+
+func quotaLevel(auth *coreauth.Auth, model string) int {
+	level := auth.Quota.BackoffLevel
+	if auth.Quota.Exceeded {
+		level++
+	}
+	if state, ok := auth.ModelStates[model]; ok && state != nil {
+		level += state.Quota.BackoffLevel
+		if state.Quota.Exceeded {
+			level++
+		}
+	}
+	return level
+}
@@ -0,0 +1,143 @@
+package credpool
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// memoryStore serves fixed pools and bindings.
+type memoryStore struct {
+	pools    []store.CredentialPool
+	bindings []store.PoolBinding
+}
+
+func (m *memoryStore) ListPools(context.Context) ([]store.CredentialPool, error) {
+	return m.pools, nil
+}
+func (m *memoryStore) PutPool(context.Context, string, string, string) error    { return nil }
+func (m *memoryStore) DeletePool(context.Context, string) error                 { return nil }
+func (m *memoryStore) PutPoolMember(context.Context, string, string, int) error { return nil }
+func (m *memoryStore) DeletePoolMember(context.Context, string, string) error   { return nil }
+func (m *memoryStore) PutPoolBinding(context.Context, store.PoolBinding) error  { return nil }
+func (m *memoryStore) DeletePoolBinding(context.Context, string, string) error  { return nil }
+func (m *memoryStore) ListPoolBindings(context.Context) ([]store.PoolBinding, error) {
+	return m.bindings, nil
+}
+
+func testAuths(ids ...string) []*coreauth.Auth {
+	auths := make([]*coreauth.Auth, len(ids))
+	for i, id := range ids {
+		auths[i] = &coreauth.Auth{ID: id, Provider: "codex", Status: coreauth.StatusActive}
+	}
+	return auths
+}
+
+func TestSelectorWeightDistribution(t *testing.T) {
+	const picks = 20000
+	tests := []struct {
+		name    string
+		members []store.PoolMember
+		// disabled credentials are pool members CLIProxy would not use.
+		disabled []string
+		want     map[string]float64
+	}{
+		{
+			name:    "proportional to weight",
+			members: []store.PoolMember{{AuthID: "a", Weight: 1}, {AuthID: "b", Weight: 3}, {AuthID: "c", Weight: 6}},
+			want:    map[string]float64{"a": 0.1, "b": 0.3, "c": 0.6},
+		},
+		{
+			name:    "equal weights",
+			members: []store.PoolMember{{AuthID: "a", Weight: 5}, {AuthID: "b", Weight: 5}},
+			want:    map[string]float64{"a": 0.5, "b": 0.5},
+		},
+		{
+			name:    "weights below one count as one",
+			members: []store.PoolMember{{AuthID: "a", Weight: 0}, {AuthID: "b", Weight: 3}},
+			want:    map[string]float64{"a": 0.25, "b": 0.75},
+		},
+		{
+			name:     "unavailable members are skipped",
+			members:  []store.PoolMember{{AuthID: "a", Weight: 1}, {AuthID: "b", Weight: 3}, {AuthID: "c", Weight: 6}},
+			disabled: []string{"c"},
+			want:     map[string]float64{"a": 0.25, "b": 0.75},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			st := &memoryStore{
+				pools:    []store.CredentialPool{{Name: "p", Strategy: StrategyWeighted, Members: tt.members}},
+				bindings: []store.PoolBinding{{Kind: store.BindingModel, Match: "gpt-*", Pool: "p"}},
+			}
+			r := New(st, Config{})
+			if err := r.Load(ctx); err != nil {
+				t.Fatal(err)
+			}
+			// "x" is not a pool member and must never be picked.
+			auths := testAuths("a", "b", "c", "x")
+			for _, auth := range auths {
+				for _, id := range tt.disabled {
+					if auth.ID == id {
+						auth.Disabled = true
+						auth.Status = coreauth.StatusDisabled
+					}
+				}
+			}
+			sel := r.Selector(nil)
+
+			counts := make(map[string]int)
+			for i := 0; i < picks; i++ {
+				auth, err := sel.Pick(ctx, "codex", "gpt-5", cliproxyexecutor.Options{}, auths)
+				if err != nil {
+					t.Fatalf("Pick: %v", err)
+				}
+				counts[auth.ID]++
+			}
+			for id, n := range counts {
+				if _, ok := tt.want[id]; !ok {
+					t.Fatalf("picked %s %d times; want only %v", id, n, tt.want)
+				}
+			}
+			for id, share := range tt.want {
+				got := float64(counts[id]) / picks
+				if math.Abs(got-share) > 0.02 {
+					t.Errorf("%s picked %.3f of the time, want %.2f (counts %v)", id, got, share, counts)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectorUnboundModelUsesNext(t *testing.T) {
+	ctx := context.Background()
+	st := &memoryStore{
+		pools:    []store.CredentialPool{{Name: "p", Strategy: StrategyWeighted, Members: []store.PoolMember{{AuthID: "a", Weight: 1}}}},
+		bindings: []store.PoolBinding{{Kind: store.BindingModel, Match: "gpt-5", Pool: "p"}},
+	}
+	r := New(st, Config{})
+	if err := r.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sel := r.Selector(nil)
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		auth, err := sel.Pick(ctx, "codex", "claude-sonnet", cliproxyexecutor.Options{}, testAuths("a", "x"))
+		if err != nil {
+			t.Fatalf("Pick: %v", err)
+		}
+		seen[auth.ID] = true
+	}
+	if !seen["x"] {
+		t.Fatalf("unbound requests only reached %v; want the whole credential set", seen)
+	}
+	if _, err := sel.Pick(ctx, "codex", "gpt-5", cliproxyexecutor.Options{}, testAuths("x")); err == nil {
+		t.Fatal("a bound pool without matching credentials fell back to non-members")
+	}
+}
@@ -0,0 +1,343 @@
+// Package errorlogs indexes the error-*.log files written by the embedded
+// CLIProxy request logger and enforces retention on them.
+package errorlogs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sectionRequestInfo   = "REQUEST INFO"
+	sectionHeaders       = "HEADERS"
+	sectionRequestBody   = "REQUEST BODY"
+	sectionResponse      = "RESPONSE"
+	defaultPageSize      = 25
+	maxPageSize          = 200
+	defaultRetentionTick = 10 * time.Minute
+)
+
+// Summary describes a log file without its bodies.
+type Summary struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modtime"`
+	Method    string    `json:"method,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitempty"`
+}
+
+// Entry is a fully parsed log file.
+type Entry struct {
+	Summary
+	Info            map[string]string   `json:"info,omitempty"`
+	RequestHeaders  map[string][]string `json:"request_headers,omitempty"`
+	RequestBody     string              `json:"request_body,omitempty"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody    string              `json:"response_body,omitempty"`
+}
+
+// Page is one page of summaries, newest first.
+type Page struct {
+	Entries  []Summary `json:"entries"`
+	Total    int       `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+}
+
+// Retention limits how many log files are kept. Zero values disable a limit.
+type Retention struct {
+	MaxAge        time.Duration
+	MaxTotalBytes int64
+}
+
+// Index lists and parses CLIProxy error logs in a directory.
+type Index struct {
+	dir       string
+	retention Retention
+
+	mu    sync.Mutex
+	cache map[string]cachedSummary
+}
+
+type cachedSummary struct {
+	size    int64
+	modTime time.Time
+	summary Summary
+}
+
+// DefaultDir mirrors CLIProxy's choice of log directory: WRITABLE_PATH/logs when
+// set, otherwise a logs directory next to the configuration file.
+func DefaultDir(configPath string) string {
+	for _, key := range []string{"WRITABLE_PATH", "writable_path"} {
+		if base := strings.TrimSpace(os.Getenv(key)); base != "" {
+			return filepath.Join(filepath.Clean(base), "logs")
+		}
+	}
+	return filepath.Join(filepath.Dir(configPath), "logs")
+}
+
+// New creates an index over dir.
+func New(dir string, retention Retention) *Index {
+	return &Index{dir: dir, retention: retention, cache: make(map[string]cachedSummary)}
+}
+
+// Dir returns the indexed directory.
+func (x *Index) Dir() string {
+	return x.dir
+}
+
+// List returns a page of log summaries, newest first. Pages start at 1.
+func (x *Index) List(page, pageSize int) (*Page, error) {
+	summaries, err := x.scan()
+	if err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	if page <= 0 {
+		page = 1
+	}
+	start := (page - 1) * pageSize
+	if start > len(summaries) {
+		start = len(summaries)
+	}
+	end := start + pageSize
+	if end > len(summaries) {
+		end = len(summaries)
+	}
+	return &Page{Entries: summaries[start:end], Total: len(summaries), Page: page, PageSize: pageSize}, nil
+}
+
+// Get parses a single log file by name.
+func (x *Index) Get(name string) (*Entry, error) {
+	if !validName(name) {
+		return nil, os.ErrNotExist
+	}
+	path := filepath.Join(x.dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entry := Parse(data)
+	entry.Name = name
+	entry.Size = info.Size()
+	entry.ModTime = info.ModTime()
+	return entry, nil
+}
+
+// Delete removes a single log file by name.
+func (x *Index) Delete(name string) error {
+	if !validName(name) {
+		return os.ErrNotExist
+	}
+	return os.Remove(filepath.Join(x.dir, name))
+}
+
+// Enforce deletes files older than the maximum age and then the oldest files
+// until the directory fits within the size limit. It returns the number removed.
+func (x *Index) Enforce() (int, error) {
+	if x.retention.MaxAge <= 0 && x.retention.MaxTotalBytes <= 0 {
+		return 0, nil
+	}
+	summaries, err := x.scan()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var total int64
+	cutoff := time.Now().Add(-x.retention.MaxAge)
+	// summaries are sorted newest first, so everything after the budget is exhausted goes.
+	for _, s := range summaries {
+		expired := x.retention.MaxAge > 0 && s.ModTime.Before(cutoff)
+		overBudget := x.retention.MaxTotalBytes > 0 && total+s.Size > x.retention.MaxTotalBytes
+		if !expired && !overBudget {
+			total += s.Size
+			continue
+		}
+		if errRemove := os.Remove(filepath.Join(x.dir, s.Name)); errRemove != nil && !os.IsNotExist(errRemove) {
+			return removed, fmt.Errorf("error logs: remove %s: %w", s.Name, errRemove)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Run enforces retention periodically until ctx is cancelled.
+func (x *Index) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultRetentionTick
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := x.Enforce(); err != nil {
+			log.Printf("error logs: retention failed: %v", err)
+		} else if n > 0 {
+			log.Printf("error logs: removed %d file(s) from %s", n, x.dir)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (x *Index) scan() ([]Summary, error) {
+	dirEntries, err := os.ReadDir(x.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Summary{}, nil
+		}
+		return nil, fmt.Errorf("error logs: read directory: %w", err)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	seen := make(map[string]struct{}, len(dirEntries))
+	summaries := make([]Summary, 0, len(dirEntries))
+	for _, d := range dirEntries {
+		if d.IsDir() || !validName(d.Name()) {
+			continue
+		}
+		info, errInfo := d.Info()
+		if errInfo != nil {
+			continue
+		}
+		name := d.Name()
+		seen[name] = struct{}{}
+		if cached, ok := x.cache[name]; ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+			summaries = append(summaries, cached.summary)
+			continue
+		}
+		summary := Summary{Name: name, Size: info.Size(), ModTime: info.ModTime()}
+		if data, errRead := os.ReadFile(filepath.Join(x.dir, name)); errRead == nil {
+			parsed := Parse(data)
+			summary.Method = parsed.Method
+			summary.URL = parsed.URL
+			summary.Status = parsed.Status
+			summary.Timestamp = parsed.Timestamp
+		}
+		x.cache[name] = cachedSummary{size: info.Size(), modTime: info.ModTime(), summary: summary}
+		summaries = append(summaries, summary)
+	}
+	for name := range x.cache {
+		if _, ok := seen[name]; !ok {
+			delete(x.cache, name)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].ModTime.Equal(summaries[j].ModTime) {
+			return summaries[i].ModTime.After(summaries[j].ModTime)
+		}
+		// File names embed the request timestamp, so they break ties in the same order.
+		return summaries[i].Name > summaries[j].Name
+	})
+	return summaries, nil
+}
+
+// Parse splits a CLIProxy request log into its sections.
+func Parse(data []byte) *Entry {
+	sections := splitSections(data)
+	entry := &Entry{Info: parseKeyValues(sections[sectionRequestInfo])}
+	entry.Method = entry.Info["Method"]
+	entry.URL = entry.Info["URL"]
+	if ts, err := time.Parse(time.RFC3339Nano, entry.Info["Timestamp"]); err == nil {
+		entry.Timestamp = ts
+	}
+	entry.RequestHeaders = parseHeaders(sections[sectionHeaders])
+	entry.RequestBody = strings.TrimSpace(sections[sectionRequestBody])
+
+	// The response section holds a status line, headers, a blank line and the
+	// body. Streamed logs that failed before a status was written start with
+	// the blank line, so the head is empty and everything after it is body.
+	response := strings.ReplaceAll(sections[sectionResponse], "\r\n", "\n")
+	head, body, _ := strings.Cut("\n"+response, "\n\n")
+	headers := parseHeaders(head)
+	if status, ok := headers["Status"]; ok && len(status) > 0 {
+		entry.Status, _ = strconv.Atoi(strings.TrimSpace(status[0]))
+		delete(headers, "Status")
+	}
+	entry.ResponseHeaders = headers
+	entry.ResponseBody = strings.TrimSpace(body)
+	return entry
+}
+
+func splitSections(data []byte) map[string]string {
+	sections := make(map[string]string)
+	var (
+		current string
+		buf     strings.Builder
+	)
+	flush := func() {
+		if current != "" {
+			sections[current] = buf.String()
+		}
+		buf.Reset()
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "=== ") && strings.HasSuffix(trimmed, " ===") {
+			flush()
+			current = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(trimmed, "=== "), " ==="))
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	flush()
+	return sections
+}
+
+func parseKeyValues(text string) map[string]string {
+	out := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		out[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return out
+}
+
+func parseHeaders(text string) map[string][]string {
+	out := make(map[string][]string)
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		out[key] = append(out[key], strings.TrimSpace(value))
+	}
+	return out
+}
+
+// validName only admits CLIProxy error log file names, which also rules out path traversal.
+func validName(name string) bool {
+	return strings.HasPrefix(name, "error-") && strings.HasSuffix(name, ".log") && filepath.Base(name) == name
+}
@@ -0,0 +1,203 @@
+package errorlogs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// requestLog is the layout of a non-streaming CLIProxy error log.
+const requestLog = `=== REQUEST INFO ===
+Version: 6.6.0
+URL: /v1/chat/completions?stream=false
+Method: POST
+Timestamp: 2025-12-11T19:04:30.123456789Z
+
+=== HEADERS ===
+Content-Type: application/json
+Authorization: Bearer sk-****abcd
+Accept: text/event-stream
+Accept: application/json
+
+=== REQUEST BODY ===
+{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}
+
+=== API REQUEST ===
+{"model":"gpt-5"}
+
+=== API ERROR RESPONSE ===
+HTTP Status: 429
+{"error":{"message":"quota exceeded"}}
+
+=== RESPONSE ===
+Status: 429
+Content-Type: application/json
+
+{"error":{"message":"quota exceeded","type":"rate_limit"}}
+`
+
+// streamingLog is the layout of a streamed CLIProxy error log that failed
+// before a status was written.
+const streamingLog = `=== REQUEST INFO ===
+Version: 6.6.0
+URL: /v1/messages
+Method: POST
+Timestamp: 2025-12-11T19:05:00Z
+
+=== HEADERS ===
+Content-Type: application/json
+
+=== REQUEST BODY ===
+{"model":"claude-sonnet-4","stream":true}
+
+=== RESPONSE ===
+
+data: {"type":"error"}
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Entry
+	}{
+		{
+			name: "request log",
+			data: requestLog,
+			want: Entry{
+				Summary: Summary{
+					Method:    "POST",
+					URL:       "/v1/chat/completions?stream=false",
+					Status:    429,
+					Timestamp: time.Date(2025, 12, 11, 19, 4, 30, 123456789, time.UTC),
+				},
+				Info: map[string]string{
+					"Version":   "6.6.0",
+					"URL":       "/v1/chat/completions?stream=false",
+					"Method":    "POST",
+					"Timestamp": "2025-12-11T19:04:30.123456789Z",
+				},
+				RequestHeaders: map[string][]string{
+					"Content-Type":  {"application/json"},
+					"Authorization": {"Bearer sk-****abcd"},
+					"Accept":        {"text/event-stream", "application/json"},
+				},
+				RequestBody:     `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}`,
+				ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}},
+				ResponseBody:    `{"error":{"message":"quota exceeded","type":"rate_limit"}}`,
+			},
+		},
+		{
+			name: "streaming log without status",
+			data: streamingLog,
+			want: Entry{
+				Summary: Summary{
+					Method:    "POST",
+					URL:       "/v1/messages",
+					Timestamp: time.Date(2025, 12, 11, 19, 5, 0, 0, time.UTC),
+				},
+				Info: map[string]string{
+					"Version":   "6.6.0",
+					"URL":       "/v1/messages",
+					"Method":    "POST",
+					"Timestamp": "2025-12-11T19:05:00Z",
+				},
+				RequestHeaders:  map[string][]string{"Content-Type": {"application/json"}},
+				RequestBody:     `{"model":"claude-sonnet-4","stream":true}`,
+				ResponseHeaders: map[string][]string{},
+				ResponseBody:    `data: {"type":"error"}`,
+			},
+		},
+		{
+			name: "CRLF line endings",
+			data: strings.ReplaceAll(requestLog, "\n", "\r\n"),
+			want: Entry{
+				Summary: Summary{
+					Method:    "POST",
+					URL:       "/v1/chat/completions?stream=false",
+					Status:    429,
+					Timestamp: time.Date(2025, 12, 11, 19, 4, 30, 123456789, time.UTC),
+				},
+				Info: map[string]string{
+					"Version":   "6.6.0",
+					"URL":       "/v1/chat/completions?stream=false",
+					"Method":    "POST",
+					"Timestamp": "2025-12-11T19:04:30.123456789Z",
+				},
+				RequestHeaders: map[string][]string{
+					"Content-Type":  {"application/json"},
+					"Authorization": {"Bearer sk-****abcd"},
+					"Accept":        {"text/event-stream", "application/json"},
+				},
+				RequestBody:     `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}`,
+				ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}},
+				ResponseBody:    `{"error":{"message":"quota exceeded","type":"rate_limit"}}`,
+			},
+		},
+		{
+			name: "not a request log",
+			data: "panic: runtime error\n",
+			want: Entry{
+				Info:            map[string]string{},
+				RequestHeaders:  map[string][]string{},
+				ResponseHeaders: map[string][]string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse([]byte(tt.data))
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("Parse =\n%+v\nwant\n%+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"error-v1-chat-completions-2025-12-11T190430-123456789.log", true},
+		{"v1-chat-completions-2025-12-11T190430-123456789.log", false},
+		{"error-v1-messages.txt", false},
+		{"..", false},
+		{"error-../../etc/passwd.log", false},
+		{"error-x/../../secrets.log", false},
+		{"/var/log/error-x.log", false},
+		{"logs/error-x.log", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validName(tt.name); got != tt.want {
+			t.Errorf("validName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetRejectsNamesOutsideDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "logs")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "error-secret.log"), []byte(requestLog), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	x := New(dir, Retention{})
+	for _, name := range []string{"../error-secret.log", filepath.Join(root, "error-secret.log")} {
+		if _, err := x.Get(name); !os.IsNotExist(err) {
+			t.Errorf("Get(%q) error = %v, want not exist", name, err)
+		}
+		if err := x.Delete(name); !os.IsNotExist(err) {
+			t.Errorf("Delete(%q) error = %v, want not exist", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "error-secret.log")); err != nil {
+		t.Fatalf("file outside the log directory was touched: %v", err)
+	}
+}
@@ -0,0 +1,469 @@
+// Package events delivers HelixRun's operational events to subscribers.
+//
+// Components publish events such as a failed token refresh, an exhausted
+// quota, a rejected config reload or a token store outage on the Bus. Each
+// event is sent to every enabled subscription whose patterns match its type:
+// a generic webhook signed with HMAC-SHA256, a Slack-compatible incoming
+// webhook or email over SMTP. Subscriptions live in Postgres so every replica
+// notifies alike; failed deliveries are retried with exponential backoff and
+// every outcome is written to the delivery log.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+const (
+	defaultInterval    = 30 * time.Second
+	defaultMaxAttempts = 5
+	defaultBackoff     = 2 * time.Second
+	defaultRetention   = 7 * 24 * time.Hour
+	maxBackoff         = 5 * time.Minute
+	queueSize          = 256
+	workers            = 4
+	maxErrorLen        = 500
+)
+
+// Event types.
+const (
+	TypeCredentialRefreshFailed  = "credential.refresh_failed"
+	TypeCredentialExpired        = "credential.expired"
+	TypeCredentialReauthRequired = "credential.reauth_required"
+	TypeCredentialQuotaExhausted = "credential.quota_exhausted"
+	TypeConfigReloadFailed       = "config.reload_failed"
+	TypeStoreUnavailable         = "store.unavailable"
+	TypeStoreRecovered           = "store.recovered"
+	// TypeTest is sent by the admin API to check a subscription.
+	TypeTest = "test"
+)
+
+// Types lists the event types HelixRun publishes.
+var Types = []string{
+	TypeCredentialRefreshFailed, TypeCredentialExpired, TypeCredentialReauthRequired,
+	TypeCredentialQuotaExhausted, TypeConfigReloadFailed, TypeStoreUnavailable, TypeStoreRecovered,
+}
+
+// Severities.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Delivery statuses.
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+var subscriptionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Event is one operational event, as posted to webhooks.
+type Event struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	// Subject names what the event is about, e.g. a credential id.
+	Subject string         `json:"subject,omitempty"`
+	Message string         `json:"message"`
+	Data    map[string]any `json:"data,omitempty"`
+	Replica string         `json:"replica,omitempty"`
+	Time    time.Time      `json:"time"`
+}
+
+// Store persists subscriptions and deliveries; *store.PostgresEventStore implements it.
+type Store interface {
+	ListSubscriptions(ctx context.Context) ([]store.EventSubscription, error)
+	PutSubscription(ctx context.Context, sub store.EventSubscription) error
+	DeleteSubscription(ctx context.Context, name string) error
+	InsertDelivery(ctx context.Context, d *store.EventDelivery) error
+	ListDeliveries(ctx context.Context, filter store.EventDeliveryFilter) ([]store.EventDelivery, error)
+	DeleteDeliveriesOlderThan(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// SMTPConfig is the mail server used by email subscriptions.
+type SMTPConfig struct {
+	// Addr is host:port; empty disables email subscriptions.
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// Config tunes the bus.
+type Config struct {
+	// Interval is how often subscriptions are reloaded to pick up other
+	// replicas' changes and the delivery log is pruned; zero uses 30s.
+	Interval time.Duration
+	// MaxAttempts per delivery; zero uses 5.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled on every further
+	// retry; zero uses 2s.
+	Backoff time.Duration
+	// Retention is how long the delivery log is kept; zero uses 7 days.
+	Retention time.Duration
+	SMTP      SMTPConfig
+}
+
+// ValidationError reports a subscription that cannot be stored.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func invalidf(format string, args ...any) error {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrNotFound is returned for an unknown subscription.
+var ErrNotFound = store.ErrNotFound
+
+type job struct {
+	event Event
+	sub   store.EventSubscription
+}
+
+// Bus fans events out to the subscriptions.
+type Bus struct {
+	store   Store
+	cfg     Config
+	replica string
+	sinks   map[string]sink
+	events  chan Event
+	jobs    chan job
+
+	mu   sync.RWMutex
+	subs []store.EventSubscription
+}
+
+// New returns a Bus over st. Call Load before publishing and Run to deliver.
+func New(st Store, cfg Config) *Bus {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaultRetention
+	}
+	replica, _ := os.Hostname()
+	return &Bus{
+		store:   st,
+		cfg:     cfg,
+		replica: replica,
+		sinks:   newSinks(cfg.SMTP),
+		events:  make(chan Event, queueSize),
+		jobs:    make(chan job, queueSize),
+	}
+}
+
+// Load reads the subscriptions from the store.
+func (b *Bus) Load(ctx context.Context) error {
+	subs, err := b.store.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.subs = subs
+	b.mu.Unlock()
+	return nil
+}
+
+// Run delivers published events, reloads subscriptions and prunes the
+// delivery log until ctx is cancelled.
+func (b *Bus) Run(ctx context.Context) {
+	for i := 0; i < workers; i++ {
+		go b.work(ctx)
+	}
+	b.prune(ctx)
+	ticker := time.NewTicker(b.cfg.Interval)
+	defer ticker.Stop()
+	lastPrune := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-b.events:
+			b.dispatch(ctx, ev)
+		case <-ticker.C:
+			if err := b.Load(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("events: reload subscriptions: %v", err)
+			}
+			if time.Since(lastPrune) >= time.Hour {
+				b.prune(ctx)
+				lastPrune = time.Now()
+			}
+		}
+	}
+}
+
+// Publish queues ev for delivery without blocking; it is a no-op on a nil
+// Bus. ID, Time, Severity and Replica are filled in when empty.
+func (b *Bus) Publish(ev Event) {
+	if b == nil {
+		return
+	}
+	if ev.ID == "" {
+		ev.ID = newID()
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.Severity == "" {
+		ev.Severity = SeverityWarning
+	}
+	if ev.Replica == "" {
+		ev.Replica = b.replica
+	}
+	select {
+	case b.events <- ev:
+	default:
+		log.Printf("events: queue full, dropping %s %s", ev.Type, ev.Subject)
+	}
+}
+
+func (b *Bus) dispatch(ctx context.Context, ev Event) {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	for _, sub := range subs {
+		if sub.Disabled || !Matches(sub.Events, ev.Type) {
+			continue
+		}
+		select {
+		case b.jobs <- job{event: ev, sub: sub}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *Bus) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-b.jobs:
+			b.deliver(ctx, j.event, j.sub, b.cfg.MaxAttempts)
+		}
+	}
+}
+
+// deliver sends ev to sub, retrying with exponential backoff, and records
+// the outcome in the delivery log.
+func (b *Bus) deliver(ctx context.Context, ev Event, sub store.EventSubscription, maxAttempts int) store.EventDelivery {
+	d := store.EventDelivery{
+		EventID:      ev.ID,
+		EventType:    ev.Type,
+		Subscription: sub.Name,
+		Sink:         sub.Sink,
+		Replica:      b.replica,
+		CreatedAt:    time.Now(),
+	}
+	snk, ok := b.sinks[sub.Sink]
+	var err error
+	if !ok {
+		err = permanent(fmt.Errorf("unknown sink %q", sub.Sink))
+		d.Attempts = 1
+	}
+	delay := b.cfg.Backoff
+	for ok && d.Attempts < maxAttempts {
+		if d.Attempts > 0 {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-time.After(delay):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			delay = min(delay*2, maxBackoff)
+		}
+		d.Attempts++
+		if err = snk.send(ctx, ev, sub); err == nil || isPermanent(err) {
+			break
+		}
+	}
+	d.FinishedAt = time.Now()
+	d.Status = StatusDelivered
+	if err != nil {
+		d.Status = StatusFailed
+		d.LastError = truncate(err.Error(), maxErrorLen)
+		log.Printf("events: deliver %s to %s (%s) failed after %d attempt(s): %v", ev.Type, sub.Name, sub.Sink, d.Attempts, err)
+	}
+	if errLog := b.store.InsertDelivery(context.WithoutCancel(ctx), &d); errLog != nil {
+		log.Printf("events: %v", errLog)
+	}
+	return d
+}
+
+func (b *Bus) prune(ctx context.Context) {
+	n, err := b.store.DeleteDeliveriesOlderThan(ctx, time.Now().Add(-b.cfg.Retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("events: prune delivery log: %v", err)
+		}
+		return
+	}
+	if n > 0 {
+		log.Printf("events: pruned %d delivery log entries", n)
+	}
+}
+
+// Subscriptions returns the stored subscriptions, without secrets.
+func (b *Bus) Subscriptions(ctx context.Context) ([]store.EventSubscription, error) {
+	subs, err := b.store.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	return subs, nil
+}
+
+// PutSubscription validates and stores sub. Events defaults to every event
+// ("*"); an empty Secret keeps the stored one.
+func (b *Bus) PutSubscription(ctx context.Context, sub store.EventSubscription) error {
+	if !subscriptionNamePattern.MatchString(sub.Name) {
+		return invalidf("invalid subscription name %q", sub.Name)
+	}
+	sub.Sink = strings.ToLower(strings.TrimSpace(sub.Sink))
+	sub.Target = strings.TrimSpace(sub.Target)
+	switch sub.Sink {
+	case store.SinkWebhook, store.SinkSlack:
+		u, err := url.Parse(sub.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalidf("target must be an http(s) URL")
+		}
+	case store.SinkEmail:
+		if b.cfg.SMTP.Addr == "" {
+			return invalidf("email subscriptions need HELIXRUN_SMTP_ADDR")
+		}
+		if _, err := mail.ParseAddressList(sub.Target); err != nil {
+			return invalidf("target must be a comma-separated list of email addresses")
+		}
+	default:
+		return invalidf("unknown sink %q (want %s, %s or %s)", sub.Sink, store.SinkWebhook, store.SinkSlack, store.SinkEmail)
+	}
+	var patterns []string
+	for _, p := range sub.Events {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil || strings.Contains(p, ",") {
+			return invalidf("invalid event pattern %q", p)
+		}
+		patterns = append(patterns, p)
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	sub.Events = patterns
+	if err := b.store.PutSubscription(ctx, sub); err != nil {
+		return err
+	}
+	return b.Load(ctx)
+}
+
+// DeleteSubscription removes a subscription; it returns ErrNotFound when
+// there is none by that name.
+func (b *Bus) DeleteSubscription(ctx context.Context, name string) error {
+	if err := b.store.DeleteSubscription(ctx, name); err != nil {
+		return err
+	}
+	return b.Load(ctx)
+}
+
+// Test sends a test event to the named subscription right away, once, and
+// returns the logged delivery. Disabled subscriptions are tested too.
+func (b *Bus) Test(ctx context.Context, name string) (store.EventDelivery, error) {
+	subs, err := b.store.ListSubscriptions(ctx)
+	if err != nil {
+		return store.EventDelivery{}, err
+	}
+	for _, sub := range subs {
+		if sub.Name != name {
+			continue
+		}
+		ev := Event{
+			ID:       newID(),
+			Type:     TypeTest,
+			Severity: SeverityInfo,
+			Subject:  name,
+			Message:  "Test notification from HelixRun",
+			Replica:  b.replica,
+			Time:     time.Now().UTC(),
+		}
+		return b.deliver(ctx, ev, sub, 1), nil
+	}
+	return store.EventDelivery{}, ErrNotFound
+}
+
+// Deliveries returns delivery log entries, newest first.
+func (b *Bus) Deliveries(ctx context.Context, filter store.EventDeliveryFilter) ([]store.EventDelivery, error) {
+	return b.store.ListDeliveries(ctx, filter)
+}
+
+// Matches reports whether eventType matches one of patterns, which are
+// globs such as "credential.*"; "*" matches every event.
+func Matches(patterns []string, eventType string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, eventType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// permanentError marks a delivery failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+func newID() string {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,214 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// memoryStore is an in-process Store.
+type memoryStore struct {
+	mu         sync.Mutex
+	subs       []store.EventSubscription
+	deliveries []store.EventDelivery
+	cutoff     time.Time
+}
+
+func (m *memoryStore) ListSubscriptions(context.Context) ([]store.EventSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]store.EventSubscription(nil), m.subs...), nil
+}
+
+func (m *memoryStore) PutSubscription(_ context.Context, sub store.EventSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.subs {
+		if m.subs[i].Name == sub.Name {
+			m.subs[i] = sub
+			return nil
+		}
+	}
+	m.subs = append(m.subs, sub)
+	return nil
+}
+
+func (m *memoryStore) DeleteSubscription(_ context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.subs {
+		if m.subs[i].Name == name {
+			m.subs = append(m.subs[:i], m.subs[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (m *memoryStore) InsertDelivery(_ context.Context, d *store.EventDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d.ID = int64(len(m.deliveries) + 1)
+	m.deliveries = append(m.deliveries, *d)
+	return nil
+}
+
+func (m *memoryStore) ListDeliveries(context.Context, store.EventDeliveryFilter) ([]store.EventDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]store.EventDelivery(nil), m.deliveries...), nil
+}
+
+func (m *memoryStore) DeleteDeliveriesOlderThan(_ context.Context, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cutoff = cutoff
+	var kept []store.EventDelivery
+	for _, d := range m.deliveries {
+		if !d.CreatedAt.Before(cutoff) {
+			kept = append(kept, d)
+		}
+	}
+	n := int64(len(m.deliveries) - len(kept))
+	m.deliveries = kept
+	return n, nil
+}
+
+func TestSignKnownVector(t *testing.T) {
+	// echo -n '1700000000.{"id":"evt_1","type":"test"}' | openssl dgst -sha256 -hmac whsec_test
+	got := Sign("whsec_test", "1700000000", []byte(`{"id":"evt_1","type":"test"}`))
+	want := "d4fb8d102f27df0beb72ba45826cf091ff7435e19aef5b4af979109b89e2a836"
+	if got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookDeliveryRetriesAndSigns(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+		ts := r.Header.Get(HeaderTimestamp)
+		if got, want := r.Header.Get(HeaderSignature), "sha256="+Sign("s3cret", ts, body); got != want {
+			t.Errorf("attempt %d: %s = %q, want %q", n, HeaderSignature, got, want)
+		}
+		if got := r.Header.Get(HeaderEvent); got != TypeStoreUnavailable {
+			t.Errorf("attempt %d: %s = %q, want %q", n, HeaderEvent, got, TypeStoreUnavailable)
+		}
+		var ev Event
+		if err := json.Unmarshal(body, &ev); err != nil || ev.ID != "evt_1" {
+			t.Errorf("attempt %d: body %s does not carry the event: %v", n, body, err)
+		}
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	st := &memoryStore{}
+	b := New(st, Config{Backoff: time.Millisecond})
+	sub := store.EventSubscription{Name: "ops", Sink: store.SinkWebhook, Target: srv.URL, Secret: "s3cret", Events: []string{"*"}}
+	d := b.deliver(context.Background(), Event{ID: "evt_1", Type: TypeStoreUnavailable}, sub, 3)
+
+	if d.Status != StatusDelivered || d.Attempts != 2 || d.LastError != "" {
+		t.Fatalf("delivery = %s after %d attempt(s) (%q), want delivered after 2", d.Status, d.Attempts, d.LastError)
+	}
+	if requests != 2 {
+		t.Fatalf("server saw %d requests, want 2", requests)
+	}
+	if logged, _ := st.ListDeliveries(context.Background(), store.EventDeliveryFilter{}); len(logged) != 1 || logged[0].Status != StatusDelivered {
+		t.Fatalf("delivery log = %+v, want one delivered entry", logged)
+	}
+}
+
+func TestWebhookDeliveryStopsOnClientError(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	b := New(&memoryStore{}, Config{Backoff: time.Millisecond})
+	sub := store.EventSubscription{Name: "ops", Sink: store.SinkWebhook, Target: srv.URL}
+	d := b.deliver(context.Background(), Event{ID: "evt_1", Type: TypeTest}, sub, 3)
+
+	if d.Status != StatusFailed || d.Attempts != 1 || requests != 1 {
+		t.Fatalf("delivery = %s after %d attempt(s), %d request(s); want failed after 1", d.Status, d.Attempts, requests)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		patterns  []string
+		eventType string
+		want      bool
+	}{
+		{[]string{"*"}, TypeCredentialExpired, true},
+		{[]string{"credential.*"}, TypeCredentialRefreshFailed, true},
+		{[]string{"credential.*"}, TypeStoreUnavailable, false},
+		{[]string{"store.*", TypeConfigReloadFailed}, TypeConfigReloadFailed, true},
+		{[]string{TypeCredentialExpired}, TypeCredentialRefreshFailed, false},
+		{nil, TypeTest, false},
+	}
+	for _, tt := range tests {
+		if got := Matches(tt.patterns, tt.eventType); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", tt.patterns, tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestDispatchSkipsDisabledAndUnmatchedSubscriptions(t *testing.T) {
+	st := &memoryStore{subs: []store.EventSubscription{
+		{Name: "all", Sink: store.SinkWebhook, Events: []string{"*"}},
+		{Name: "credentials", Sink: store.SinkSlack, Events: []string{"credential.*"}},
+		{Name: "store", Sink: store.SinkWebhook, Events: []string{"store.*"}},
+		{Name: "muted", Sink: store.SinkWebhook, Events: []string{"*"}, Disabled: true},
+	}}
+	b := New(st, Config{})
+	if err := b.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	b.dispatch(context.Background(), Event{Type: TypeCredentialExpired})
+	close(b.jobs)
+
+	var got []string
+	for j := range b.jobs {
+		got = append(got, j.sub.Name)
+	}
+	if len(got) != 2 || got[0] != "all" || got[1] != "credentials" {
+		t.Fatalf("dispatched to %q, want [all credentials]", got)
+	}
+}
+
+func TestPruneDropsDeliveriesPastRetention(t *testing.T) {
+	now := time.Now()
+	st := &memoryStore{deliveries: []store.EventDelivery{
+		{EventID: "old", CreatedAt: now.Add(-49 * time.Hour)},
+		{EventID: "recent", CreatedAt: now.Add(-47 * time.Hour)},
+	}}
+	b := New(st, Config{Retention: 48 * time.Hour})
+	b.prune(context.Background())
+
+	if len(st.deliveries) != 1 || st.deliveries[0].EventID != "recent" {
+		t.Fatalf("delivery log = %+v, want only the recent entry", st.deliveries)
+	}
+	if age := now.Sub(st.cutoff); age < 48*time.Hour-time.Minute || age > 48*time.Hour+time.Minute {
+		t.Fatalf("cutoff is %s old, want the 48h retention", age)
+	}
+}
@@ -0,0 +1,203 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+const sendTimeout = 10 * time.Second
+
+// Webhook headers.
+const (
+	HeaderEvent     = "X-HelixRun-Event"
+	HeaderDelivery  = "X-HelixRun-Delivery"
+	HeaderTimestamp = "X-HelixRun-Timestamp"
+	// HeaderSignature is "sha256=" followed by the hex HMAC-SHA256 of
+	// "<timestamp>.<body>" keyed with the subscription secret.
+	HeaderSignature = "X-HelixRun-Signature"
+)
+
+type sink interface {
+	send(ctx context.Context, ev Event, sub store.EventSubscription) error
+}
+
+func newSinks(smtpCfg SMTPConfig) map[string]sink {
+	client := &http.Client{Timeout: sendTimeout}
+	return map[string]sink{
+		store.SinkWebhook: webhookSink{client: client},
+		store.SinkSlack:   slackSink{client: client},
+		store.SinkEmail:   emailSink{cfg: smtpCfg},
+	}
+}
+
+// webhookSink posts the event as JSON, signed when the subscription has a secret.
+type webhookSink struct {
+	client *http.Client
+}
+
+func (s webhookSink) send(ctx context.Context, ev Event, sub store.EventSubscription) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return permanent(err)
+	}
+	header := http.Header{}
+	header.Set(HeaderEvent, ev.Type)
+	header.Set(HeaderDelivery, ev.ID)
+	if sub.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		header.Set(HeaderTimestamp, ts)
+		header.Set(HeaderSignature, "sha256="+Sign(sub.Secret, ts, body))
+	}
+	return post(ctx, s.client, sub.Target, body, header)
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with secret,
+// as sent in the X-HelixRun-Signature header.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// slackSink posts a Slack incoming-webhook payload; Mattermost, Rocket.Chat
+// and Discord's /slack endpoints accept it too.
+type slackSink struct {
+	client *http.Client
+}
+
+func (s slackSink) send(ctx context.Context, ev Event, sub store.EventSubscription) error {
+	text := fmt.Sprintf("%s *%s*", severityIcon(ev.Severity), ev.Type)
+	if ev.Subject != "" {
+		text += " `" + ev.Subject + "`"
+	}
+	text += "\n" + ev.Message
+	if ev.Replica != "" {
+		text += "\n_" + ev.Replica + " · " + ev.Time.Format(time.RFC3339) + "_"
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return permanent(err)
+	}
+	return post(ctx, s.client, sub.Target, body, nil)
+}
+
+func severityIcon(severity string) string {
+	switch severity {
+	case SeverityCritical:
+		return ":rotating_light:"
+	case SeverityWarning:
+		return ":warning:"
+	default:
+		return ":information_source:"
+	}
+}
+
+// post sends body as JSON. 4xx responses other than 408 and 429 are not retried.
+func post(ctx context.Context, client *http.Client, target string, body []byte, header http.Header) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return permanent(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "HelixRun-Events/1")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("%s responded %s", target, resp.Status)
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return permanent(err)
+	}
+	return err
+}
+
+// emailSink sends a plain-text mail through the configured SMTP server,
+// using STARTTLS when the server offers it.
+type emailSink struct {
+	cfg SMTPConfig
+}
+
+func (s emailSink) send(ctx context.Context, ev Event, sub store.EventSubscription) error {
+	if s.cfg.Addr == "" {
+		return permanent(fmt.Errorf("SMTP is not configured"))
+	}
+	list, err := mail.ParseAddressList(sub.Target)
+	if err != nil {
+		return permanent(err)
+	}
+	to := make([]string, 0, len(list))
+	for _, a := range list {
+		to = append(to, a.Address)
+	}
+	from := s.cfg.From
+	if from == "" {
+		from = s.cfg.Username
+	}
+	subject := fmt.Sprintf("[HelixRun] %s", ev.Type)
+	if ev.Subject != "" {
+		subject += ": " + ev.Subject
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mimeHeader(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", ev.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nSeverity: %s\r\nEvent: %s\r\n", ev.Message, ev.Severity, ev.ID)
+	if ev.Replica != "" {
+		fmt.Fprintf(&msg, "Replica: %s\r\n", ev.Replica)
+	}
+	fmt.Fprintf(&msg, "Time: %s\r\n", ev.Time.Format(time.RFC3339))
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		host, _, _ := net.SplitHostPort(s.cfg.Addr)
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host)
+	}
+	// net/smtp has no context support; run it with a deadline instead.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.cfg.Addr, auth, from, to, msg.Bytes())
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(2 * sendTimeout):
+		return fmt.Errorf("smtp %s: timed out", s.cfg.Addr)
+	}
+}
+
+// mimeHeader flattens s to one line and encodes it when it is not ASCII.
+func mimeHeader(s string) string {
+	return mime.QEncoding.Encode("utf-8", strings.NewReplacer("\r", " ", "\n", " ").Replace(s))
+}
@@ -0,0 +1,392 @@
+// Package healthprobe checks that stored credentials actually work by sending
+// a one-token completion through the embedded CLIProxy auth manager, pinned
+// to one credential at a time.
+//
+// Probes run through the same executors, translators and round trippers as
+// proxied traffic, so a failing probe also puts the credential into the
+// manager's usual cooldown and reaches the auth manager hooks.
+package healthprobe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cliproxysdk "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+	sdktranslator "github.com/router-for-me/CLIProxyAPI/v6/sdk/translator"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/tokenrefresh"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+const (
+	defaultTimeout     = 30 * time.Second
+	defaultConcurrency = 4
+	probePrompt        = "Reply with OK."
+)
+
+// Badges summarise the last probe of a credential.
+const (
+	// BadgeHealthy means the last probe succeeded.
+	BadgeHealthy = "healthy"
+	// BadgeDegraded means the credential works but is rate limited, slow or
+	// the provider failed upstream.
+	BadgeDegraded = "degraded"
+	// BadgeFailing means the credential cannot serve requests as it is.
+	BadgeFailing = "failing"
+)
+
+// Error classes of a failed probe.
+const (
+	// ClassAuth is a 401/403: the credential was revoked or needs a new login.
+	ClassAuth = "auth"
+	// ClassQuota is a 429 or quota cooldown.
+	ClassQuota = "quota"
+	// ClassUpstream is a 5xx from the provider.
+	ClassUpstream = "upstream"
+	// ClassTimeout means the probe did not finish within Config.Timeout.
+	ClassTimeout = "timeout"
+	// ClassRequest is any other 4xx, typically a model the account cannot use.
+	ClassRequest = "request"
+	// ClassNetwork is a failure without an HTTP status.
+	ClassNetwork = "network"
+	// ClassNoModel means no model is registered for the credential.
+	ClassNoModel = "no_model"
+	// ClassNotLoaded means CLIProxy has not loaded the stored credential.
+	ClassNotLoaded = "not_loaded"
+)
+
+// modelPreference ranks model names by how cheap a probe with them usually is.
+var modelPreference = []string{"lite", "flash", "mini", "haiku", "turbo"}
+
+// Config tunes the prober.
+type Config struct {
+	// Interval between background probes of every credential; zero only
+	// probes on request.
+	Interval time.Duration
+	// Timeout bounds a single probe; default 30s.
+	Timeout time.Duration
+	// Concurrency caps parallel probes; default 4.
+	Concurrency int
+	// Models overrides the probe model per CLIProxy provider key, e.g.
+	// "gemini-cli" to "gemini-2.5-flash". Other providers use a small
+	// registered model.
+	Models map[string]string
+}
+
+// Result is the outcome of the last probe of one credential.
+type Result struct {
+	ID            string     `json:"id"`
+	Provider      string     `json:"provider"`
+	Label         string     `json:"label,omitempty"`
+	Model         string     `json:"model,omitempty"`
+	Status        string     `json:"status"`
+	LatencyMS     int64      `json:"latency_ms"`
+	CheckedAt     time.Time  `json:"checked_at"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	ErrorClass    string     `json:"error_class,omitempty"`
+	HTTPStatus    int        `json:"http_status,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// Prober probes credentials listed by a source through the auth manager.
+// The manager must be created with Selector so probes reach the credential
+// under test.
+type Prober struct {
+	cfg     Config
+	source  tokenrefresh.Source
+	manager *coreauth.Manager
+	running atomic.Bool
+
+	mu        sync.Mutex
+	results   map[string]*Result
+	lastCheck time.Time
+}
+
+// New creates a prober for the credentials listed by source.
+func New(cfg Config, source tokenrefresh.Source, manager *coreauth.Manager) *Prober {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+	return &Prober{
+		cfg:     cfg,
+		source:  source,
+		manager: manager,
+		results: make(map[string]*Result),
+	}
+}
+
+// Run probes every credential each cfg.Interval until ctx is cancelled. It
+// returns immediately when the interval is zero.
+func (p *Prober) Run(ctx context.Context) {
+	if p.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.ProbeAll(ctx); err != nil {
+				log.Printf("credential probe: %v", err)
+			}
+		}
+	}
+}
+
+// ProbeAll probes every enabled credential and forgets results of credentials
+// that are gone. Overlapping calls return ErrRunning.
+func (p *Prober) ProbeAll(ctx context.Context) error {
+	if !p.running.CompareAndSwap(false, true) {
+		return ErrRunning
+	}
+	defer p.running.Store(false)
+
+	disabled := false
+	summaries, err := p.source(ctx, store.AuthFilter{Disabled: &disabled})
+	if err != nil {
+		return fmt.Errorf("list credentials: %w", err)
+	}
+	sem := make(chan struct{}, p.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for _, sum := range summaries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(sum store.AuthSummary) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			p.probe(ctx, sum)
+		}(sum)
+	}
+	wg.Wait()
+
+	seen := make(map[string]struct{}, len(summaries))
+	for _, sum := range summaries {
+		seen[sum.ID] = struct{}{}
+	}
+	failing := 0
+	p.mu.Lock()
+	for id, res := range p.results {
+		if _, ok := seen[id]; !ok {
+			delete(p.results, id)
+		} else if res.Status == BadgeFailing {
+			failing++
+		}
+	}
+	p.lastCheck = time.Now()
+	p.mu.Unlock()
+	if failing > 0 {
+		log.Printf("credential probe: %d of %d credential(s) failing", failing, len(summaries))
+	}
+	return nil
+}
+
+var (
+	// ErrRunning is returned by ProbeAll while another full run is in progress.
+	ErrRunning = errors.New("a credential probe run is already in progress")
+	// ErrNotFound is returned by Probe for an unknown credential id.
+	ErrNotFound = errors.New("credential not found")
+)
+
+// Probe probes the credential with the given id and returns the result.
+func (p *Prober) Probe(ctx context.Context, id string) (Result, error) {
+	summaries, err := p.source(ctx, store.AuthFilter{})
+	if err != nil {
+		return Result{}, fmt.Errorf("list credentials: %w", err)
+	}
+	for _, sum := range summaries {
+		if sum.ID == id {
+			return p.probe(ctx, sum), nil
+		}
+	}
+	return Result{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+func (p *Prober) probe(ctx context.Context, sum store.AuthSummary) Result {
+	res := Result{ID: sum.ID, Provider: sum.Provider, Label: sum.Label, CheckedAt: time.Now()}
+	auth, ok := p.manager.GetByID(sum.ID)
+	switch {
+	case !ok || auth == nil:
+		res.ErrorClass, res.Error = ClassNotLoaded, "credential is stored but not loaded by CLIProxy"
+	case auth.Disabled:
+		res.ErrorClass, res.Error = ClassNotLoaded, "credential is disabled in CLIProxy"
+	default:
+		if res.Model = p.modelFor(auth); res.Model == "" {
+			res.ErrorClass, res.Error = ClassNoModel, "no model registered for this credential"
+			break
+		}
+		probeCtx, cancel := context.WithTimeout(withPin(ctx, auth.ID), p.cfg.Timeout)
+		start := time.Now()
+		err := p.execute(probeCtx, auth.Provider, res.Model)
+		res.LatencyMS = time.Since(start).Milliseconds()
+		if err != nil {
+			res.ErrorClass, res.HTTPStatus = classify(probeCtx, err)
+			res.Error = err.Error()
+		}
+		cancel()
+	}
+	if res.ErrorClass == "" {
+		res.Status = BadgeHealthy
+		res.LastSuccessAt = &res.CheckedAt
+	} else {
+		res.Status = badgeFor(res.ErrorClass)
+	}
+
+	p.mu.Lock()
+	if prev := p.results[sum.ID]; prev != nil && res.LastSuccessAt == nil {
+		res.LastSuccessAt = prev.LastSuccessAt
+	}
+	stored := res
+	p.results[sum.ID] = &stored
+	p.mu.Unlock()
+	return res
+}
+
+// execute sends a one-token OpenAI-format chat completion, which every
+// provider executor translates into its own upstream format.
+func (p *Prober) execute(ctx context.Context, provider, model string) error {
+	payload, err := json.Marshal(map[string]any{
+		"model":      model,
+		"messages":   []map[string]string{{"role": "user", "content": probePrompt}},
+		"max_tokens": 1,
+		"stream":     false,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.manager.Execute(ctx, []string{provider}, cliproxyexecutor.Request{
+		Model:   model,
+		Payload: payload,
+	}, cliproxyexecutor.Options{
+		OriginalRequest: payload,
+		SourceFormat:    sdktranslator.FromString("openai"),
+	})
+	return err
+}
+
+// modelFor returns the configured probe model for the provider, or the
+// cheapest-looking model the registry lists for the credential.
+func (p *Prober) modelFor(auth *coreauth.Auth) string {
+	if model := p.cfg.Models[strings.ToLower(auth.Provider)]; model != "" {
+		return model
+	}
+	registry := cliproxysdk.GlobalModelRegistry()
+	var candidates []string
+	for _, info := range registry.GetAvailableModels("openai") {
+		id, _ := info["id"].(string)
+		if id != "" && registry.ClientSupportsModel(auth.ID, id) {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	for _, hint := range modelPreference {
+		for _, id := range candidates {
+			if strings.Contains(strings.ToLower(id), hint) {
+				return id
+			}
+		}
+	}
+	return candidates[0]
+}
+
+// classify maps a probe error to its error class and HTTP status, if any.
+func classify(ctx context.Context, err error) (string, int) {
+	var statusErr interface{ StatusCode() int }
+	status := 0
+	if errors.As(err, &statusErr) {
+		status = statusErr.StatusCode()
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ClassAuth, status
+	case status == http.StatusTooManyRequests:
+		return ClassQuota, status
+	case status >= 500:
+		return ClassUpstream, status
+	case status >= 400:
+		return ClassRequest, status
+	case errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil:
+		return ClassTimeout, status
+	default:
+		return ClassNetwork, status
+	}
+}
+
+func badgeFor(class string) string {
+	switch class {
+	case ClassQuota, ClassUpstream, ClassTimeout:
+		return BadgeDegraded
+	default:
+		return BadgeFailing
+	}
+}
+
+// Results returns the last probe result of every credential, ordered by id,
+// and the time the last full run finished.
+func (p *Prober) Results() ([]Result, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]Result, 0, len(p.results))
+	for _, res := range p.results {
+		out = append(out, *res)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, p.lastCheck
+}
+
+// Running reports whether a full probe run is in progress.
+func (p *Prober) Running() bool {
+	return p.running.Load()
+}
+
+type pinKey struct{}
+
+// withPin makes Selector pick the credential id for requests made with ctx.
+func withPin(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, pinKey{}, id)
+}
+
+// Selector wraps next (round-robin when nil) so that probes are routed to
+// the credential under test. Other requests are passed through unchanged.
+func Selector(next coreauth.Selector) coreauth.Selector {
+	if next == nil {
+		next = &coreauth.RoundRobinSelector{}
+	}
+	return pinnedSelector{next: next}
+}
+
+type pinnedSelector struct {
+	next coreauth.Selector
+}
+
+// Pick returns the pinned credential, ignoring cooldowns so that a probe can
+// tell when a cooling-down credential works again.
+func (s pinnedSelector) Pick(ctx context.Context, provider, model string, opts cliproxyexecutor.Options, auths []*coreauth.Auth) (*coreauth.Auth, error) {
+	id, ok := ctx.Value(pinKey{}).(string)
+	if !ok {
+		return s.next.Pick(ctx, provider, model, opts, auths)
+	}
+	for _, auth := range auths {
+		if auth != nil && auth.ID == id {
+			return auth, nil
+		}
+	}
+	return nil, &coreauth.Error{Code: "auth_not_found", Message: "probed credential is not available"}
+}
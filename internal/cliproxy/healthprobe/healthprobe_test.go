@@ -0,0 +1,161 @@
+package healthprobe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	cliproxysdk "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+	cliproxyexecutor "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/executor"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+func TestClassify(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		err        error
+		wantClass  string
+		wantStatus int
+		wantBadge  string
+	}{
+		{"unauthorized", context.Background(), &coreauth.Error{HTTPStatus: 401}, ClassAuth, 401, BadgeFailing},
+		{"forbidden", context.Background(), &coreauth.Error{HTTPStatus: 403}, ClassAuth, 403, BadgeFailing},
+		{"rate limited", context.Background(), &coreauth.Error{HTTPStatus: 429}, ClassQuota, 429, BadgeDegraded},
+		{"bad gateway", context.Background(), &coreauth.Error{HTTPStatus: 502}, ClassUpstream, 502, BadgeDegraded},
+		{"unavailable", context.Background(), &coreauth.Error{HTTPStatus: 503}, ClassUpstream, 503, BadgeDegraded},
+		{"unknown model", context.Background(), &coreauth.Error{HTTPStatus: 404}, ClassRequest, 404, BadgeFailing},
+		{"bad request", context.Background(), &coreauth.Error{HTTPStatus: 400}, ClassRequest, 400, BadgeFailing},
+		{"wrapped status", context.Background(), fmt.Errorf("execute: %w", &coreauth.Error{HTTPStatus: 401}), ClassAuth, 401, BadgeFailing},
+		{"deadline", context.Background(), context.DeadlineExceeded, ClassTimeout, 0, BadgeDegraded},
+		{"probe context expired", expired, errors.New("read: connection reset"), ClassTimeout, 0, BadgeDegraded},
+		{"status wins over expired context", expired, &coreauth.Error{HTTPStatus: 429}, ClassQuota, 429, BadgeDegraded},
+		{"dial failure", context.Background(), &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ClassNetwork, 0, BadgeFailing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, status := classify(tt.ctx, tt.err)
+			if class != tt.wantClass || status != tt.wantStatus {
+				t.Fatalf("classify = %s, %d; want %s, %d", class, status, tt.wantClass, tt.wantStatus)
+			}
+			if badge := badgeFor(class); badge != tt.wantBadge {
+				t.Fatalf("badgeFor(%s) = %s, want %s", class, badge, tt.wantBadge)
+			}
+		})
+	}
+}
+
+func TestBadgeForSetupFailures(t *testing.T) {
+	for _, class := range []string{ClassNoModel, ClassNotLoaded} {
+		if badge := badgeFor(class); badge != BadgeFailing {
+			t.Errorf("badgeFor(%s) = %s, want %s", class, badge, BadgeFailing)
+		}
+	}
+}
+
+// fakeExecutor answers probes with the error configured per credential.
+type fakeExecutor struct {
+	errs map[string]error
+}
+
+func (e fakeExecutor) Identifier() string { return "codex" }
+
+func (e fakeExecutor) Execute(_ context.Context, auth *coreauth.Auth, _ cliproxyexecutor.Request, _ cliproxyexecutor.Options) (cliproxyexecutor.Response, error) {
+	if err := e.errs[auth.ID]; err != nil {
+		return cliproxyexecutor.Response{}, err
+	}
+	return cliproxyexecutor.Response{Payload: []byte(`{"choices":[]}`)}, nil
+}
+
+func (e fakeExecutor) ExecuteStream(context.Context, *coreauth.Auth, cliproxyexecutor.Request, cliproxyexecutor.Options) (<-chan cliproxyexecutor.StreamChunk, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (e fakeExecutor) Refresh(_ context.Context, auth *coreauth.Auth) (*coreauth.Auth, error) {
+	return auth, nil
+}
+
+func (e fakeExecutor) CountTokens(context.Context, *coreauth.Auth, cliproxyexecutor.Request, cliproxyexecutor.Options) (cliproxyexecutor.Response, error) {
+	return cliproxyexecutor.Response{}, errors.New("not implemented")
+}
+
+func TestProbeAllRecordsResults(t *testing.T) {
+	ctx := context.Background()
+	exec := fakeExecutor{errs: map[string]error{
+		"revoked.json": &coreauth.Error{HTTPStatus: 401, Message: "invalid_grant"},
+		"limited.json": &coreauth.Error{HTTPStatus: 429, Message: "rate limited"},
+	}}
+	manager := coreauth.NewManager(nil, Selector(nil), nil)
+	manager.RegisterExecutor(exec)
+	registry := cliproxysdk.GlobalModelRegistry()
+	for _, id := range []string{"ok.json", "revoked.json", "limited.json"} {
+		if _, err := manager.Register(ctx, &coreauth.Auth{ID: id, Provider: "codex"}); err != nil {
+			t.Fatal(err)
+		}
+		registry.RegisterClient(id, "codex", []*cliproxysdk.ModelInfo{
+			{ID: "gpt-5", Object: "model", OwnedBy: "openai", Type: "openai"},
+			{ID: "gpt-5-mini", Object: "model", OwnedBy: "openai", Type: "openai"},
+		})
+		t.Cleanup(func() { registry.UnregisterClient(id) })
+	}
+	summaries := []store.AuthSummary{
+		{ID: "ok.json", AuthMeta: store.AuthMeta{Provider: "codex"}},
+		{ID: "revoked.json", AuthMeta: store.AuthMeta{Provider: "codex"}},
+		{ID: "limited.json", AuthMeta: store.AuthMeta{Provider: "codex"}},
+		{ID: "unloaded.json", AuthMeta: store.AuthMeta{Provider: "codex"}},
+	}
+	source := func(context.Context, store.AuthFilter) ([]store.AuthSummary, error) { return summaries, nil }
+	p := New(Config{}, source, manager)
+
+	if err := p.ProbeAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	results, lastCheck := p.Results()
+	if lastCheck.IsZero() {
+		t.Fatal("last check time not set")
+	}
+	want := map[string]struct{ status, class string }{
+		"ok.json":       {BadgeHealthy, ""},
+		"revoked.json":  {BadgeFailing, ClassAuth},
+		"limited.json":  {BadgeDegraded, ClassQuota},
+		"unloaded.json": {BadgeFailing, ClassNotLoaded},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v, want %d", results, len(want))
+	}
+	for _, res := range results {
+		w := want[res.ID]
+		if res.Status != w.status || res.ErrorClass != w.class {
+			t.Errorf("%s: %s/%q (%s), want %s/%q", res.ID, res.Status, res.ErrorClass, res.Error, w.status, w.class)
+		}
+		if res.ErrorClass != ClassNotLoaded && res.Model != "gpt-5-mini" {
+			t.Errorf("%s: probed with %q, want the cheaper gpt-5-mini", res.ID, res.Model)
+		}
+		if (res.Status == BadgeHealthy) != (res.LastSuccessAt != nil) {
+			t.Errorf("%s: last success %v with status %s", res.ID, res.LastSuccessAt, res.Status)
+		}
+	}
+
+	// A credential that starts failing keeps its last success; a removed
+	// credential is forgotten.
+	exec.errs["ok.json"] = &coreauth.Error{HTTPStatus: 503}
+	summaries = summaries[:1]
+	if err := p.ProbeAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	results, _ = p.Results()
+	if len(results) != 1 || results[0].ID != "ok.json" {
+		t.Fatalf("results = %+v, want only ok.json", results)
+	}
+	if res := results[0]; res.Status != BadgeDegraded || res.ErrorClass != ClassUpstream || res.HTTPStatus != 503 || res.LastSuccessAt == nil {
+		t.Fatalf("ok.json = %+v, want degraded upstream failure with the earlier success kept", res)
+	}
+}
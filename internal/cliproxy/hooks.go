@@ -0,0 +1,73 @@
+package cliproxy
+
+import (
+	"context"
+	"fmt"
+
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/events"
+	authstore "helixrun-cliproxy-starter/internal/store"
+)
+
+// hookChain fans auth manager callbacks out to several hooks, in order.
+type hookChain []coreauth.Hook
+
+// chainHooks combines the non-nil hooks; it returns nil when there are none.
+func chainHooks(hooks ...coreauth.Hook) coreauth.Hook {
+	var chain hookChain
+	for _, h := range hooks {
+		if h != nil {
+			chain = append(chain, h)
+		}
+	}
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	}
+	return chain
+}
+
+func (c hookChain) OnAuthRegistered(ctx context.Context, auth *coreauth.Auth) {
+	for _, h := range c {
+		h.OnAuthRegistered(ctx, auth)
+	}
+}
+
+func (c hookChain) OnAuthUpdated(ctx context.Context, auth *coreauth.Auth) {
+	for _, h := range c {
+		h.OnAuthUpdated(ctx, auth)
+	}
+}
+
+func (c hookChain) OnResult(ctx context.Context, result coreauth.Result) {
+	for _, h := range c {
+		h.OnResult(ctx, result)
+	}
+}
+
+// storeHealthEvent describes a token store health transition.
+func storeHealthEvent(backend string, h authstore.BackendHealth, prev *authstore.BackendHealth) events.Event {
+	if h.Healthy {
+		failures := 0
+		if prev != nil {
+			failures = prev.ConsecutiveFailures
+		}
+		return events.Event{
+			Type:     events.TypeStoreRecovered,
+			Severity: events.SeverityInfo,
+			Subject:  backend,
+			Message:  fmt.Sprintf("token store is healthy again after %d failed check(s)", failures),
+			Data:     map[string]any{"latency_ms": h.LatencyMS},
+		}
+	}
+	return events.Event{
+		Type:     events.TypeStoreUnavailable,
+		Severity: events.SeverityCritical,
+		Subject:  backend,
+		Message:  "token store is unreachable, writes are queued in the outbox: " + h.LastError,
+		Data:     map[string]any{"last_error": h.LastError},
+	}
+}
@@ -0,0 +1,373 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	activityBacklog       = 100
+	activitySubscriberBuf = 64
+	activityHeartbeat     = 15 * time.Second
+	// maxUsageLine bounds the SSE line or JSON body inspected for token usage.
+	maxUsageLine = 1 << 20
+	// maxActivityModelPrefix bounds the request body read to find the model.
+	maxActivityModelPrefix = 16 << 10
+)
+
+// ActivityEvent is a sanitized summary of one request proxied through
+// /cliproxy: no bodies, no headers, and only a hint of the API key.
+type ActivityEvent struct {
+	ID               uint64    `json:"id"`
+	Time             time.Time `json:"time"`
+	Method           string    `json:"method"`
+	Path             string    `json:"path"`
+	APIKey           string    `json:"api_key,omitempty"`
+	Model            string    `json:"model,omitempty"`
+	Status           int       `json:"status"`
+	LatencyMS        int64     `json:"latency_ms"`
+	Stream           bool      `json:"stream,omitempty"`
+	Cache            string    `json:"cache,omitempty"`
+	PromptTokens     int64     `json:"prompt_tokens,omitempty"`
+	CompletionTokens int64     `json:"completion_tokens,omitempty"`
+	TotalTokens      int64     `json:"total_tokens,omitempty"`
+}
+
+// activityFeed broadcasts request summaries to the admin live view and keeps
+// the most recent ones for viewers that connect later.
+type activityFeed struct {
+	mu      sync.Mutex
+	nextID  uint64
+	backlog []ActivityEvent
+	subs    map[chan ActivityEvent]struct{}
+	closed  bool
+	dropped atomic.Int64
+}
+
+func newActivityFeed() *activityFeed {
+	return &activityFeed{subs: make(map[chan ActivityEvent]struct{})}
+}
+
+func (f *activityFeed) publish(ev ActivityEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	ev.ID = f.nextID
+	if len(f.backlog) == activityBacklog {
+		copy(f.backlog, f.backlog[1:])
+		f.backlog = f.backlog[:activityBacklog-1]
+	}
+	f.backlog = append(f.backlog, ev)
+	for ch := range f.subs {
+		select {
+		case ch <- ev:
+		default:
+			// A viewer that cannot keep up misses events rather than slowing the proxy.
+			f.dropped.Add(1)
+		}
+	}
+}
+
+// subscribe returns a channel of new events and the backlog after sinceID.
+// The channel is closed by unsubscribe or when the feed shuts down.
+func (f *activityFeed) subscribe(sinceID uint64) (chan ActivityEvent, []ActivityEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan ActivityEvent, activitySubscriberBuf)
+	if f.closed {
+		close(ch)
+		return ch, nil
+	}
+	f.subs[ch] = struct{}{}
+	var recent []ActivityEvent
+	for _, ev := range f.backlog {
+		if ev.ID > sinceID {
+			recent = append(recent, ev)
+		}
+	}
+	return ch, recent
+}
+
+func (f *activityFeed) unsubscribe(ch chan ActivityEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// close ends every stream so shutdown does not wait for idle viewers.
+func (f *activityFeed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for ch := range f.subs {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+func (f *activityFeed) recent() []ActivityEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ActivityEvent{}, f.backlog...)
+}
+
+func (f *activityFeed) subscribers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs)
+}
+
+// middleware publishes a summary of every API request served below /cliproxy.
+// Token counts are read from the usage blocks of OpenAI, Claude and Gemini
+// responses, streamed or not, as they pass through.
+func (f *activityFeed) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/cliproxy")
+		if !isAPIPath(path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var reqBody []byte
+		if r.Body != nil {
+			// Only a prefix is needed to find the model; the rest streams through.
+			reqBody, _ = io.ReadAll(io.LimitReader(r.Body, maxActivityModelPrefix))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+		}
+		start := time.Now()
+		uw := &usageWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(uw, r)
+		uw.finish()
+
+		ev := ActivityEvent{
+			Time:             start,
+			Method:           r.Method,
+			Path:             path,
+			APIKey:           apiKeyHint(r.Header),
+			Model:            modelFromRequest(path, reqBody),
+			Status:           uw.status,
+			LatencyMS:        time.Since(start).Milliseconds(),
+			Stream:           uw.stream,
+			Cache:            w.Header().Get(cacheHeader),
+			PromptTokens:     uw.usage.prompt,
+			CompletionTokens: uw.usage.completion,
+			TotalTokens:      uw.usage.total,
+		}
+		if ev.TotalTokens == 0 {
+			ev.TotalTokens = ev.PromptTokens + ev.CompletionTokens
+		}
+		f.publish(ev)
+	})
+}
+
+func (f *activityFeed) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	// The server's write timeout would cut the stream after a minute.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	var sinceID uint64
+	if raw := r.Header.Get("Last-Event-ID"); raw != "" {
+		_, _ = fmt.Sscan(raw, &sinceID)
+	}
+	ch, recent := f.subscribe(sinceID)
+	defer f.unsubscribe(ch)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, ev := range recent {
+		writeActivity(w, ev)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(activityHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeActivity(w, ev)
+			flusher.Flush()
+		case <-heartbeat.C:
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeActivity(w io.Writer, ev ActivityEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "id: %d\nevent: request\ndata: %s\n\n", ev.ID, data)
+}
+
+// tokenUsage keeps the largest count seen per field: streams report input and
+// output in different chunks (Claude) or cumulatively (Gemini).
+type tokenUsage struct {
+	prompt, completion, total int64
+}
+
+func (u *tokenUsage) merge(prompt, completion, total int64) {
+	u.prompt = max(u.prompt, prompt)
+	u.completion = max(u.completion, completion)
+	u.total = max(u.total, total)
+}
+
+// usageWriter passes the response through while scanning it for token usage.
+type usageWriter struct {
+	http.ResponseWriter
+	status  int
+	stream  bool
+	skip    bool
+	started bool
+	line    bytes.Buffer
+	usage   tokenUsage
+}
+
+func (w *usageWriter) WriteHeader(status int) {
+	if !w.started {
+		w.start(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *usageWriter) start(status int) {
+	w.started = true
+	w.status = status
+	h := w.Header()
+	w.stream = strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+	enc := h.Get("Content-Encoding")
+	w.skip = status >= http.StatusBadRequest || (enc != "" && !strings.EqualFold(enc, "identity"))
+}
+
+func (w *usageWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.start(http.StatusOK)
+	}
+	if !w.skip {
+		w.scan(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *usageWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *usageWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// scan inspects streamed responses line by line and buffers others whole.
+func (w *usageWriter) scan(p []byte) {
+	for len(p) > 0 {
+		if !w.stream {
+			if w.line.Len()+len(p) > maxUsageLine {
+				w.skip = true
+				w.line.Reset()
+				return
+			}
+			w.line.Write(p)
+			return
+		}
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			if w.line.Len()+len(p) <= maxUsageLine {
+				w.line.Write(p)
+			}
+			return
+		}
+		if w.line.Len()+i <= maxUsageLine {
+			w.line.Write(p[:i])
+		}
+		w.parseLine(w.line.Bytes())
+		w.line.Reset()
+		p = p[i+1:]
+	}
+}
+
+func (w *usageWriter) finish() {
+	if !w.skip && w.line.Len() > 0 {
+		w.parseLine(w.line.Bytes())
+	}
+	w.line.Reset()
+}
+
+func (w *usageWriter) parseLine(line []byte) {
+	line = bytes.TrimSpace(bytes.TrimPrefix(bytes.TrimSpace(line), []byte("data:")))
+	if len(line) == 0 || line[0] != '{' || (!bytes.Contains(line, []byte(`"usage`)) && !bytes.Contains(line, []byte(`"usageMetadata"`))) {
+		return
+	}
+	var payload struct {
+		Usage *struct {
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+			InputTokens      int64 `json:"input_tokens"`
+			OutputTokens     int64 `json:"output_tokens"`
+			TotalTokens      int64 `json:"total_tokens"`
+		} `json:"usage"`
+		// Claude streams input tokens in message_start.
+		Message *struct {
+			Usage *struct {
+				InputTokens  int64 `json:"input_tokens"`
+				OutputTokens int64 `json:"output_tokens"`
+			} `json:"usage"`
+		} `json:"message"`
+		UsageMetadata *struct {
+			PromptTokenCount     int64 `json:"promptTokenCount"`
+			CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+			TotalTokenCount      int64 `json:"totalTokenCount"`
+		} `json:"usageMetadata"`
+		// Gemini CLI and Antigravity wrap the Gemini payload.
+		Response *struct {
+			UsageMetadata *struct {
+				PromptTokenCount     int64 `json:"promptTokenCount"`
+				CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+				TotalTokenCount      int64 `json:"totalTokenCount"`
+			} `json:"usageMetadata"`
+		} `json:"response"`
+	}
+	if json.Unmarshal(line, &payload) != nil {
+		return
+	}
+	if u := payload.Usage; u != nil {
+		w.usage.merge(u.PromptTokens+u.InputTokens, u.CompletionTokens+u.OutputTokens, u.TotalTokens)
+	}
+	if payload.Message != nil && payload.Message.Usage != nil {
+		w.usage.merge(payload.Message.Usage.InputTokens, payload.Message.Usage.OutputTokens, 0)
+	}
+	meta := payload.UsageMetadata
+	if meta == nil && payload.Response != nil {
+		meta = payload.Response.UsageMetadata
+	}
+	if meta != nil {
+		w.usage.merge(meta.PromptTokenCount, meta.CandidatesTokenCount, meta.TotalTokenCount)
+	}
+}
@@ -0,0 +1,40 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestActivityMiddlewareStreamsLargeBody(t *testing.T) {
+	var received string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+		received = string(body)
+		_, _ = io.WriteString(w, `{"usage":{"prompt_tokens":3,"completion_tokens":4}}`)
+	})
+	f := newActivityFeed()
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"` + strings.Repeat("x", 2*maxActivityModelPrefix) + `"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/cliproxy/v1/chat/completions", strings.NewReader(body))
+	f.middleware(upstream).ServeHTTP(httptest.NewRecorder(), req)
+
+	if received != body {
+		t.Fatalf("upstream received %d bytes, want the full %d", len(received), len(body))
+	}
+	if req.ContentLength != int64(len(body)) {
+		t.Fatalf("ContentLength = %d, want %d", req.ContentLength, len(body))
+	}
+	events := f.recent()
+	if len(events) != 1 {
+		t.Fatalf("published %d events, want 1", len(events))
+	}
+	if ev := events[0]; ev.Model != "gpt-4o" || ev.TotalTokens != 7 {
+		t.Fatalf("event = %+v, want model gpt-4o and 7 tokens", ev)
+	}
+}
@@ -0,0 +1,31 @@
+package router
+
+import (
+	"net/http"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+func registerAuthSyncRoutes(mux *http.ServeMux, managementKey string, tokenStore *store.TokenStore) {
+	mux.Handle("GET /admin/api/auth-sync", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := tokenStore.LastReconcile()
+		if report == nil {
+			writeError(w, http.StatusNotFound, "no reconcile has run yet")
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	})))
+	mux.Handle("POST /admin/api/auth-sync", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reconcile := tokenStore.Reconcile
+		if r.URL.Query().Get("full") == "true" {
+			reconcile = tokenStore.ReconcileFull
+		}
+		report, err := reconcile(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, report)
+			return
+		}
+		store.LogReconcile(report)
+		writeJSON(w, http.StatusOK, report)
+	})))
+}
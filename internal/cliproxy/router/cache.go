@@ -0,0 +1,428 @@
+package router
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	cacheHeader = "X-HelixRun-Cache"
+
+	defaultCacheTTL          = 10 * time.Minute
+	defaultCacheMaxBodyBytes = 1 << 20
+)
+
+// cacheablePaths lists the CLIProxy endpoints (without the /cliproxy prefix)
+// whose deterministic responses may be served from cache.
+var cacheablePaths = map[string]struct{}{
+	"/v1/chat/completions": {},
+	"/v1/completions":      {},
+}
+
+// CacheBackend stores serialized responses keyed by request fingerprint.
+type CacheBackend interface {
+	// Get returns the cached value and whether it was found and still fresh.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value for the given time-to-live.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Purge removes every cached entry.
+	Purge(ctx context.Context) error
+}
+
+// CacheConfig controls which responses are cached and for how long.
+type CacheConfig struct {
+	// TTL is how long a cached response stays valid.
+	TTL time.Duration
+	// MaxBodyBytes skips caching responses (and requests) larger than this size.
+	MaxBodyBytes int64
+}
+
+// CacheStats reports cache effectiveness since process start.
+type CacheStats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Bypassed int64 `json:"bypassed"`
+	Stored   int64 `json:"stored"`
+	Errors   int64 `json:"errors"`
+}
+
+// ResponseCache serves repeated temperature-0 completion requests from a backend.
+type ResponseCache struct {
+	backend CacheBackend
+	cfg     CacheConfig
+
+	hits     atomic.Int64
+	misses   atomic.Int64
+	bypassed atomic.Int64
+	stored   atomic.Int64
+	errors   atomic.Int64
+}
+
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// NewResponseCache constructs a response cache on top of the given backend.
+func NewResponseCache(backend CacheBackend, cfg CacheConfig) *ResponseCache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultCacheTTL
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = defaultCacheMaxBodyBytes
+	}
+	return &ResponseCache{backend: backend, cfg: cfg}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *ResponseCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Bypassed: c.bypassed.Load(),
+		Stored:   c.stored.Load(),
+		Errors:   c.errors.Load(),
+	}
+}
+
+// Purge drops all cached responses.
+func (c *ResponseCache) Purge(ctx context.Context) error {
+	return c.backend.Purge(ctx)
+}
+
+// Middleware wraps a handler that serves paths relative to the /cliproxy prefix.
+func (c *ResponseCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := cacheablePaths[strings.TrimPrefix(r.URL.Path, "/cliproxy")]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, c.cfg.MaxBodyBytes+1))
+		if err != nil {
+			_ = r.Body.Close()
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > c.cfg.MaxBodyBytes {
+			// Too large to fingerprint; forward what was read plus the unread remainder.
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			c.bypassed.Add(1)
+			w.Header().Set(cacheHeader, "BYPASS")
+			next.ServeHTTP(w, r)
+			return
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+
+		noStore, noCache := cacheDirectives(r.Header)
+		key, ok := c.keyFor(r, body)
+		if !ok || noStore {
+			c.bypassed.Add(1)
+			w.Header().Set(cacheHeader, "BYPASS")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !noCache {
+			if entry, found := c.lookup(r.Context(), key); found {
+				c.hits.Add(1)
+				for k, vals := range entry.Header {
+					w.Header()[k] = vals
+				}
+				w.Header().Set(cacheHeader, "HIT")
+				w.WriteHeader(entry.Status)
+				_, _ = w.Write(entry.Body)
+				return
+			}
+		}
+
+		c.misses.Add(1)
+		w.Header().Set(cacheHeader, "MISS")
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK, limit: c.cfg.MaxBodyBytes}
+		next.ServeHTTP(rec, r)
+		if rec.status != http.StatusOK || rec.overflow {
+			return
+		}
+		c.store(r.Context(), key, &cachedResponse{
+			Status: rec.status,
+			Header: storableHeader(w.Header()),
+			Body:   rec.buf.Bytes(),
+		})
+	})
+}
+
+func (c *ResponseCache) lookup(ctx context.Context, key string) (*cachedResponse, bool) {
+	raw, found, err := c.backend.Get(ctx, key)
+	if err != nil {
+		c.errors.Add(1)
+		log.Printf("response cache: lookup failed: %v", err)
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+	var entry cachedResponse
+	if err = json.Unmarshal(raw, &entry); err != nil {
+		c.errors.Add(1)
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (c *ResponseCache) store(ctx context.Context, key string, entry *cachedResponse) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		c.errors.Add(1)
+		return
+	}
+	if err = c.backend.Set(ctx, key, raw, c.cfg.TTL); err != nil {
+		c.errors.Add(1)
+		log.Printf("response cache: store failed: %v", err)
+		return
+	}
+	c.stored.Add(1)
+}
+
+// keyFor fingerprints the request. Only non-streaming requests that explicitly
+// ask for temperature 0 are considered deterministic enough to cache. The
+// Accept-Encoding header is part of the key, so a compressed response is only
+// replayed to clients that asked for the same encodings.
+func (c *ResponseCache) keyFor(r *http.Request, body []byte) (string, bool) {
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", false
+	}
+	if stream, _ := payload["stream"].(bool); stream {
+		return "", false
+	}
+	temp, ok := payload["temperature"].(float64)
+	if !ok || temp != 0 {
+		return "", false
+	}
+	model, _ := payload["model"].(string)
+	// Re-marshalling sorts map keys, which normalizes whitespace and key order.
+	normalized, err := json.Marshal(payload)
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.New()
+	h.Write([]byte(strings.TrimPrefix(r.URL.Path, "/cliproxy")))
+	h.Write([]byte{0})
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(apiKeyScope(r.Header)))
+	h.Write([]byte{0})
+	h.Write([]byte(acceptEncoding(r.Header)))
+	h.Write([]byte{0})
+	h.Write(normalized)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// acceptEncoding normalizes the Accept-Encoding values for the cache key.
+func acceptEncoding(header http.Header) string {
+	var codings []string
+	for _, v := range header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(v, ",") {
+			if coding = strings.ToLower(strings.Join(strings.Fields(coding), "")); coding != "" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	return strings.Join(codings, ",")
+}
+
+// apiKeyScope hashes the client credential so cached responses are never
+// shared between API keys, without keeping the key itself around.
+func apiKeyScope(header http.Header) string {
+	return hashAPIKey(clientAPIKey(header))
+}
+
+// clientAPIKey extracts the caller's API key from the headers used by the
+// OpenAI, Claude and Gemini compatible endpoints.
+func clientAPIKey(header http.Header) string {
+	if auth := strings.TrimSpace(header.Get("Authorization")); auth != "" {
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+			return strings.TrimSpace(auth[7:])
+		}
+		return auth
+	}
+	if key := strings.TrimSpace(header.Get("X-Api-Key")); key != "" {
+		return key
+	}
+	return strings.TrimSpace(header.Get("X-Goog-Api-Key"))
+}
+
+func hashAPIKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func cacheDirectives(header http.Header) (noStore, noCache bool) {
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "no-store":
+				noStore = true
+			case "no-cache", "max-age=0":
+				noCache = true
+			}
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(header.Get("Pragma")), "no-cache") {
+		noCache = true
+	}
+	return noStore, noCache
+}
+
+func storableHeader(header http.Header) http.Header {
+	out := make(http.Header)
+	for k, vals := range header {
+		switch http.CanonicalHeaderKey(k) {
+		case cacheHeader, "Date", "Content-Length", "Set-Cookie":
+			continue
+		}
+		out[k] = append([]string(nil), vals...)
+	}
+	return out
+}
+
+// recordingWriter passes the response through while keeping a bounded copy.
+type recordingWriter struct {
+	http.ResponseWriter
+	status   int
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if room := w.limit - int64(w.buf.Len()); int64(len(p)) > room {
+		// Keep the first limit bytes; overflow marks the copy as incomplete.
+		w.overflow = true
+		if room > 0 {
+			w.buf.Write(p[:room])
+		}
+	} else {
+		w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// MemoryCache is an in-process LRU cache backend bounded by entry count and total bytes.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	size       int64
+	order      *list.List
+	items      map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates an LRU cache backend. Zero limits mean unbounded.
+func NewMemoryCache(maxEntries int, maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get implements CacheBackend.
+func (m *MemoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		m.removeElement(elem)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set implements CacheBackend.
+func (m *MemoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.maxBytes > 0 && int64(len(value)) > m.maxBytes {
+		return nil
+	}
+	if elem, ok := m.items[key]; ok {
+		m.removeElement(elem)
+	}
+	entry := &memoryCacheEntry{key: key, value: value, expiresAt: time.Now().Add(ttl)}
+	m.items[key] = m.order.PushFront(entry)
+	m.size += int64(len(value))
+	for (m.maxEntries > 0 && m.order.Len() > m.maxEntries) || (m.maxBytes > 0 && m.size > m.maxBytes) {
+		m.removeElement(m.order.Back())
+	}
+	return nil
+}
+
+// Purge implements CacheBackend.
+func (m *MemoryCache) Purge(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.order.Init()
+	m.items = make(map[string]*list.Element)
+	m.size = 0
+	return nil
+}
+
+func (m *MemoryCache) removeElement(elem *list.Element) {
+	entry := m.order.Remove(elem).(*memoryCacheEntry)
+	delete(m.items, entry.key)
+	m.size -= int64(len(entry.value))
+}
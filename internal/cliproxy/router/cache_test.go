@@ -0,0 +1,191 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCacheMiddlewareForwardsOversizedBody(t *testing.T) {
+	var received string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+		received = string(body)
+		_, _ = w.Write([]byte(`{}`))
+	})
+	cache := NewResponseCache(NewMemoryCache(0, 0), CacheConfig{MaxBodyBytes: 16})
+
+	body := `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"` + strings.Repeat("x", 100) + `"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/cliproxy/v1/chat/completions", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	cache.Middleware(upstream).ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(cacheHeader); got != "BYPASS" {
+		t.Fatalf("%s = %q, want BYPASS", cacheHeader, got)
+	}
+	if received != body {
+		t.Fatalf("upstream received %d bytes, want the full %d", len(received), len(body))
+	}
+	if req.ContentLength != int64(len(body)) {
+		t.Fatalf("ContentLength = %d, want %d", req.ContentLength, len(body))
+	}
+}
+
+func TestCacheMiddlewareServesRepeatedRequests(t *testing.T) {
+	calls := 0
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	})
+	handler := NewResponseCache(NewMemoryCache(0, 0), CacheConfig{}).Middleware(upstream)
+
+	want := []string{"MISS", "HIT"}
+	for i, body := range []string{
+		`{"model":"gpt-4o","temperature":0,"messages":[]}`,
+		`{ "messages": [], "temperature": 0, "model": "gpt-4o" }`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/cliproxy/v1/chat/completions", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get(cacheHeader); got != want[i] {
+			t.Fatalf("request %d: %s = %q, want %q", i, cacheHeader, got, want[i])
+		}
+		if rec.Body.String() != `{"id":"1"}` {
+			t.Fatalf("request %d: body = %q", i, rec.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("upstream called %d times, want 1", calls)
+	}
+}
+
+func TestCacheMiddlewareKeepsEncodingsApart(t *testing.T) {
+	calls := 0
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write([]byte("gzipped"))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	})
+	handler := NewResponseCache(NewMemoryCache(0, 0), CacheConfig{}).Middleware(upstream)
+
+	steps := []struct {
+		encoding string
+		cache    string
+		body     string
+	}{
+		{"gzip", "MISS", "gzipped"},
+		{"", "MISS", `{"id":"1"}`},
+		{"gzip", "HIT", "gzipped"},
+		{"", "HIT", `{"id":"1"}`},
+	}
+	for i, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, "/cliproxy/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","temperature":0,"messages":[]}`))
+		if step.encoding != "" {
+			req.Header.Set("Accept-Encoding", step.encoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get(cacheHeader); got != step.cache {
+			t.Fatalf("request %d: %s = %q, want %q", i, cacheHeader, got, step.cache)
+		}
+		if rec.Body.String() != step.body {
+			t.Fatalf("request %d: body = %q, want %q", i, rec.Body.String(), step.body)
+		}
+		if gzipped := rec.Header().Get("Content-Encoding") == "gzip"; gzipped != (step.encoding == "gzip") {
+			t.Fatalf("request %d: Content-Encoding = %q for Accept-Encoding %q", i, rec.Header().Get("Content-Encoding"), step.encoding)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("upstream called %d times, want 2", calls)
+	}
+}
+
+func TestCacheKeyFor(t *testing.T) {
+	const base = `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`
+	cache := NewResponseCache(NewMemoryCache(0, 0), CacheConfig{})
+	keyOf := func(path, key, encoding, body string) (string, bool) {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+		return cache.keyFor(req, []byte(body))
+	}
+	baseKey, ok := keyOf("/cliproxy/v1/chat/completions", "sk-a", "gzip, br", base)
+	if !ok {
+		t.Fatal("base request is not cacheable")
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		key       string
+		encoding  string
+		body      string
+		cacheable bool
+		same      bool
+	}{
+		{"reordered keys and whitespace", "/cliproxy/v1/chat/completions", "sk-a", "gzip, br",
+			`{ "messages" : [ {"content":"hi","role":"user"} ], "model":"gpt-4o", "temperature":0.0 }`, true, true},
+		{"other api key", "/cliproxy/v1/chat/completions", "sk-b", "gzip, br", base, true, false},
+		{"no api key", "/cliproxy/v1/chat/completions", "", "gzip, br", base, true, false},
+		{"other path", "/cliproxy/v1/completions", "sk-a", "gzip, br", base, true, false},
+		{"other prompt", "/cliproxy/v1/chat/completions", "sk-a", "gzip, br",
+			`{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hello"}]}`, true, false},
+		{"nonzero temperature", "/cliproxy/v1/chat/completions", "sk-a", "gzip, br",
+			`{"model":"gpt-4o","temperature":0.7,"messages":[]}`, false, false},
+		{"missing temperature", "/cliproxy/v1/chat/completions", "sk-a", "gzip, br",
+			`{"model":"gpt-4o","messages":[]}`, false, false},
+		{"streaming", "/cliproxy/v1/chat/completions", "sk-a", "gzip, br",
+			`{"model":"gpt-4o","temperature":0,"stream":true,"messages":[]}`, false, false},
+		{"same encodings spelled differently", "/cliproxy/v1/chat/completions", "sk-a", "GZIP,br", base, true, true},
+		{"other encodings", "/cliproxy/v1/chat/completions", "sk-a", "gzip", base, true, false},
+		{"no accept-encoding", "/cliproxy/v1/chat/completions", "sk-a", "", base, true, false},
+		{"invalid json", "/cliproxy/v1/chat/completions", "sk-a", "gzip, br", `{"model":`, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := keyOf(tt.path, tt.key, tt.encoding, tt.body)
+			if ok != tt.cacheable {
+				t.Fatalf("cacheable = %v, want %v", ok, tt.cacheable)
+			}
+			if ok && (key == baseKey) != tt.same {
+				t.Fatalf("same key as base = %v, want %v", key == baseKey, tt.same)
+			}
+		})
+	}
+}
+
+func TestCacheDirectives(t *testing.T) {
+	tests := []struct {
+		header           http.Header
+		noStore, noCache bool
+	}{
+		{http.Header{}, false, false},
+		{http.Header{"Cache-Control": {"no-store"}}, true, false},
+		{http.Header{"Cache-Control": {"max-age=0, No-Cache"}}, false, true},
+		{http.Header{"Pragma": {"no-cache"}}, false, true},
+		{http.Header{"Cache-Control": {"private", "no-store, no-cache"}}, true, true},
+	}
+	for _, tt := range tests {
+		noStore, noCache := cacheDirectives(tt.header)
+		if noStore != tt.noStore || noCache != tt.noCache {
+			t.Errorf("cacheDirectives(%v) = %v, %v; want %v, %v", tt.header, noStore, noCache, tt.noStore, tt.noCache)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package router
+
+import (
+	"net/http"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/configreload"
+)
+
+func registerConfigReloadRoutes(mux *http.ServeMux, managementKey string, reloader *configreload.Reloader) {
+	mux.Handle("GET /admin/api/config/status", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, reloader.Status())
+	})))
+	mux.Handle("POST /admin/api/config/reload", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, err := reloader.Check()
+		if err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": err.Error(), "status": status})
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})))
+}
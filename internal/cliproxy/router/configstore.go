@@ -0,0 +1,130 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/configsync"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+const maxConfigBodyBytes = 1 << 20
+
+func registerConfigStoreRoutes(mux *http.ServeMux, managementKey string, syncer *configsync.Syncer) {
+	mux.Handle("GET /admin/api/config/versions", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		versions, err := syncer.Versions(r.Context(), limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if versions == nil {
+			versions = []store.ConfigVersion{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"applied": syncer.Applied(), "versions": versions})
+	})))
+	mux.Handle("GET /admin/api/config/versions/{version}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, ok := versionParam(w, r.PathValue("version"))
+		if !ok {
+			return
+		}
+		v, err := syncer.Version(r.Context(), version)
+		if err != nil {
+			writeConfigStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	})))
+	mux.Handle("GET /admin/api/config/diff", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, ok := versionParam(w, r.URL.Query().Get("from"))
+		if !ok {
+			return
+		}
+		to := syncer.Applied()
+		if raw := r.URL.Query().Get("to"); raw != "" {
+			if to, ok = versionParam(w, raw); !ok {
+				return
+			}
+		}
+		diff, err := syncer.Diff(r.Context(), from, to)
+		if err != nil {
+			writeConfigStoreError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		_, _ = io.WriteString(w, diff)
+	})))
+	mux.Handle("PUT /admin/api/config", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxConfigBodyBytes+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(body) > maxConfigBodyBytes {
+			writeError(w, http.StatusRequestEntityTooLarge, "config too large")
+			return
+		}
+		q := r.URL.Query()
+		var base int64
+		if raw := q.Get("base_version"); raw != "" {
+			var ok bool
+			if base, ok = versionParam(w, raw); !ok {
+				return
+			}
+		}
+		v, err := syncer.Apply(r.Context(), string(body), configAuthor(r), strings.TrimSpace(q.Get("comment")), base)
+		if err != nil {
+			writeConfigStoreError(w, err)
+			return
+		}
+		v.Content = ""
+		writeJSON(w, http.StatusOK, v)
+	})))
+	mux.Handle("POST /admin/api/config/versions/{version}/rollback", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, ok := versionParam(w, r.PathValue("version"))
+		if !ok {
+			return
+		}
+		v, err := syncer.Rollback(r.Context(), version, configAuthor(r))
+		if err != nil {
+			writeConfigStoreError(w, err)
+			return
+		}
+		v.Content = ""
+		writeJSON(w, http.StatusOK, v)
+	})))
+}
+
+func versionParam(w http.ResponseWriter, raw string) (int64, bool) {
+	version, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil || version <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid version")
+		return 0, false
+	}
+	return version, true
+}
+
+// configAuthor labels a stored version with the ?author= value or the caller's address.
+func configAuthor(r *http.Request) string {
+	if author := strings.TrimSpace(r.URL.Query().Get("author")); author != "" {
+		return author
+	}
+	return r.RemoteAddr
+}
+
+func writeConfigStoreError(w http.ResponseWriter, err error) {
+	var invalid *configsync.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": invalid.Error(), "problems": invalid.Problems})
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "version not found")
+	case errors.Is(err, store.ErrVersionConflict):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
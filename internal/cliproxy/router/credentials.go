@@ -0,0 +1,164 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/cooldowns"
+	"helixrun-cliproxy-starter/internal/cliproxy/healthprobe"
+	"helixrun-cliproxy-starter/internal/cliproxy/tokenrefresh"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+func registerCredentialRoutes(mux *http.ServeMux, managementKey string, tokenStore *store.TokenStore) {
+	mux.Handle("GET /admin/api/credentials", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := store.AuthFilter{
+			Provider:  strings.TrimSpace(q.Get("provider")),
+			Email:     strings.TrimSpace(q.Get("email")),
+			ProjectID: strings.TrimSpace(q.Get("project_id")),
+			Label:     strings.TrimSpace(q.Get("label")),
+		}
+		var err error
+		if raw := q.Get("disabled"); raw != "" {
+			disabled, errBool := strconv.ParseBool(raw)
+			if errBool != nil {
+				writeError(w, http.StatusBadRequest, "invalid disabled")
+				return
+			}
+			filter.Disabled = &disabled
+		}
+		if filter.ExpiresBefore, err = parseExpiryParam(q.Get("expires_before")); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid expires_before: "+err.Error())
+			return
+		}
+		if filter.ExpiresAfter, err = parseExpiryParam(q.Get("expires_after")); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid expires_after: "+err.Error())
+			return
+		}
+		if raw := q.Get("limit"); raw != "" {
+			if filter.Limit, err = strconv.Atoi(raw); err != nil || filter.Limit < 0 {
+				writeError(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+		}
+		summaries, err := tokenStore.ListSummaries(r.Context(), filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if summaries == nil {
+			summaries = []store.AuthSummary{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"credentials": summaries})
+	})))
+	setDisabled := func(disabled bool) http.Handler {
+		return requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			summary, err := tokenStore.SetDisabled(r.Context(), r.PathValue("id"), disabled, configAuthor(r), r.URL.Query().Get("reason"))
+			if errors.Is(err, store.ErrNotFound) {
+				writeError(w, http.StatusNotFound, "credential not found")
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, summary)
+		}))
+	}
+	mux.Handle("POST /admin/api/credentials/disable/{id...}", setDisabled(true))
+	mux.Handle("POST /admin/api/credentials/enable/{id...}", setDisabled(false))
+}
+
+func registerTokenRefreshRoutes(mux *http.ServeMux, managementKey string, scheduler *tokenrefresh.Scheduler) {
+	mux.Handle("GET /admin/api/credentials/refresh", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses, checkedAt := scheduler.Statuses()
+		writeJSON(w, http.StatusOK, map[string]any{"checked_at": checkedAt, "credentials": statuses})
+	})))
+	mux.Handle("POST /admin/api/credentials/refresh", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := scheduler.Check(r.Context()); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		statuses, checkedAt := scheduler.Statuses()
+		writeJSON(w, http.StatusOK, map[string]any{"checked_at": checkedAt, "credentials": statuses})
+	})))
+}
+
+func registerHealthProbeRoutes(mux *http.ServeMux, managementKey string, prober *healthprobe.Prober) {
+	mux.Handle("GET /admin/api/credentials/health", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results, checkedAt := prober.Results()
+		writeJSON(w, http.StatusOK, map[string]any{"checked_at": checkedAt, "running": prober.Running(), "credentials": results})
+	})))
+	// Probing every credential can outlast the server's write timeout, so the
+	// run happens in the background and is polled through GET.
+	mux.Handle("POST /admin/api/credentials/health", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if prober.Running() {
+			writeError(w, http.StatusConflict, healthprobe.ErrRunning.Error())
+			return
+		}
+		go func() {
+			if err := prober.ProbeAll(context.WithoutCancel(r.Context())); err != nil && !errors.Is(err, healthprobe.ErrRunning) {
+				log.Printf("credential probe: %v", err)
+			}
+		}()
+		writeJSON(w, http.StatusAccepted, map[string]any{"running": true})
+	})))
+	mux.Handle("POST /admin/api/credentials/health/{id...}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := prober.Probe(r.Context(), r.PathValue("id"))
+		if errors.Is(err, healthprobe.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})))
+}
+
+// parseExpiryParam accepts RFC 3339 or a duration from now, so
+// expires_before=168h selects credentials expiring within a week.
+func parseExpiryParam(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return time.Now().Add(d), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func registerCooldownRoutes(mux *http.ServeMux, managementKey string, tracker *cooldowns.Tracker) {
+	mux.Handle("GET /admin/api/credentials/cooldowns", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		active, err := tracker.Active(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if active == nil {
+			active = []store.Cooldown{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"cooldowns": active})
+	})))
+	// Without ?model= every cooldown of the credential is lifted.
+	mux.Handle("DELETE /admin/api/credentials/cooldowns/{id...}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := tracker.Clear(r.Context(), r.PathValue("id"), strings.TrimSpace(r.URL.Query().Get("model")))
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "credential is not cooling down")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+}
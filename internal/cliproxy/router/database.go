@@ -0,0 +1,29 @@
+package router
+
+import (
+	"net/http"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+func registerDatabaseRoutes(mux *http.ServeMux, managementKey string, tokenStore *store.TokenStore) {
+	mux.Handle("GET /admin/api/db", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]any{
+			"backend": tokenStore.Backend().String(),
+			"health":  tokenStore.Health(),
+			"outbox":  tokenStore.OutboxStats(),
+		}
+		if pool := tokenStore.PoolStats(); pool != nil {
+			body["pool"] = pool
+		}
+		writeJSON(w, http.StatusOK, body)
+	})))
+	mux.Handle("POST /admin/api/db/health", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := tokenStore.CheckHealth(r.Context())
+		status := http.StatusOK
+		if !health.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, health)
+	})))
+}
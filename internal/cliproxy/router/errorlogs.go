@@ -0,0 +1,54 @@
+package router
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/errorlogs"
+	"helixrun-cliproxy-starter/internal/redact"
+)
+
+func registerErrorLogRoutes(mux *http.ServeMux, managementKey string, index *errorlogs.Index, redactor *redact.Redactor) {
+	mux.Handle("GET /admin/api/error-logs", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		result, err := index.List(page, pageSize)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for i := range result.Entries {
+			result.Entries[i].URL = redactor.String(result.Entries[i].URL)
+		}
+		writeJSON(w, http.StatusOK, result)
+	})))
+	mux.Handle("GET /admin/api/error-logs/{name}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry, err := index.Get(r.PathValue("name"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				writeError(w, http.StatusNotFound, "log file not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		entry.URL = redactor.String(entry.URL)
+		entry.RequestHeaders = redactor.Headers(entry.RequestHeaders)
+		entry.RequestBody = redactor.String(entry.RequestBody)
+		entry.ResponseHeaders = redactor.Headers(entry.ResponseHeaders)
+		entry.ResponseBody = redactor.String(entry.ResponseBody)
+		writeJSON(w, http.StatusOK, entry)
+	})))
+	mux.Handle("DELETE /admin/api/error-logs/{name}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := index.Delete(r.PathValue("name")); err != nil {
+			if os.IsNotExist(err) {
+				writeError(w, http.StatusNotFound, "log file not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+}
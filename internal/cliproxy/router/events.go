@@ -0,0 +1,127 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/events"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+func registerEventRoutes(mux *http.ServeMux, managementKey string, bus *events.Bus) {
+	mux.Handle("GET /admin/api/events/subscriptions", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subs, err := bus.Subscriptions(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if subs == nil {
+			subs = []store.EventSubscription{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"subscriptions": subs, "event_types": events.Types})
+	})))
+	// Targets and secrets are sent in the body so they do not end up in access logs.
+	mux.Handle("PUT /admin/api/events/subscriptions/{name}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Sink     string   `json:"sink"`
+			Target   string   `json:"target"`
+			Secret   string   `json:"secret"`
+			Events   []string `json:"events"`
+			Disabled bool     `json:"disabled"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		name := r.PathValue("name")
+		err := bus.PutSubscription(r.Context(), store.EventSubscription{
+			Name:     name,
+			Sink:     body.Sink,
+			Target:   body.Target,
+			Secret:   body.Secret,
+			Events:   body.Events,
+			Disabled: body.Disabled,
+		})
+		if err != nil {
+			writeEventError(w, err)
+			return
+		}
+		subs, err := bus.Subscriptions(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, sub := range subs {
+			if sub.Name == name {
+				writeJSON(w, http.StatusOK, sub)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "subscription not found")
+	})))
+	mux.Handle("DELETE /admin/api/events/subscriptions/{name}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := bus.DeleteSubscription(r.Context(), r.PathValue("name")); err != nil {
+			writeEventError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	mux.Handle("POST /admin/api/events/subscriptions/{name}/test", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivery, err := bus.Test(r.Context(), r.PathValue("name"))
+		if err != nil {
+			writeEventError(w, err)
+			return
+		}
+		status := http.StatusOK
+		if delivery.Status != events.StatusDelivered {
+			status = http.StatusBadGateway
+		}
+		writeJSON(w, status, delivery)
+	})))
+	mux.Handle("GET /admin/api/events/deliveries", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := store.EventDeliveryFilter{
+			Subscription: strings.TrimSpace(q.Get("subscription")),
+			EventType:    strings.TrimSpace(q.Get("type")),
+			Status:       strings.TrimSpace(q.Get("status")),
+		}
+		var err error
+		if raw := q.Get("limit"); raw != "" {
+			if filter.Limit, err = strconv.Atoi(raw); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+		}
+		if raw := q.Get("before_id"); raw != "" {
+			if filter.BeforeID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid before_id")
+				return
+			}
+		}
+		deliveries, err := bus.Deliveries(r.Context(), filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if deliveries == nil {
+			deliveries = []store.EventDelivery{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"deliveries": deliveries})
+	})))
+}
+
+func writeEventError(w http.ResponseWriter, err error) {
+	var invalid *events.ValidationError
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "subscription not found")
+	case errors.As(err, &invalid):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/redact"
+)
+
+// inflightRequest describes a request that has not finished yet.
+type inflightRequest struct {
+	Method string
+	Path   string
+	Remote string
+	Start  time.Time
+}
+
+// inflightTracker records running requests so shutdown can report what it aborts.
+type inflightTracker struct {
+	mu       sync.Mutex
+	next     uint64
+	requests map[uint64]inflightRequest
+}
+
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{requests: make(map[uint64]inflightRequest)}
+}
+
+func (t *inflightTracker) middleware(next http.Handler, redactor *redact.Redactor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.mu.Lock()
+		t.next++
+		id := t.next
+		t.requests[id] = inflightRequest{
+			Method: r.Method,
+			Path:   redactor.String(r.URL.RequestURI()),
+			Remote: r.RemoteAddr,
+			Start:  time.Now(),
+		}
+		t.mu.Unlock()
+		defer func() {
+			t.mu.Lock()
+			delete(t.requests, id)
+			t.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// snapshot returns the running requests, oldest first.
+func (t *inflightTracker) snapshot() []inflightRequest {
+	t.mu.Lock()
+	out := make([]inflightRequest, 0, len(t.requests))
+	for _, req := range t.requests {
+		out = append(out, req)
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+func (t *inflightTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.requests)
+}
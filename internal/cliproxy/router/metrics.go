@@ -0,0 +1,76 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+)
+
+// registerMetricsRoute serves /metrics in the Prometheus text format. It is
+// guarded like the admin API; scrapers send the management key as a bearer token.
+func registerMetricsRoute(mux *http.ServeMux, managementKey string, s *Server, opts Options) {
+	mux.Handle("GET /metrics", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m metricsWriter
+		m.gauge("helixrun_inflight_requests", "Requests currently being served.", float64(s.inflight.count()))
+		m.gauge("helixrun_activity_subscribers", "Admin viewers connected to the live activity stream.", float64(s.activity.subscribers()))
+		m.counter("helixrun_activity_dropped_total", "Activity events not sent to a viewer that fell behind.", float64(s.activity.dropped.Load()))
+		if opts.Cache != nil {
+			stats := opts.Cache.Stats()
+			m.counter("helixrun_cache_hits_total", "Responses served from the response cache.", float64(stats.Hits))
+			m.counter("helixrun_cache_misses_total", "Cacheable requests not found in the response cache.", float64(stats.Misses))
+			m.counter("helixrun_cache_errors_total", "Response cache backend errors.", float64(stats.Errors))
+		}
+		if opts.TokenStore != nil {
+			outbox := opts.TokenStore.OutboxStats()
+			m.gauge("helixrun_auth_outbox_depth", "auth_store writes queued while Postgres is unreachable.", float64(outbox.Depth))
+			oldest := 0.0
+			if !outbox.OldestQueuedAt.IsZero() {
+				oldest = float64(outbox.OldestQueuedAt.Unix())
+			}
+			m.gauge("helixrun_auth_outbox_oldest_timestamp_seconds", "Queue time of the oldest pending auth_store write, 0 when empty.", oldest)
+			m.counter("helixrun_auth_outbox_queued_total", "auth_store writes queued for replay.", float64(outbox.Queued))
+			m.counter("helixrun_auth_outbox_replayed_total", "Queued auth_store writes applied after reconnecting.", float64(outbox.Replayed))
+			m.counter("helixrun_auth_outbox_dropped_total", "Queued auth_store writes dropped after a permanent error.", float64(outbox.Dropped))
+			m.counter("helixrun_auth_store_retries_total", "Retried auth_store writes after a transient error.", float64(outbox.Retries))
+
+			if pool := opts.TokenStore.PoolStats(); pool != nil {
+				m.gauge("helixrun_db_max_open_connections", "Configured maximum of open database connections.", float64(pool.MaxOpen))
+				m.gauge("helixrun_db_open_connections", "Open database connections.", float64(pool.Open))
+				m.gauge("helixrun_db_in_use_connections", "Database connections currently in use.", float64(pool.InUse))
+				m.gauge("helixrun_db_idle_connections", "Idle database connections.", float64(pool.Idle))
+				m.counter("helixrun_db_acquire_total", "Connections acquired from the pool.", float64(pool.AcquireCount))
+				m.counter("helixrun_db_canceled_acquire_total", "Connection acquires cancelled by their context.", float64(pool.CanceledAcquireCount))
+				m.counter("helixrun_db_wait_count_total", "Connection requests that had to wait for a free connection.", float64(pool.WaitCount))
+				m.counter("helixrun_db_wait_duration_seconds_total", "Time spent waiting for a free connection.", float64(pool.WaitDurationMS)/1000)
+				m.counter("helixrun_db_closed_max_lifetime_total", "Connections closed because they reached their maximum lifetime.", float64(pool.MaxLifetimeClosed))
+			}
+			if health := opts.TokenStore.Health(); health != nil {
+				healthy := 0.0
+				if health.Healthy {
+					healthy = 1
+				}
+				m.gauge("helixrun_db_healthy", "1 when the latest token store backend health check succeeded.", healthy)
+				m.gauge("helixrun_db_ping_seconds", "Latency of the latest token store backend health check.", health.LatencyMS/1000)
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(m.buf.Bytes())
+	})))
+}
+
+// metricsWriter renders unlabelled samples in the Prometheus text exposition format.
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func (m *metricsWriter) gauge(name, help string, value float64) {
+	m.sample(name, "gauge", help, value)
+}
+
+func (m *metricsWriter) counter(name, help string, value float64) {
+	m.sample(name, "counter", help, value)
+}
+
+func (m *metricsWriter) sample(name, kind, help string, value float64) {
+	fmt.Fprintf(&m.buf, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
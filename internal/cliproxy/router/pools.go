@@ -0,0 +1,132 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/credpool"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+func registerCredentialPoolRoutes(mux *http.ServeMux, managementKey string, pools *credpool.Router) {
+	mux.Handle("GET /admin/api/pools", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list, bindings, loadedAt := pools.Pools()
+		writeJSON(w, http.StatusOK, map[string]any{"loaded_at": loadedAt, "pools": list, "bindings": bindings})
+	})))
+	mux.Handle("PUT /admin/api/pools/{name}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		name := r.PathValue("name")
+		if err := pools.PutPool(r.Context(), name, strings.TrimSpace(q.Get("strategy")), q.Get("description")); err != nil {
+			writePoolError(w, err)
+			return
+		}
+		writePool(w, pools, name)
+	})))
+	mux.Handle("DELETE /admin/api/pools/{name}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := pools.DeletePool(r.Context(), r.PathValue("name")); err != nil {
+			writePoolError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	mux.Handle("PUT /admin/api/pools/{name}/members/{id...}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		weight := 0
+		if raw := r.URL.Query().Get("weight"); raw != "" {
+			var err error
+			if weight, err = strconv.Atoi(raw); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid weight")
+				return
+			}
+		}
+		name := r.PathValue("name")
+		if err := pools.PutMember(r.Context(), name, r.PathValue("id"), weight); err != nil {
+			writePoolError(w, err)
+			return
+		}
+		writePool(w, pools, name)
+	})))
+	mux.Handle("DELETE /admin/api/pools/{name}/members/{id...}", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if err := pools.DeleteMember(r.Context(), name, r.PathValue("id")); err != nil {
+			writePoolError(w, err)
+			return
+		}
+		writePool(w, pools, name)
+	})))
+	// API keys are sent in the body rather than the query string so they do
+	// not end up in access logs.
+	mux.Handle("POST /admin/api/pools/{name}/bindings", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			APIKey string `json:"api_key"`
+			Model  string `json:"model"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		name := r.PathValue("name")
+		var err error
+		switch {
+		case body.APIKey != "" && body.Model != "":
+			writeError(w, http.StatusBadRequest, "set either api_key or model")
+			return
+		case body.APIKey != "":
+			err = pools.BindAPIKey(r.Context(), body.APIKey, name)
+		case body.Model != "":
+			err = pools.BindModel(r.Context(), body.Model, name)
+		default:
+			writeError(w, http.StatusBadRequest, "api_key or model is required")
+			return
+		}
+		if err != nil {
+			writePoolError(w, err)
+			return
+		}
+		_, bindings, _ := pools.Pools()
+		writeJSON(w, http.StatusOK, map[string]any{"bindings": bindings})
+	})))
+	// Bindings are removed by model or by the API key hash shown in GET /admin/api/pools.
+	mux.Handle("DELETE /admin/api/pool-bindings", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		kind, match := store.BindingModel, strings.TrimSpace(q.Get("model"))
+		if match == "" {
+			kind, match = store.BindingAPIKey, strings.TrimSpace(q.Get("api_key_hash"))
+		}
+		if match == "" {
+			writeError(w, http.StatusBadRequest, "model or api_key_hash is required")
+			return
+		}
+		if err := pools.Unbind(r.Context(), kind, match); err != nil {
+			writePoolError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+}
+
+func writePool(w http.ResponseWriter, pools *credpool.Router, name string) {
+	list, _, _ := pools.Pools()
+	for _, p := range list {
+		if p.Name == name {
+			writeJSON(w, http.StatusOK, p)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "pool not found")
+}
+
+func writePoolError(w http.ResponseWriter, err error) {
+	var invalid *credpool.ValidationError
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "pool, member or binding not found")
+	case errors.As(err, &invalid):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,341 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/redact"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+const (
+	defaultRequestLogBodyBytes = 64 << 10
+	requestLogQueueSize        = 256
+	// requestLogKeyHeader carries the full API key to filter a search by.
+	requestLogKeyHeader = "X-HelixRun-API-Key"
+)
+
+// RequestLogStore persists and queries captured request/response pairs.
+type RequestLogStore interface {
+	Insert(ctx context.Context, entry *store.RequestLogEntry) error
+	Search(ctx context.Context, filter store.RequestLogFilter) ([]store.RequestLogEntry, error)
+	Get(ctx context.Context, id int64) (*store.RequestLogEntry, error)
+	DeleteOlderThan(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// RequestLogConfig controls which requests are captured.
+type RequestLogConfig struct {
+	// SampleRate is the fraction (0..1] of successful requests that are recorded.
+	SampleRate float64
+	// AlwaysLogErrors records every response with status >= 400 regardless of sampling.
+	AlwaysLogErrors bool
+	// MaxBodyBytes truncates captured request and response bodies.
+	MaxBodyBytes int
+	// Retention deletes entries older than this age; zero keeps entries forever.
+	Retention time.Duration
+	// Redactor masks secrets in headers and bodies before they are stored.
+	Redactor *redact.Redactor
+}
+
+// RequestLogger captures proxied API traffic asynchronously into a RequestLogStore.
+type RequestLogger struct {
+	store RequestLogStore
+	cfg   RequestLogConfig
+	queue chan *store.RequestLogEntry
+	stop  chan struct{}
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewRequestLogger starts a background writer that drains captured entries into st.
+func NewRequestLogger(st RequestLogStore, cfg RequestLogConfig) *RequestLogger {
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 1
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = defaultRequestLogBodyBytes
+	}
+	if cfg.Redactor == nil {
+		cfg.Redactor = redact.Default()
+	}
+	l := &RequestLogger{
+		store: st,
+		cfg:   cfg,
+		queue: make(chan *store.RequestLogEntry, requestLogQueueSize),
+		stop:  make(chan struct{}),
+	}
+	l.wg.Add(1)
+	go l.run()
+	if cfg.Retention > 0 {
+		l.wg.Add(1)
+		go l.prune()
+	}
+	return l
+}
+
+// Close stops accepting entries and waits until queued entries are written.
+func (l *RequestLogger) Close() {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+		close(l.stop)
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+}
+
+func (l *RequestLogger) run() {
+	defer l.wg.Done()
+	for entry := range l.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := l.store.Insert(ctx, entry); err != nil {
+			log.Printf("request log: %v", err)
+		}
+		cancel()
+	}
+}
+
+func (l *RequestLogger) prune() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if n, err := l.store.DeleteOlderThan(ctx, time.Now().Add(-l.cfg.Retention)); err != nil {
+			log.Printf("request log: %v", err)
+		} else if n > 0 {
+			log.Printf("request log: pruned %d entries older than %s", n, l.cfg.Retention)
+		}
+		cancel()
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *RequestLogger) enqueue(entry *store.RequestLogEntry) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.queue <- entry:
+	default:
+		log.Printf("request log: queue full, dropping entry for %s", entry.Path)
+	}
+}
+
+// Middleware captures API traffic served below /cliproxy. Management calls are never logged.
+func (l *RequestLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/cliproxy")
+		if !isAPIPath(path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sampled := rand.Float64() < l.cfg.SampleRate
+		if !sampled && !l.cfg.AlwaysLogErrors {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit := int64(l.cfg.MaxBodyBytes)
+		var reqBody []byte
+		reqTruncated := false
+		if r.Body != nil {
+			var err error
+			if reqBody, err = io.ReadAll(io.LimitReader(r.Body, limit+1)); err != nil {
+				_ = r.Body.Close()
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			// Only the first MaxBodyBytes are captured; the rest streams through.
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+			if int64(len(reqBody)) > limit {
+				reqBody, reqTruncated = reqBody[:limit], true
+			}
+		}
+
+		start := time.Now()
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK, limit: limit}
+		next.ServeHTTP(rec, r)
+
+		if !sampled && rec.status < http.StatusBadRequest {
+			return
+		}
+		entry := &store.RequestLogEntry{
+			CreatedAt:       start,
+			Method:          r.Method,
+			Path:            l.cfg.Redactor.String(path),
+			Model:           modelFromRequest(path, reqBody),
+			APIKeyHash:      apiKeyScope(r.Header),
+			APIKeyHint:      apiKeyHint(r.Header),
+			Status:          rec.status,
+			LatencyMS:       time.Since(start).Milliseconds(),
+			RemoteAddr:      r.RemoteAddr,
+			RequestHeaders:  l.cfg.Redactor.Headers(r.Header),
+			RequestBody:     l.cfg.Redactor.String(string(reqBody)),
+			ResponseHeaders: l.cfg.Redactor.Headers(w.Header()),
+			ResponseBody:    l.cfg.Redactor.String(rec.buf.String()),
+			Truncated:       reqTruncated || rec.overflow,
+		}
+		l.enqueue(entry)
+	})
+}
+
+func (l *RequestLogger) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := store.RequestLogFilter{
+		Model: strings.TrimSpace(q.Get("model")),
+		Query: strings.TrimSpace(q.Get("q")),
+	}
+	var err error
+	if filter.Since, err = parseTimeParam(q.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+		return
+	}
+	if filter.Until, err = parseTimeParam(q.Get("until")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid until: "+err.Error())
+		return
+	}
+	// Full keys are accepted in a header only, so they never end up in access logs.
+	if q.Has("key") {
+		writeError(w, http.StatusBadRequest, "pass the API key in "+requestLogKeyHeader+" or filter by key_hint")
+		return
+	}
+	filter.APIKeyHint = strings.TrimSpace(q.Get("key_hint"))
+	if key := strings.TrimSpace(r.Header.Get(requestLogKeyHeader)); key != "" {
+		filter.APIKeyHash = hashAPIKey(key)
+	}
+	for name, dst := range map[string]*int{"status": &filter.Status, "min_status": &filter.MinStatus, "limit": &filter.Limit} {
+		if raw := q.Get(name); raw != "" {
+			if *dst, err = strconv.Atoi(raw); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+		}
+	}
+	if raw := q.Get("before_id"); raw != "" {
+		if filter.BeforeID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid before_id")
+			return
+		}
+	}
+	entries, err := l.store.Search(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []store.RequestLogEntry{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries})
+}
+
+func (l *RequestLogger) handleGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	entry, err := l.store.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "entry not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, "/v1/") || strings.HasPrefix(path, "/v1beta/") || strings.HasPrefix(path, "/api/")
+}
+
+// modelFromRequest reads the model from an OpenAI/Claude style body or a Gemini
+// style path. body may be a truncated prefix of the request.
+func modelFromRequest(path string, body []byte) string {
+	if model := modelFromBody(body); model != "" {
+		return model
+	}
+	if idx := strings.Index(path, "/models/"); idx != -1 {
+		model := path[idx+len("/models/"):]
+		if colon := strings.Index(model, ":"); colon != -1 {
+			model = model[:colon]
+		}
+		return model
+	}
+	return ""
+}
+
+// modelFromBody scans the top-level fields of a JSON object for "model". It
+// stops at the first syntax error, so a model that appears before the end of a
+// truncated body is still found.
+func modelFromBody(body []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return ""
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if key == "model" {
+			var model string
+			if dec.Decode(&model) != nil {
+				return ""
+			}
+			return model
+		}
+		var skip json.RawMessage
+		if dec.Decode(&skip) != nil {
+			return ""
+		}
+	}
+	return ""
+}
+
+// apiKeyHint renders a short, non-reversible hint of the caller's key (e.g. "heli...-key").
+func apiKeyHint(header http.Header) string {
+	key := clientAPIKey(header)
+	if len(key) <= 8 {
+		if key == "" {
+			return ""
+		}
+		return "***"
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
+
+func parseTimeParam(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
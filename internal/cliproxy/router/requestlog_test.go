@@ -0,0 +1,151 @@
+package router
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+// memoryRequestLog is an in-memory RequestLogStore that records searches.
+type memoryRequestLog struct {
+	mu      sync.Mutex
+	entries []store.RequestLogEntry
+	filter  store.RequestLogFilter
+}
+
+func (m *memoryRequestLog) Insert(_ context.Context, entry *store.RequestLogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func (m *memoryRequestLog) Search(_ context.Context, filter store.RequestLogFilter) ([]store.RequestLogEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filter = filter
+	return m.entries, nil
+}
+
+func (m *memoryRequestLog) Get(context.Context, int64) (*store.RequestLogEntry, error) {
+	return nil, store.ErrNotFound
+}
+
+func (m *memoryRequestLog) DeleteOlderThan(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestRequestLogBoundsCapturedBodies(t *testing.T) {
+	var received string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+		received = string(body)
+		_, _ = io.WriteString(w, "0123456789")
+		_, _ = io.WriteString(w, "abcdefghij")
+	})
+	st := &memoryRequestLog{}
+	l := NewRequestLogger(st, RequestLogConfig{MaxBodyBytes: 32})
+
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"` + strings.Repeat("x", 100) + `"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/cliproxy/v1/chat/completions", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	l.Middleware(upstream).ServeHTTP(rec, req)
+	l.Close()
+
+	if received != body {
+		t.Fatalf("upstream received %d bytes, want the full %d", len(received), len(body))
+	}
+	if req.ContentLength != int64(len(body)) {
+		t.Fatalf("ContentLength = %d, want %d", req.ContentLength, len(body))
+	}
+	if rec.Body.String() != "0123456789abcdefghij" {
+		t.Fatalf("client received %q", rec.Body.String())
+	}
+	if len(st.entries) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(st.entries))
+	}
+	entry := st.entries[0]
+	if entry.RequestBody != body[:32] {
+		t.Fatalf("RequestBody = %q, want the first 32 bytes", entry.RequestBody)
+	}
+	if entry.Model != "gpt-4o" {
+		t.Fatalf("Model = %q, want gpt-4o from the truncated body", entry.Model)
+	}
+	if entry.ResponseBody != "0123456789abcdefghij" {
+		t.Fatalf("ResponseBody = %q", entry.ResponseBody)
+	}
+	if !entry.Truncated {
+		t.Fatal("entry not marked truncated")
+	}
+}
+
+func TestRecordingWriterKeepsPrefix(t *testing.T) {
+	rec := &recordingWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK, limit: 8}
+	for _, chunk := range []string{"abc", "defgh", "ijk", "lmn"} {
+		if _, err := io.WriteString(rec, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := rec.buf.String(); got != "abcdefgh" {
+		t.Fatalf("buffer = %q, want the first 8 bytes", got)
+	}
+	if !rec.overflow {
+		t.Fatal("overflow not set")
+	}
+}
+
+func TestRequestLogSearchKeyFilters(t *testing.T) {
+	st := &memoryRequestLog{}
+	l := NewRequestLogger(st, RequestLogConfig{})
+	defer l.Close()
+
+	rec := httptest.NewRecorder()
+	l.handleSearch(rec, httptest.NewRequest(http.MethodGet, "/admin/api/request-logs?key=sk-secret", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("?key= status = %d, want 400", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/api/request-logs?key_hint=sk-a...wxyz", nil)
+	req.Header.Set(requestLogKeyHeader, "sk-secret")
+	rec = httptest.NewRecorder()
+	l.handleSearch(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if st.filter.APIKeyHint != "sk-a...wxyz" || st.filter.APIKeyHash != hashAPIKey("sk-secret") {
+		t.Fatalf("filter = %+v", st.filter)
+	}
+}
+
+func TestModelFromRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{"openai body", "/v1/chat/completions", `{"messages":[{"model":"nested"}],"model":"gpt-4o"}`, "gpt-4o"},
+		{"truncated after model", "/v1/messages", `{"model":"claude-sonnet","messages":[{"role":"us`, "claude-sonnet"},
+		{"truncated before model", "/v1/messages", `{"messages":[{"role":"us`, ""},
+		{"gemini path", "/v1beta/models/gemini-2.5-pro:generateContent", `{"contents":[]}`, "gemini-2.5-pro"},
+		{"not json", "/v1/completions", `model=x`, ""},
+		{"empty", "/v1/models", ``, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := modelFromRequest(tt.path, []byte(tt.body)); got != tt.want {
+				t.Fatalf("modelFromRequest = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,22 +1,78 @@
 package router
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/configreload"
+	"helixrun-cliproxy-starter/internal/cliproxy/configsync"
+	"helixrun-cliproxy-starter/internal/cliproxy/cooldowns"
+	"helixrun-cliproxy-starter/internal/cliproxy/credpool"
+	"helixrun-cliproxy-starter/internal/cliproxy/errorlogs"
+	"helixrun-cliproxy-starter/internal/cliproxy/events"
+	"helixrun-cliproxy-starter/internal/cliproxy/healthprobe"
+	"helixrun-cliproxy-starter/internal/cliproxy/tokenrefresh"
+	"helixrun-cliproxy-starter/internal/redact"
+	"helixrun-cliproxy-starter/internal/store"
 )
 
+const maxRedactedErrorBody = 1 << 20
+
 // Server proxies /cliproxy requests and exposes HelixRun admin endpoints.
 type Server struct {
-	srv *http.Server
+	srv      *http.Server
+	inflight *inflightTracker
+	activity *activityFeed
+	draining atomic.Bool
+}
+
+// Options carries optional HelixRun features wired into the public server.
+type Options struct {
+	// Cache serves deterministic completion requests from a response cache when set.
+	Cache *ResponseCache
+	// RequestLog captures proxied API request/response pairs when set.
+	RequestLog *RequestLogger
+	// ErrorLogs exposes the CLIProxy error-*.log files through the admin API when set.
+	ErrorLogs *errorlogs.Index
+	// ConfigReload exposes cliproxy.yaml reload status through the admin API when set.
+	ConfigReload *configreload.Reloader
+	// ConfigSync exposes the versioned Postgres config store through the admin API when set.
+	ConfigSync *configsync.Syncer
+	// TokenStore exposes auth mirror reconciliation, backend health, connection
+	// pool stats (Postgres) and outbox metrics when set.
+	TokenStore *store.TokenStore
+	// TokenRefresh exposes the credential expiry scheduler when set.
+	TokenRefresh *tokenrefresh.Scheduler
+	// HealthProbe exposes per-credential test calls when set.
+	HealthProbe *healthprobe.Prober
+	// CredentialPools exposes credential pools and their bindings when set.
+	CredentialPools *credpool.Router
+	// Cooldowns exposes the cooldowns shared between replicas when set.
+	Cooldowns *cooldowns.Tracker
+	// Events exposes event subscriptions and the delivery log when set.
+	Events *events.Bus
+	// Redactor masks secrets in access logs, admin log views and (optionally)
+	// proxied error bodies. Defaults to the built-in rules.
+	Redactor *redact.Redactor
+	// RedactErrorBodies rewrites upstream error responses (status >= 400) through Redactor.
+	RedactErrorBodies bool
 }
 
 // New constructs a server using the provided dependencies.
-func New(addr string, cliproxyBase *url.URL, managementKey string) *Server {
+func New(addr string, cliproxyBase *url.URL, managementKey string, opts Options) *Server {
+	if opts.Redactor == nil {
+		opts.Redactor = redact.Default()
+	}
+	s := &Server{inflight: newInflightTracker(), activity: newActivityFeed()}
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -24,10 +80,95 @@ func New(addr string, cliproxyBase *url.URL, managementKey string) *Server {
 		_, _ = w.Write([]byte("ok"))
 	})
 
+	// /readyz turns unhealthy as soon as shutdown begins so load balancers stop routing here.
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("draining"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
 	// Serve static admin UI assets (management.html, etc.).
 	mux.Handle("/admin/", http.StripPrefix("/admin/", http.FileServer(http.Dir("./config/static"))))
 
+	if opts.Cache != nil {
+		mux.Handle("GET /admin/api/cache", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, opts.Cache.Stats())
+		})))
+		mux.Handle("DELETE /admin/api/cache", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := opts.Cache.Purge(r.Context()); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})))
+	}
+
+	if opts.RequestLog != nil {
+		mux.Handle("GET /admin/api/request-logs", requireManagementKey(managementKey, http.HandlerFunc(opts.RequestLog.handleSearch)))
+		mux.Handle("GET /admin/api/request-logs/{id}", requireManagementKey(managementKey, http.HandlerFunc(opts.RequestLog.handleGet)))
+	}
+
+	if opts.ErrorLogs != nil {
+		registerErrorLogRoutes(mux, managementKey, opts.ErrorLogs, opts.Redactor)
+	}
+
+	if opts.ConfigReload != nil {
+		registerConfigReloadRoutes(mux, managementKey, opts.ConfigReload)
+	}
+
+	if opts.ConfigSync != nil {
+		registerConfigStoreRoutes(mux, managementKey, opts.ConfigSync)
+	}
+
+	if opts.TokenStore != nil {
+		registerAuthSyncRoutes(mux, managementKey, opts.TokenStore)
+		registerDatabaseRoutes(mux, managementKey, opts.TokenStore)
+		registerCredentialRoutes(mux, managementKey, opts.TokenStore)
+	}
+
+	if opts.TokenRefresh != nil {
+		registerTokenRefreshRoutes(mux, managementKey, opts.TokenRefresh)
+	}
+
+	if opts.HealthProbe != nil {
+		registerHealthProbeRoutes(mux, managementKey, opts.HealthProbe)
+	}
+
+	if opts.CredentialPools != nil {
+		registerCredentialPoolRoutes(mux, managementKey, opts.CredentialPools)
+	}
+	if opts.Cooldowns != nil {
+		registerCooldownRoutes(mux, managementKey, opts.Cooldowns)
+	}
+	if opts.Events != nil {
+		registerEventRoutes(mux, managementKey, opts.Events)
+	}
+
+	// Live view of proxied traffic. EventSource cannot send the management key
+	// header, so the admin UI reads the stream with fetch.
+	mux.Handle("GET /admin/api/activity", requireManagementKey(managementKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"requests": s.activity.recent(), "subscribers": s.activity.subscribers()})
+	})))
+	mux.Handle("GET /admin/api/activity/stream", requireManagementKey(managementKey, http.HandlerFunc(s.activity.handleStream)))
+
+	registerMetricsRoute(mux, managementKey, s, opts)
+
 	proxy := httputil.NewSingleHostReverseProxy(cliproxyBase)
+	if opts.RedactErrorBodies {
+		proxy.ModifyResponse = redactErrorResponse(opts.Redactor)
+	}
+	var proxyHandler http.Handler = withoutWriteDeadline(http.StripPrefix("/cliproxy", proxy))
+	if opts.Cache != nil {
+		proxyHandler = opts.Cache.Middleware(proxyHandler)
+	}
+	if opts.RequestLog != nil {
+		proxyHandler = opts.RequestLog.Middleware(proxyHandler)
+	}
+	proxyHandler = s.activity.middleware(proxyHandler)
 	mux.Handle("/cliproxy/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if managementKey != "" {
 			path := strings.TrimPrefix(r.URL.Path, "/cliproxy")
@@ -38,18 +179,18 @@ func New(addr string, cliproxyBase *url.URL, managementKey string) *Server {
 				r.Header.Set("X-Management-Key", managementKey)
 			}
 		}
-		http.StripPrefix("/cliproxy", proxy).ServeHTTP(w, r)
+		proxyHandler.ServeHTTP(w, r)
 	}))
 
-	srv := &http.Server{
+	s.srv = &http.Server{
 		Addr:         addr,
-		Handler:      loggingMiddleware(mux),
+		Handler:      loggingMiddleware(s.inflight.middleware(mux, opts.Redactor), opts.Redactor),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
 
-	return &Server{srv: srv}
+	return s
 }
 
 // Start begins serving HTTP traffic.
@@ -57,9 +198,30 @@ func (s *Server) Start() error {
 	return s.srv.ListenAndServe()
 }
 
-// Shutdown attempts a graceful stop.
+// MarkDraining makes /readyz report 503 while the server keeps serving traffic,
+// and ends the live activity streams so they do not hold up the drain.
+func (s *Server) MarkDraining() {
+	s.draining.Store(true)
+	s.activity.close()
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests,
+// including streamed completions, until ctx expires. Requests still running at
+// the deadline are logged and their connections are closed.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.srv.Shutdown(ctx)
+	s.MarkDraining()
+	if n := s.inflight.count(); n > 0 {
+		log.Printf("draining %d in-flight request(s)", n)
+	}
+	err := s.srv.Shutdown(ctx)
+	if err == nil {
+		return nil
+	}
+	for _, req := range s.inflight.snapshot() {
+		log.Printf("shutdown: aborting %s %s from %s after %s", req.Method, req.Path, req.Remote, time.Since(req.Start).Round(time.Millisecond))
+	}
+	_ = s.srv.Close()
+	return err
 }
 
 // Addr returns listening address.
@@ -67,10 +229,54 @@ func (s *Server) Addr() string {
 	return s.srv.Addr
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
+func loggingMiddleware(next http.Handler, redactor *redact.Redactor) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s from %s in %s", r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
+		log.Printf("%s %s from %s in %s", r.Method, redactor.String(r.URL.RequestURI()), r.RemoteAddr, time.Since(start))
 	})
 }
+
+// withoutWriteDeadline lifts the server's WriteTimeout for proxied calls, as
+// streamed completions routinely run longer than a minute. The response writer
+// wrappers in front of it implement Unwrap so the deadline reaches the connection.
+func withoutWriteDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redactErrorResponse masks secrets in upstream error bodies, which may echo
+// credentials or prompt content back to the caller.
+func redactErrorResponse(redactor *redact.Redactor) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		if resp.StatusCode < http.StatusBadRequest || resp.Body == nil {
+			return nil
+		}
+		if enc := resp.Header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+			return nil
+		}
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			return nil
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxRedactedErrorBody+1))
+		if err != nil {
+			return err
+		}
+		if len(body) > maxRedactedErrorBody {
+			// Too large to rewrite safely; pass through what was read plus the remainder.
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+			return nil
+		}
+		_ = resp.Body.Close()
+		body = redactor.Bytes(body)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return nil
+	}
+}
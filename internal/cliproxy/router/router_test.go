@@ -0,0 +1,141 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"helixrun-cliproxy-starter/internal/redact"
+)
+
+func TestRedactErrorResponse(t *testing.T) {
+	const secret = `{"error":"invalid key sk-abcdefghijklmnop1234"}`
+	const masked = `{"error":"invalid key [REDACTED]"}`
+	large := secret + strings.Repeat(" ", maxRedactedErrorBody)
+
+	tests := []struct {
+		name    string
+		status  int
+		header  http.Header
+		body    string
+		want    string
+		rewrite bool
+	}{
+		{"client error", http.StatusUnauthorized, nil, secret, masked, true},
+		{"server error", http.StatusBadGateway, http.Header{"Content-Encoding": {"identity"}}, secret, masked, true},
+		{"success untouched", http.StatusOK, nil, secret, secret, false},
+		{"compressed untouched", http.StatusBadRequest, http.Header{"Content-Encoding": {"gzip"}}, secret, secret, false},
+		{"event stream untouched", http.StatusBadRequest, http.Header{"Content-Type": {"text/event-stream"}}, secret, secret, false},
+		{"over the limit passed through", http.StatusBadRequest, nil, large, large, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"Content-Length": {strconv.Itoa(len(tt.body))}}
+			for k, v := range tt.header {
+				header[k] = v
+			}
+			resp := &http.Response{
+				StatusCode:    tt.status,
+				Header:        header,
+				Body:          io.NopCloser(strings.NewReader(tt.body)),
+				ContentLength: int64(len(tt.body)),
+			}
+			if err := redactErrorResponse(redact.Default())(resp); err != nil {
+				t.Fatalf("redactErrorResponse: %v", err)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("body = %.80q (%d bytes), want %.80q (%d bytes)", got, len(got), tt.want, len(tt.want))
+			}
+			if resp.ContentLength != int64(len(tt.want)) {
+				t.Fatalf("ContentLength = %d, want %d", resp.ContentLength, len(tt.want))
+			}
+			if got := resp.Header.Get("Content-Length"); got != strconv.Itoa(len(tt.want)) {
+				t.Fatalf("Content-Length header = %s, want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestRedactErrorResponseThroughProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, `{"error":{"message":"Incorrect API key provided: sk-abcdefghijklmnop1234"}}`)
+	}))
+	defer upstream.Close()
+	target, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ModifyResponse = redactErrorResponse(redact.Default())
+	front := httptest.NewServer(proxy)
+	defer front.Close()
+
+	resp, err := http.Get(front.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"error":{"message":"Incorrect API key provided: [REDACTED]"}}`
+	if string(body) != want {
+		t.Fatalf("body = %s, want %s", body, want)
+	}
+	if resp.ContentLength != int64(len(want)) {
+		t.Fatalf("client saw Content-Length %d, want %d", resp.ContentLength, len(want))
+	}
+}
+
+func TestProxyStreamOutlivesWriteTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 4; i++ {
+			_, _ = io.WriteString(w, "data: {}\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+	target, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestLog := NewRequestLogger(&memoryRequestLog{}, RequestLogConfig{})
+	defer requestLog.Close()
+	s := New("", target, "", Options{
+		Cache:      NewResponseCache(NewMemoryCache(0, 0), CacheConfig{}),
+		RequestLog: requestLog,
+	})
+	front := httptest.NewUnstartedServer(s.srv.Handler)
+	front.Config.WriteTimeout = 150 * time.Millisecond
+	front.Start()
+	defer front.Close()
+
+	resp, err := http.Post(front.URL+"/cliproxy/v1/chat/completions", "application/json", strings.NewReader(`{"model":"m","stream":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("stream cut off after %q: %v", body, err)
+	}
+	if !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Fatalf("stream ended early: %q", body)
+	}
+}
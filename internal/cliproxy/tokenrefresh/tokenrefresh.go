@@ -0,0 +1,451 @@
+// Package tokenrefresh refreshes OAuth credentials ahead of their expiry and
+// raises alerts for credentials that could not be refreshed.
+//
+// Refreshes are performed by the embedded CLIProxy auth manager, which calls
+// the provider executor and persists the result through the registered token
+// store (TokenStore.Save in store mode). The scheduler widens the refresh lead
+// of every provider that supports proactive refresh, reads expiry from the
+// stored auth metadata and watches the manager for failed refreshes and
+// rejected credentials.
+package tokenrefresh
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+
+	"helixrun-cliproxy-starter/internal/cliproxy/events"
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+const (
+	defaultLead        = 30 * time.Minute
+	defaultInterval    = time.Minute
+	defaultAlertRepeat = 6 * time.Hour
+)
+
+// Alert kinds.
+const (
+	// AlertRefreshFailed means the last refresh inside the lead window failed.
+	AlertRefreshFailed = "refresh_failed"
+	// AlertExpired means the token expired without being refreshed.
+	AlertExpired = "expired"
+	// AlertReauthRequired means the provider rejected the credential (401/403)
+	// and the account has to log in again.
+	AlertReauthRequired = "reauth_required"
+)
+
+// providers are the CLIProxy OAuth providers. Those without a refresh lead
+// (Gemini, Copilot) refresh on demand and are left alone.
+var providers = []string{"codex", "claude", "qwen", "iflow", "gemini", "gemini-cli", "antigravity", "cline", "kiro", "copilot"}
+
+var (
+	leadsOnce sync.Once
+	baseLeads map[string]time.Duration
+)
+
+// Config tunes the scheduler.
+type Config struct {
+	// Lead is the minimum time before expiry at which a token is refreshed;
+	// providers with a longer built-in lead keep theirs. Default 30m.
+	Lead time.Duration
+	// Interval between expiry checks; default 1m.
+	Interval time.Duration
+	// AlertRepeat is how long an unchanged alert stays quiet; default 6h.
+	AlertRepeat time.Duration
+}
+
+// Source lists stored credentials with their extracted metadata.
+type Source func(ctx context.Context, filter store.AuthFilter) ([]store.AuthSummary, error)
+
+// Alert is one credential problem, as logged and published on the events bus.
+type Alert struct {
+	Kind      string     `json:"kind"`
+	ID        string     `json:"id"`
+	Provider  string     `json:"provider"`
+	Label     string     `json:"label,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Message   string     `json:"message"`
+	Time      time.Time  `json:"time"`
+}
+
+// Status is the scheduler's view of one credential inside its refresh window
+// or with an open alert.
+type Status struct {
+	ID              string     `json:"id"`
+	Provider        string     `json:"provider"`
+	Label           string     `json:"label,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	RefreshAt       *time.Time `json:"refresh_at,omitempty"`
+	LastRefreshedAt *time.Time `json:"last_refreshed_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	Alert           string     `json:"alert,omitempty"`
+	AlertedAt       *time.Time `json:"alerted_at,omitempty"`
+}
+
+// Scheduler watches credential expiry. Hook must be installed on the auth
+// manager so refresh outcomes and rejected credentials are observed.
+type Scheduler struct {
+	cfg     Config
+	source  Source
+	manager *coreauth.Manager
+	events  *events.Bus
+
+	mu       sync.Mutex
+	statuses map[string]*Status
+	// reauth holds credentials rejected by the provider until they change.
+	reauth    map[string]string
+	lastCheck time.Time
+}
+
+// New creates a scheduler reading expiry from source. The auth manager is
+// attached with SetManager once it exists.
+func New(cfg Config, source Source) *Scheduler {
+	if cfg.Lead <= 0 {
+		cfg.Lead = defaultLead
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.AlertRepeat <= 0 {
+		cfg.AlertRepeat = defaultAlertRepeat
+	}
+	return &Scheduler{
+		cfg:      cfg,
+		source:   source,
+		statuses: make(map[string]*Status),
+		reauth:   make(map[string]string),
+	}
+}
+
+// SetSource replaces the credential source; used in file mode, where the
+// source is the auth manager itself.
+func (s *Scheduler) SetSource(source Source) {
+	s.mu.Lock()
+	s.source = source
+	s.mu.Unlock()
+}
+
+// SetManager attaches the auth manager whose state is inspected on every check.
+func (s *Scheduler) SetManager(manager *coreauth.Manager) {
+	s.mu.Lock()
+	s.manager = manager
+	s.mu.Unlock()
+}
+
+// SetEvents publishes every alert on bus.
+func (s *Scheduler) SetEvents(bus *events.Bus) {
+	s.mu.Lock()
+	s.events = bus
+	s.mu.Unlock()
+}
+
+// RegisterLeads raises the refresh lead of every provider that refreshes
+// proactively to at least cfg.Lead, so the auth manager refreshes earlier.
+func (s *Scheduler) RegisterLeads() {
+	leadsOnce.Do(func() {
+		baseLeads = make(map[string]time.Duration)
+		for _, provider := range providers {
+			if lead := coreauth.ProviderRefreshLead(provider, nil); lead != nil {
+				baseLeads[provider] = *lead
+			}
+		}
+	})
+	for provider, base := range baseLeads {
+		lead := max(base, s.cfg.Lead)
+		coreauth.RegisterRefreshLeadProvider(provider, func() *time.Duration { return &lead })
+	}
+}
+
+// leadFor returns the effective refresh lead, or zero for providers that
+// refresh on demand.
+func (s *Scheduler) leadFor(provider string) time.Duration {
+	base, ok := baseLeads[provider]
+	if !ok {
+		return 0
+	}
+	return max(base, s.cfg.Lead)
+}
+
+// Run checks expiry every cfg.Interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Check(ctx); err != nil {
+				log.Printf("token refresh: %v", err)
+			}
+		}
+	}
+}
+
+// Check compares stored expiry with the auth manager's refresh state and
+// raises alerts for credentials that are expired, failing to refresh or
+// rejected by their provider.
+func (s *Scheduler) Check(ctx context.Context) error {
+	now := time.Now()
+	var maxLead time.Duration
+	for provider := range baseLeads {
+		maxLead = max(maxLead, s.leadFor(provider))
+	}
+	disabled := false
+	s.mu.Lock()
+	source, manager := s.source, s.manager
+	s.mu.Unlock()
+	summaries, err := source(ctx, store.AuthFilter{Disabled: &disabled, ExpiresBefore: now.Add(maxLead)})
+	if err != nil {
+		return fmt.Errorf("list credentials: %w", err)
+	}
+
+	seen := make(map[string]struct{}, len(summaries))
+	var alerts []Alert
+	for _, sum := range summaries {
+		var auth *coreauth.Auth
+		if manager != nil {
+			auth, _ = manager.GetByID(sum.ID)
+		}
+		status, ok := evaluate(sum, auth, s.leadFor(sum.Provider), now)
+		if !ok {
+			continue
+		}
+		seen[sum.ID] = struct{}{}
+		if alert, ok := s.record(status, now); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	s.mu.Lock()
+	for id, st := range s.statuses {
+		if _, ok := seen[id]; !ok && st.Alert != AlertReauthRequired {
+			delete(s.statuses, id)
+		}
+	}
+	s.lastCheck = now
+	s.mu.Unlock()
+
+	for _, alert := range alerts {
+		s.raise(alert)
+	}
+	return nil
+}
+
+// evaluate returns the refresh status of a credential, or false when it is
+// outside its refresh window or its provider refreshes on demand (zero lead).
+// auth is the auth manager's copy, if loaded; its refresh backoff tells a
+// failing refresh apart from one that has not run yet.
+func evaluate(sum store.AuthSummary, auth *coreauth.Auth, lead time.Duration, now time.Time) (Status, bool) {
+	if lead <= 0 || sum.ExpiresAt == nil || sum.ExpiresAt.Sub(now) > lead {
+		return Status{}, false
+	}
+	refreshAt := sum.ExpiresAt.Add(-lead)
+	status := Status{ID: sum.ID, Provider: sum.Provider, Label: sum.Label, ExpiresAt: sum.ExpiresAt, RefreshAt: &refreshAt}
+	if auth != nil {
+		if !auth.LastRefreshedAt.IsZero() {
+			refreshed := auth.LastRefreshedAt
+			status.LastRefreshedAt = &refreshed
+		}
+		if auth.LastError != nil {
+			status.LastError = auth.LastError.Message
+		}
+	}
+	switch {
+	case !sum.ExpiresAt.After(now):
+		status.Alert = AlertExpired
+	case auth != nil && auth.LastError != nil && auth.NextRefreshAfter.After(now):
+		// The manager backs off after a failed refresh.
+		status.Alert = AlertRefreshFailed
+	}
+	return status, true
+}
+
+// record stores status and returns an alert when it opens a new alert or
+// repeats one that has been quiet for cfg.AlertRepeat.
+func (s *Scheduler) record(status Status, now time.Time) (Alert, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg, ok := s.reauth[status.ID]; ok {
+		status.Alert = AlertReauthRequired
+		status.LastError = msg
+	}
+	prev := s.statuses[status.ID]
+	if prev != nil && prev.Alert == status.Alert {
+		status.AlertedAt = prev.AlertedAt
+	}
+	s.statuses[status.ID] = &status
+	if status.Alert == "" || (status.AlertedAt != nil && now.Sub(*status.AlertedAt) < s.cfg.AlertRepeat) {
+		return Alert{}, false
+	}
+	alertedAt := now
+	status.AlertedAt = &alertedAt
+	return Alert{
+		Kind:      status.Alert,
+		ID:        status.ID,
+		Provider:  status.Provider,
+		Label:     status.Label,
+		ExpiresAt: status.ExpiresAt,
+		Message:   alertMessage(status),
+		Time:      now,
+	}, true
+}
+
+func alertMessage(status Status) string {
+	switch status.Alert {
+	case AlertExpired:
+		return fmt.Sprintf("token expired at %s without a successful refresh", status.ExpiresAt.Format(time.RFC3339))
+	case AlertRefreshFailed:
+		return "refresh failed: " + status.LastError
+	default:
+		return "provider rejected the credential, log in again: " + status.LastError
+	}
+}
+
+// raise logs alert and publishes it on the events bus, whose subscriptions
+// deliver it to webhooks, Slack or e-mail.
+func (s *Scheduler) raise(alert Alert) {
+	log.Printf("token refresh: %s %s (%s): %s", alert.Kind, alert.ID, alert.Provider, alert.Message)
+	s.mu.Lock()
+	bus := s.events
+	s.mu.Unlock()
+	bus.Publish(alertEvent(alert))
+}
+
+func alertEvent(alert Alert) events.Event {
+	ev := events.Event{
+		Type:     "credential." + alert.Kind,
+		Severity: events.SeverityCritical,
+		Subject:  alert.ID,
+		Message:  alert.Message,
+		Data:     map[string]any{"provider": alert.Provider},
+		Time:     alert.Time,
+	}
+	if alert.Kind == AlertRefreshFailed {
+		ev.Severity = events.SeverityWarning
+	}
+	if alert.Label != "" {
+		ev.Data["label"] = alert.Label
+	}
+	if alert.ExpiresAt != nil {
+		ev.Data["expires_at"] = alert.ExpiresAt
+	}
+	return ev
+}
+
+// Statuses returns the credentials inside their refresh window or with an
+// open alert, ordered by id, and the time of the last check.
+func (s *Scheduler) Statuses() ([]Status, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, 0, len(s.statuses))
+	for _, st := range s.statuses {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, s.lastCheck
+}
+
+// Hook returns the auth manager hook that tracks refreshes and rejected
+// credentials.
+func (s *Scheduler) Hook() coreauth.Hook {
+	return schedulerHook{s}
+}
+
+type schedulerHook struct {
+	s *Scheduler
+}
+
+func (h schedulerHook) OnAuthRegistered(ctx context.Context, auth *coreauth.Auth) {
+	h.OnAuthUpdated(ctx, auth)
+}
+
+// OnAuthUpdated clears a re-login alert once the credential was refreshed or
+// replaced without an error.
+func (h schedulerHook) OnAuthUpdated(_ context.Context, auth *coreauth.Auth) {
+	if auth != nil && auth.LastError == nil {
+		h.s.clearReauth(auth.ID)
+	}
+}
+
+// OnResult flags credentials the provider rejected as unauthorized. It runs
+// on the request path, so the alert is raised in the background.
+func (h schedulerHook) OnResult(_ context.Context, result coreauth.Result) {
+	if result.Success {
+		h.s.clearReauth(result.AuthID)
+		return
+	}
+	if result.Error == nil {
+		return
+	}
+	if code := result.Error.HTTPStatus; code != http.StatusUnauthorized && code != http.StatusForbidden {
+		return
+	}
+	h.s.mu.Lock()
+	_, known := h.s.reauth[result.AuthID]
+	h.s.reauth[result.AuthID] = result.Error.Message
+	manager := h.s.manager
+	h.s.mu.Unlock()
+	if known {
+		return
+	}
+	status := Status{ID: result.AuthID, Provider: result.Provider, LastError: result.Error.Message}
+	if manager != nil {
+		if auth, ok := manager.GetByID(result.AuthID); ok && auth != nil {
+			status.Label = auth.Label
+			if expiry, hasExpiry := auth.ExpirationTime(); hasExpiry {
+				status.ExpiresAt = &expiry
+			}
+		}
+	}
+	if alert, ok := h.s.record(status, time.Now()); ok {
+		go h.s.raise(alert)
+	}
+}
+
+func (s *Scheduler) clearReauth(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reauth[id]; !ok {
+		return
+	}
+	delete(s.reauth, id)
+	if st := s.statuses[id]; st != nil && st.Alert == AlertReauthRequired {
+		delete(s.statuses, id)
+	}
+}
+
+// ManagerSource lists the credentials loaded by the auth manager, for file
+// mode where no token store keeps extracted metadata.
+func ManagerSource(manager *coreauth.Manager) Source {
+	return func(_ context.Context, filter store.AuthFilter) ([]store.AuthSummary, error) {
+		var out []store.AuthSummary
+		for _, auth := range manager.List() {
+			sum := store.AuthSummary{
+				ID: auth.ID,
+				AuthMeta: store.AuthMeta{
+					Provider: strings.ToLower(auth.Provider),
+					Label:    auth.Label,
+					Disabled: auth.Disabled,
+				},
+				CreatedAt: auth.CreatedAt,
+				UpdatedAt: auth.UpdatedAt,
+			}
+			if expiry, ok := auth.ExpirationTime(); ok {
+				sum.ExpiresAt = &expiry
+			}
+			if filter.Match(sum) {
+				out = append(out, sum)
+			}
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,150 @@
+package tokenrefresh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+
+	"helixrun-cliproxy-starter/internal/store"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	const lead = 30 * time.Minute
+	at := func(d time.Duration) *time.Time {
+		ts := now.Add(d)
+		return &ts
+	}
+	failed := &coreauth.Error{Message: "invalid_grant"}
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		lead      time.Duration
+		auth      *coreauth.Auth
+		inWindow  bool
+		refreshAt time.Time
+		alert     string
+		lastError string
+	}{
+		{name: "outside the window", expiresAt: at(2 * time.Hour), lead: lead},
+		{name: "no expiry", lead: lead},
+		{name: "refreshes on demand", expiresAt: at(time.Minute), lead: 0},
+		{name: "enters the window", expiresAt: at(lead), lead: lead, inWindow: true, refreshAt: now},
+		{name: "due for refresh", expiresAt: at(10 * time.Minute), lead: lead, inWindow: true, refreshAt: now.Add(-20 * time.Minute)},
+		{
+			name: "refresh failed, manager backing off", expiresAt: at(10 * time.Minute), lead: lead,
+			auth:     &coreauth.Auth{LastError: failed, NextRefreshAfter: now.Add(5 * time.Minute)},
+			inWindow: true, refreshAt: now.Add(-20 * time.Minute), alert: AlertRefreshFailed, lastError: "invalid_grant",
+		},
+		{
+			name: "refresh failed, retry due", expiresAt: at(10 * time.Minute), lead: lead,
+			auth:     &coreauth.Auth{LastError: failed, NextRefreshAfter: now.Add(-time.Second)},
+			inWindow: true, refreshAt: now.Add(-20 * time.Minute), lastError: "invalid_grant",
+		},
+		{
+			name: "expired", expiresAt: at(0), lead: lead,
+			auth:     &coreauth.Auth{LastError: failed, NextRefreshAfter: now.Add(5 * time.Minute)},
+			inWindow: true, refreshAt: now.Add(-lead), alert: AlertExpired, lastError: "invalid_grant",
+		},
+		{name: "long expired", expiresAt: at(-time.Hour), lead: lead, inWindow: true, refreshAt: now.Add(-time.Hour - lead), alert: AlertExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum := store.AuthSummary{ID: "codex.json", AuthMeta: store.AuthMeta{Provider: "codex", ExpiresAt: tt.expiresAt}}
+			status, ok := evaluate(sum, tt.auth, tt.lead, now)
+			if ok != tt.inWindow {
+				t.Fatalf("in window = %v, want %v", ok, tt.inWindow)
+			}
+			if !ok {
+				return
+			}
+			if status.RefreshAt == nil || !status.RefreshAt.Equal(tt.refreshAt) {
+				t.Fatalf("RefreshAt = %v, want %s", status.RefreshAt, tt.refreshAt)
+			}
+			if status.Alert != tt.alert || status.LastError != tt.lastError {
+				t.Fatalf("alert = %q (%q), want %q (%q)", status.Alert, status.LastError, tt.alert, tt.lastError)
+			}
+		})
+	}
+}
+
+func TestRecordRepeatsAlerts(t *testing.T) {
+	s := New(Config{AlertRepeat: time.Hour}, nil)
+	start := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		after time.Duration
+		alert string
+		want  bool
+	}{
+		{0, AlertRefreshFailed, true},
+		{30 * time.Minute, AlertRefreshFailed, false},
+		{61 * time.Minute, AlertRefreshFailed, true},
+		{62 * time.Minute, AlertExpired, true},
+		{63 * time.Minute, AlertExpired, false},
+		{64 * time.Minute, "", false},
+		{65 * time.Minute, AlertExpired, true},
+	}
+	for i, step := range steps {
+		expiresAt := start
+		status := Status{ID: "codex.json", Provider: "codex", ExpiresAt: &expiresAt, Alert: step.alert}
+		alert, raised := s.record(status, start.Add(step.after))
+		if raised != step.want {
+			t.Fatalf("step %d (%s after %s): raised = %v, want %v", i, step.alert, step.after, raised, step.want)
+		}
+		if raised && (alert.Kind != step.alert || alert.ID != "codex.json" || alert.Message == "") {
+			t.Fatalf("step %d: alert = %+v", i, alert)
+		}
+	}
+}
+
+func TestRecordPrefersReauthAlert(t *testing.T) {
+	s := New(Config{}, nil)
+	s.reauth["codex.json"] = "401 unauthorized"
+	alert, raised := s.record(Status{ID: "codex.json", Alert: AlertRefreshFailed}, time.Now())
+	if !raised || alert.Kind != AlertReauthRequired {
+		t.Fatalf("record = %+v, %v; want a reauth_required alert", alert, raised)
+	}
+	s.clearReauth("codex.json")
+	if statuses, _ := s.Statuses(); len(statuses) != 0 {
+		t.Fatalf("statuses after clearReauth = %+v", statuses)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	// Executors register their provider's built-in lead; none are linked here.
+	coreauth.RegisterRefreshLeadProvider("codex", func() *time.Duration {
+		lead := 5 * time.Minute
+		return &lead
+	})
+	s := New(Config{Lead: time.Hour}, nil)
+	s.RegisterLeads()
+	if lead := s.leadFor("codex"); lead != time.Hour {
+		t.Fatalf("codex lead = %s, want the configured minimum of 1h", lead)
+	}
+	now := time.Now()
+	expired, soon, later := now.Add(-time.Minute), now.Add(10*time.Minute), now.Add(48*time.Hour)
+	s.SetSource(func(context.Context, store.AuthFilter) ([]store.AuthSummary, error) {
+		return []store.AuthSummary{
+			{ID: "expired.json", AuthMeta: store.AuthMeta{Provider: "codex", ExpiresAt: &expired}},
+			{ID: "soon.json", AuthMeta: store.AuthMeta{Provider: "codex", ExpiresAt: &soon}},
+			{ID: "later.json", AuthMeta: store.AuthMeta{Provider: "codex", ExpiresAt: &later}},
+			{ID: "ondemand.json", AuthMeta: store.AuthMeta{Provider: "unknown-provider", ExpiresAt: &expired}},
+		}, nil
+	})
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	statuses, checkedAt := s.Statuses()
+	if checkedAt.IsZero() || len(statuses) != 2 {
+		t.Fatalf("statuses = %+v, want expired.json and soon.json", statuses)
+	}
+	if statuses[0].ID != "expired.json" || statuses[0].Alert != AlertExpired || statuses[0].AlertedAt == nil {
+		t.Fatalf("expired.json = %+v", statuses[0])
+	}
+	if statuses[1].ID != "soon.json" || statuses[1].Alert != "" {
+		t.Fatalf("soon.json = %+v", statuses[1])
+	}
+}
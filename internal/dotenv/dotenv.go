@@ -0,0 +1,350 @@
+// Package dotenv loads KEY=value files into the process environment.
+//
+// Supported syntax:
+//
+//	KEY=value                 unquoted; trailing " # comment" is stripped
+//	export KEY=value          optional "export" prefix
+//	KEY = value               whitespace around "=" is ignored
+//	KEY='literal $value'      single quotes: no escapes or expansion, may span lines
+//	KEY="line\nnext ${OTHER}" double quotes: escapes and expansion, may span lines
+//	KEY=${OTHER:-default}/$X  expansion in unquoted and double-quoted values
+//
+// Variables already present in the real environment always win over file
+// values. When several files are loaded, later files override earlier ones.
+package dotenv
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Load reads files in order and sets every variable that is not already part
+// of the process environment. Missing files are skipped.
+func Load(paths ...string) error {
+	real := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		if key, _, ok := strings.Cut(kv, "="); ok {
+			real[key] = true
+		}
+	}
+	loaded := make(map[string]string)
+	realLookup := func(key string) (string, bool) {
+		if real[key] {
+			return os.Getenv(key), true
+		}
+		return "", false
+	}
+	earlier := func(key string) (string, bool) {
+		v, ok := loaded[key]
+		return v, ok
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		vars, err := parse(string(data), realLookup, earlier)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, v := range vars {
+			loaded[v.key] = v.value
+		}
+	}
+	for key, value := range loaded {
+		if real[key] {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("set %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Parse returns the variables defined in data without touching the process
+// environment. References resolve from the environment first, then from
+// variables defined earlier in data.
+func Parse(data string) (map[string]string, error) {
+	vars, err := parse(data, os.LookupEnv, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(vars))
+	for _, v := range vars {
+		out[v.key] = v.value
+	}
+	return out, nil
+}
+
+type variable struct {
+	key   string
+	value string
+}
+
+type lookupFunc func(string) (string, bool)
+
+// literalDollar marks an escaped "\$" in double-quoted values until expansion is done.
+const literalDollar = '\x00'
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+	// Expansion order: real environment, this file, then earlier files.
+	real    lookupFunc
+	local   map[string]string
+	earlier lookupFunc
+}
+
+func parse(data string, real, earlier lookupFunc) ([]variable, error) {
+	p := &parser{
+		src:     strings.ReplaceAll(strings.TrimPrefix(data, "\ufeff"), "\r\n", "\n"),
+		line:    1,
+		real:    real,
+		local:   make(map[string]string),
+		earlier: earlier,
+	}
+	var vars []variable
+	for {
+		p.skipBlankAndComments()
+		if p.pos >= len(p.src) {
+			return vars, nil
+		}
+		// Errors point at the start of the assignment, not where a
+		// multiline value ran out.
+		line := p.line
+		v, err := p.assignment()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		p.local[v.key] = v.value
+		vars = append(vars, v)
+	}
+}
+
+func (p *parser) skipBlankAndComments() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) skipLine() {
+	for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) assignment() (variable, error) {
+	key := p.identifier()
+	if key == "export" {
+		p.skipSpaces()
+		if next := p.identifier(); next != "" {
+			key = next
+		}
+	}
+	if key == "" {
+		return variable{}, fmt.Errorf("expected variable name")
+	}
+	p.skipSpaces()
+	if p.pos >= len(p.src) || p.src[p.pos] != '=' {
+		return variable{}, fmt.Errorf("expected '=' after %s", key)
+	}
+	p.pos++
+	p.skipSpaces()
+
+	var (
+		value string
+		err   error
+	)
+	if p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\'':
+			value, err = p.singleQuoted()
+		case '"':
+			value, err = p.doubleQuoted()
+		default:
+			value, err = p.unquoted()
+		}
+	}
+	if err != nil {
+		return variable{}, fmt.Errorf("%s: %w", key, err)
+	}
+	if err = p.endOfLine(); err != nil {
+		return variable{}, fmt.Errorf("%s: %w", key, err)
+	}
+	return variable{key: key, value: value}, nil
+}
+
+func (p *parser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := rune(p.src[p.pos])
+		if c == '_' || unicode.IsLetter(c) || (p.pos > start && unicode.IsDigit(c)) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+// endOfLine accepts trailing whitespace and a comment after a quoted value.
+func (p *parser) endOfLine() error {
+	p.skipSpaces()
+	if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+		return nil
+	}
+	if p.src[p.pos] == '#' {
+		p.skipLine()
+		return nil
+	}
+	return fmt.Errorf("unexpected %q after value", p.src[p.pos])
+}
+
+func (p *parser) singleQuoted() (string, error) {
+	p.pos++ // opening quote
+	end := strings.IndexByte(p.src[p.pos:], '\'')
+	if end == -1 {
+		return "", fmt.Errorf("unterminated single-quoted value")
+	}
+	value := p.src[p.pos : p.pos+end]
+	p.line += strings.Count(value, "\n")
+	p.pos += end + 1
+	return value, nil
+}
+
+func (p *parser) doubleQuoted() (string, error) {
+	p.pos++ // opening quote
+	var raw strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			value, err := p.expand(raw.String(), false)
+			return strings.ReplaceAll(value, string(rune(literalDollar)), "$"), err
+		case c == '\\' && p.pos+1 < len(p.src):
+			next := p.src[p.pos+1]
+			switch next {
+			case 'n':
+				raw.WriteByte('\n')
+			case 't':
+				raw.WriteByte('\t')
+			case 'r':
+				raw.WriteByte('\r')
+			case '"', '\\':
+				raw.WriteByte(next)
+			case '$':
+				raw.WriteByte(literalDollar)
+			default:
+				raw.WriteByte('\\')
+				raw.WriteByte(next)
+			}
+			p.pos += 2
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			raw.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated double-quoted value")
+}
+
+func (p *parser) unquoted() (string, error) {
+	start := p.pos
+	p.skipLine()
+	value := p.src[start:p.pos]
+	// A '#' only starts a comment when preceded by whitespace, so "a#b" stays intact.
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			value = value[:i]
+			break
+		}
+	}
+	return p.expand(strings.TrimSpace(value), true)
+}
+
+// expand resolves $NAME, ${NAME} and ${NAME:-default}. With backslash set,
+// "\$" yields a literal '$' (double-quoted values escape '$' while scanning).
+func (p *parser) expand(s string, backslash bool) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if backslash && c == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			out.WriteByte('$')
+			i++
+			continue
+		}
+		if c != '$' || i+1 >= len(s) {
+			out.WriteByte(c)
+			continue
+		}
+		if s[i+1] == '{' {
+			end := strings.IndexByte(s[i+2:], '}')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated ${ in value")
+			}
+			ref := s[i+2 : i+2+end]
+			name, def, hasDefault := strings.Cut(ref, ":-")
+			value, ok := p.resolve(name)
+			if hasDefault && (!ok || value == "") {
+				value = def
+			}
+			out.WriteString(value)
+			i += 2 + end
+			continue
+		}
+		j := i + 1
+		for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || (j > i+1 && unicode.IsDigit(rune(s[j])))) {
+			j++
+		}
+		if j == i+1 {
+			out.WriteByte(c)
+			continue
+		}
+		value, _ := p.resolve(s[i+1 : j])
+		out.WriteString(value)
+		i = j - 1
+	}
+	return out.String(), nil
+}
+
+func (p *parser) resolve(name string) (string, bool) {
+	if v, ok := p.real(name); ok {
+		return v, true
+	}
+	if v, ok := p.local[name]; ok {
+		return v, true
+	}
+	if p.earlier != nil {
+		return p.earlier(name)
+	}
+	return "", false
+}
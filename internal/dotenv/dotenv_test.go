@@ -0,0 +1,128 @@
+package dotenv
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Setenv("DOTENV_TEST_REAL", "from-env")
+
+	tests := []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{"plain", "A=1\nB=two words", map[string]string{"A": "1", "B": "two words"}},
+		{"export prefix", "export A=1\nexport  B = 2", map[string]string{"A": "1", "B": "2"}},
+		{"export as a name", "export=1", map[string]string{"export": "1"}},
+		{"spaces around equals", "MANAGEMENT_PASSWORD =\nB = x ", map[string]string{"MANAGEMENT_PASSWORD": "", "B": "x"}},
+		{"single quotes are literal", `A='$HOME \n # not a comment'`, map[string]string{"A": `$HOME \n # not a comment`}},
+		{"double quotes", `A="say \"hi\""`, map[string]string{"A": `say "hi"`}},
+		{"escapes", `A="a\nb\tc\\d\$e\q"`, map[string]string{"A": "a\nb\tc\\d$e\\q"}},
+		{"multiline double quoted", "A=\"line1\nline2\"\nB=3", map[string]string{"A": "line1\nline2", "B": "3"}},
+		{"multiline single quoted", "A='line1\nline2'\nB=3", map[string]string{"A": "line1\nline2", "B": "3"}},
+		{"full-line comments", "# header\n  # indented\nA=1\n\n#B=2", map[string]string{"A": "1"}},
+		{"inline comments", "A=1 # one\nB=\"2\" # two\nC='3'\t# three", map[string]string{"A": "1", "B": "2", "C": "3"}},
+		{"hash without space", "A=a#b", map[string]string{"A": "a#b"}},
+		{"expansion", "A=x\nB=${A}/$A\nC=\"${A}-y\"", map[string]string{"A": "x", "B": "x/x", "C": "x-y"}},
+		{"expansion default", "A=${DOTENV_TEST_UNSET:-fallback}\nB=${A:-no}", map[string]string{"A": "fallback", "B": "fallback"}},
+		{"expansion of unset", "A=[$DOTENV_TEST_UNSET]", map[string]string{"A": "[]"}},
+		{"escaped dollar", `A=\$A` + "\n" + `B="\${A}"`, map[string]string{"A": "$A", "B": "${A}"}},
+		{"real environment in expansion", "A=${DOTENV_TEST_REAL}", map[string]string{"A": "from-env"}},
+		{"crlf and bom", "\ufeffA=1\r\nB=2\r\n", map[string]string{"A": "1", "B": "2"}},
+		{"later wins", "A=1\nA=2", map[string]string{"A": "2"}},
+		{"empty", "", map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"missing equals", "A 1"},
+		{"missing name", "=1"},
+		{"unterminated double quote", `A="abc`},
+		{"unterminated single quote", "A='abc"},
+		{"unterminated brace", "A=${B"},
+		{"text after quoted value", `A="1" 2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.data); err == nil {
+				t.Fatalf("Parse(%q) succeeded, want an error", tt.data)
+			}
+		})
+	}
+}
+
+func TestLoadLayering(t *testing.T) {
+	dir := t.TempDir()
+	env := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	writeFile(t, env, "DOTENV_TEST_A=base\nDOTENV_TEST_B=base\nDOTENV_TEST_C=base\nDOTENV_TEST_HOST=db\n")
+	writeFile(t, local, "DOTENV_TEST_B=local\nDOTENV_TEST_C=local\nDOTENV_TEST_URL=postgres://${DOTENV_TEST_HOST}/x\n")
+
+	for _, key := range []string{"DOTENV_TEST_A", "DOTENV_TEST_B", "DOTENV_TEST_HOST", "DOTENV_TEST_URL"} {
+		unsetenv(t, key)
+	}
+	// Real environment values win over both files.
+	t.Setenv("DOTENV_TEST_C", "real")
+
+	if err := Load(env, local, filepath.Join(dir, "missing.env")); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := map[string]string{
+		"DOTENV_TEST_A":   "base",
+		"DOTENV_TEST_B":   "local",
+		"DOTENV_TEST_C":   "real",
+		"DOTENV_TEST_URL": "postgres://db/x",
+	}
+	for key, value := range want {
+		if got := os.Getenv(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestLoadReportsFileAndLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	writeFile(t, path, "A=1\nB=\"open\n")
+	err := Load(path)
+	if err == nil {
+		t.Fatal("Load succeeded, want an error")
+	}
+	if want := path + ": line 2: B: unterminated double-quoted value"; err.Error() != want {
+		t.Fatalf("error = %q, want %q", err, want)
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// unsetenv removes key for the duration of the test.
+func unsetenv(t *testing.T, key string) {
+	t.Helper()
+	t.Setenv(key, "")
+	if err := os.Unsetenv(key); err != nil {
+		t.Fatal(err)
+	}
+}
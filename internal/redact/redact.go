@@ -0,0 +1,221 @@
+// Package redact masks credentials and personal data before HelixRun logs or
+// persists request data.
+package redact
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Mask is the replacement text used by the built-in rules.
+const Mask = "[REDACTED]"
+
+// Rule replaces every match of Pattern with Replacement. Replacement may use
+// regexp expansion syntax (e.g. "${1}[REDACTED]") to keep surrounding context.
+type Rule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Config selects which rules a Redactor applies.
+type Config struct {
+	// DisableDefaults drops the built-in API key and OAuth token rules.
+	DisableDefaults bool
+	// Emails masks e-mail addresses.
+	Emails bool
+	// Patterns adds custom rules in "name=regex" form; matches are fully masked.
+	Patterns []string
+	// Headers lists extra header names whose values are always masked.
+	Headers []string
+}
+
+// Redactor applies an ordered set of rules to strings and headers.
+type Redactor struct {
+	rules   []Rule
+	headers map[string]struct{}
+}
+
+var defaultHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Goog-Api-Key",
+	"X-Management-Key",
+}
+
+// DefaultRules returns the built-in rules for common credentials.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:        "json-secret-field",
+			Pattern:     regexp.MustCompile(`(?i)("(?:api[_-]?key|access[_-]?token|refresh[_-]?token|id[_-]?token|client[_-]?secret|password|secret|secret[_-]?key)"\s*:\s*")[^"]*(")`),
+			Replacement: "${1}" + Mask + "${2}",
+		},
+		{
+			Name:        "bearer-token",
+			Pattern:     regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{8,}`),
+			Replacement: "${1}" + Mask,
+		},
+		{
+			Name:        "query-credential",
+			Pattern:     regexp.MustCompile(`(?i)([?&](?:key|api_key|access_token|token)=)[^&\s"]+`),
+			Replacement: "${1}" + Mask,
+		},
+		{
+			Name:        "openai-key",
+			Pattern:     regexp.MustCompile(`\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{16,}`),
+			Replacement: Mask,
+		},
+		{
+			Name:        "google-api-key",
+			Pattern:     regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+			Replacement: Mask,
+		},
+		{
+			Name:        "google-oauth-token",
+			Pattern:     regexp.MustCompile(`\bya29\.[0-9A-Za-z_-]{20,}`),
+			Replacement: Mask,
+		},
+		{
+			Name:        "google-refresh-token",
+			Pattern:     regexp.MustCompile(`\b1//[0-9A-Za-z_-]{20,}`),
+			Replacement: Mask,
+		},
+		{
+			Name:        "github-token",
+			Pattern:     regexp.MustCompile(`\b(?:gh[pousr]|github_pat)_[A-Za-z0-9_]{20,}`),
+			Replacement: Mask,
+		},
+		{
+			Name:        "jwt",
+			Pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+			Replacement: Mask,
+		},
+	}
+}
+
+// EmailRule masks e-mail addresses.
+func EmailRule() Rule {
+	return Rule{
+		Name:        "email",
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: "[EMAIL]",
+	}
+}
+
+// ParseRule turns a "name=regex" specification into a fully masking rule.
+func ParseRule(spec string) (Rule, error) {
+	name, expr, ok := strings.Cut(spec, "=")
+	if !ok {
+		name, expr = "custom", spec
+	}
+	name = strings.TrimSpace(name)
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return Rule{}, fmt.Errorf("redact: empty pattern in %q", spec)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("redact: invalid pattern %q: %w", name, err)
+	}
+	return Rule{Name: name, Pattern: re, Replacement: Mask}, nil
+}
+
+// New builds a Redactor from cfg.
+func New(cfg Config) (*Redactor, error) {
+	var rules []Rule
+	if !cfg.DisableDefaults {
+		rules = append(rules, DefaultRules()...)
+	}
+	if cfg.Emails {
+		rules = append(rules, EmailRule())
+	}
+	for _, spec := range cfg.Patterns {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		rule, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	r := NewWithRules(rules...)
+	for _, h := range cfg.Headers {
+		if h = strings.TrimSpace(h); h != "" {
+			r.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+		}
+	}
+	return r, nil
+}
+
+// NewWithRules builds a Redactor from explicit rules plus the default sensitive headers.
+func NewWithRules(rules ...Rule) *Redactor {
+	headers := make(map[string]struct{}, len(defaultHeaders))
+	for _, h := range defaultHeaders {
+		headers[h] = struct{}{}
+	}
+	return &Redactor{rules: rules, headers: headers}
+}
+
+// Default returns a Redactor with the built-in rules.
+func Default() *Redactor {
+	return NewWithRules(DefaultRules()...)
+}
+
+// Rules returns the active rules in application order.
+func (r *Redactor) Rules() []Rule {
+	if r == nil {
+		return nil
+	}
+	return append([]Rule(nil), r.rules...)
+}
+
+// String applies every rule to s.
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		s = rule.Pattern.ReplaceAllString(s, rule.Replacement)
+	}
+	return s
+}
+
+// Bytes applies every rule to b.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil || len(b) == 0 {
+		return b
+	}
+	for _, rule := range r.rules {
+		b = rule.Pattern.ReplaceAll(b, []byte(rule.Replacement))
+	}
+	return b
+}
+
+// Headers returns a copy of h with sensitive headers masked and rules applied to the rest.
+func (r *Redactor) Headers(h map[string][]string) map[string][]string {
+	if h == nil {
+		return nil
+	}
+	out := make(map[string][]string, len(h))
+	for k, vals := range h {
+		if r != nil {
+			if _, ok := r.headers[http.CanonicalHeaderKey(k)]; ok {
+				out[k] = []string{Mask}
+				continue
+			}
+		}
+		copied := make([]string, len(vals))
+		for i, v := range vals {
+			copied[i] = r.String(v)
+		}
+		out[k] = copied
+	}
+	return out
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultConfigTable = "config_store"
+	defaultConfigLimit = 50
+)
+
+// ErrVersionConflict is returned when a write is based on a version that is no longer the latest.
+var ErrVersionConflict = errors.New("version conflict")
+
+// ConfigVersion is one stored revision of cliproxy.yaml.
+type ConfigVersion struct {
+	Version   int64     `json:"version"`
+	Hash      string    `json:"hash"`
+	Author    string    `json:"author,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Content   string    `json:"content,omitempty"`
+}
+
+// PostgresConfigStore keeps every revision of the CLIProxy configuration in PostgreSQL.
+type PostgresConfigStore struct {
+	db     *sql.DB
+	schema string
+	table  string
+}
+
+// NewPostgresConfigStore creates a config store on top of an existing connection pool.
+func NewPostgresConfigStore(db *sql.DB, schema string) (*PostgresConfigStore, error) {
+	if db == nil {
+		return nil, fmt.Errorf("postgres config store: database is required")
+	}
+	return &PostgresConfigStore{db: db, schema: strings.TrimSpace(schema), table: defaultConfigTable}, nil
+}
+
+// EnsureSchema creates the config table.
+func (s *PostgresConfigStore) EnsureSchema(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version BIGSERIAL PRIMARY KEY,
+			content TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			author TEXT NOT NULL DEFAULT '',
+			comment TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`, s.fullTableName())); err != nil {
+		return fmt.Errorf("postgres config store: create table: %w", err)
+	}
+	return nil
+}
+
+// Latest returns the newest revision, or ErrNotFound when the table is empty.
+func (s *PostgresConfigStore) Latest(ctx context.Context) (*ConfigVersion, error) {
+	query := fmt.Sprintf(`SELECT version, hash, author, comment, created_at, content FROM %s ORDER BY version DESC LIMIT 1`, s.fullTableName())
+	return s.scanOne(s.db.QueryRowContext(ctx, query))
+}
+
+// LatestVersion returns the newest version number, or 0 when the table is empty.
+func (s *PostgresConfigStore) LatestVersion(ctx context.Context) (int64, error) {
+	var version sql.NullInt64
+	query := fmt.Sprintf(`SELECT MAX(version) FROM %s`, s.fullTableName())
+	if err := s.db.QueryRowContext(ctx, query).Scan(&version); err != nil {
+		return 0, fmt.Errorf("postgres config store: latest version: %w", err)
+	}
+	return version.Int64, nil
+}
+
+// Get returns a single revision including its content.
+func (s *PostgresConfigStore) Get(ctx context.Context, version int64) (*ConfigVersion, error) {
+	query := fmt.Sprintf(`SELECT version, hash, author, comment, created_at, content FROM %s WHERE version = $1`, s.fullTableName())
+	return s.scanOne(s.db.QueryRowContext(ctx, query, version))
+}
+
+// List returns revisions newest first, without their content.
+func (s *PostgresConfigStore) List(ctx context.Context, limit int) ([]ConfigVersion, error) {
+	if limit <= 0 {
+		limit = defaultConfigLimit
+	}
+	query := fmt.Sprintf(`SELECT version, hash, author, comment, created_at FROM %s ORDER BY version DESC LIMIT $1`, s.fullTableName())
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("postgres config store: list: %w", err)
+	}
+	defer rows.Close()
+	var versions []ConfigVersion
+	for rows.Next() {
+		var v ConfigVersion
+		if err = rows.Scan(&v.Version, &v.Hash, &v.Author, &v.Comment, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("postgres config store: scan: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres config store: iterate: %w", err)
+	}
+	return versions, nil
+}
+
+// Put stores content as a new revision. When baseVersion is non-zero the write
+// only succeeds if it is still the latest version. Content identical to the
+// latest revision is not stored again; the latest revision is returned instead.
+func (s *PostgresConfigStore) Put(ctx context.Context, content, author, comment string, baseVersion int64) (*ConfigVersion, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("postgres config store: begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Serialize writers so the base version check and insert are atomic.
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE", s.fullTableName())); err != nil {
+		return nil, fmt.Errorf("postgres config store: lock: %w", err)
+	}
+	latest, err := s.scanOne(tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT version, hash, author, comment, created_at, content FROM %s ORDER BY version DESC LIMIT 1`, s.fullTableName())))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	var latestVersion int64
+	if latest != nil {
+		latestVersion = latest.Version
+	}
+	if baseVersion != 0 && baseVersion != latestVersion {
+		return nil, fmt.Errorf("postgres config store: %w: base %d, latest %d", ErrVersionConflict, baseVersion, latestVersion)
+	}
+	hash := ConfigHash(content)
+	if latest != nil && latest.Hash == hash {
+		return latest, nil
+	}
+
+	v := &ConfigVersion{Hash: hash, Author: author, Comment: comment, Content: content}
+	query := fmt.Sprintf(`INSERT INTO %s (content, hash, author, comment) VALUES ($1, $2, $3, $4) RETURNING version, created_at`, s.fullTableName())
+	if err = tx.QueryRowContext(ctx, query, content, hash, author, comment).Scan(&v.Version, &v.CreatedAt); err != nil {
+		return nil, fmt.Errorf("postgres config store: insert: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("postgres config store: commit: %w", err)
+	}
+	return v, nil
+}
+
+func (s *PostgresConfigStore) scanOne(row *sql.Row) (*ConfigVersion, error) {
+	var v ConfigVersion
+	if err := row.Scan(&v.Version, &v.Hash, &v.Author, &v.Comment, &v.CreatedAt, &v.Content); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("postgres config store: query: %w", err)
+	}
+	return &v, nil
+}
+
+func (s *PostgresConfigStore) fullTableName() string {
+	return qualifiedTableName(s.schema, s.table)
+}
+
+// ConfigHash returns the hex SHA-256 of a config document.
+func ConfigHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const defaultCooldownTable = "credential_cooldowns"
+
+// Cooldown is a credential (or one of its models) that CLIProxy stopped using
+// after an upstream error, until ResetAt.
+type Cooldown struct {
+	AuthID string `json:"auth_id"`
+	// Model is empty when the whole credential is cooling down.
+	Model string `json:"model,omitempty"`
+	// Reason is "quota", "unauthorized", "payment_required", "not_found" or "upstream".
+	Reason        string    `json:"reason"`
+	StatusCode    int       `json:"status_code,omitempty"`
+	Message       string    `json:"message,omitempty"`
+	QuotaExceeded bool      `json:"quota_exceeded"`
+	BackoffLevel  int       `json:"backoff_level,omitempty"`
+	ResetAt       time.Time `json:"reset_at"`
+	// Replica is the host that recorded the cooldown.
+	Replica   string    `json:"replica,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PostgresCooldownStore shares credential cooldowns between replicas and
+// keeps them across restarts.
+type PostgresCooldownStore struct {
+	db     *sql.DB
+	schema string
+	table  string
+}
+
+// NewPostgresCooldownStore creates a cooldown store on top of an existing connection pool.
+func NewPostgresCooldownStore(db *sql.DB, schema string) (*PostgresCooldownStore, error) {
+	if db == nil {
+		return nil, fmt.Errorf("postgres cooldown store: database is required")
+	}
+	return &PostgresCooldownStore{db: db, schema: strings.TrimSpace(schema), table: defaultCooldownTable}, nil
+}
+
+// EnsureSchema creates the cooldown table.
+func (s *PostgresCooldownStore) EnsureSchema(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			auth_id TEXT NOT NULL,
+			model TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			status_code INTEGER NOT NULL DEFAULT 0,
+			message TEXT NOT NULL DEFAULT '',
+			quota_exceeded BOOLEAN NOT NULL DEFAULT FALSE,
+			backoff_level INTEGER NOT NULL DEFAULT 0,
+			reset_at TIMESTAMPTZ NOT NULL,
+			replica TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (auth_id, model)
+		)
+	`, s.fullTableName())); err != nil {
+		return fmt.Errorf("postgres cooldown store: create table: %w", err)
+	}
+	return nil
+}
+
+// Put records c, replacing the earlier cooldown of the same credential and model.
+func (s *PostgresCooldownStore) Put(ctx context.Context, c Cooldown) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (auth_id, model, reason, status_code, message, quota_exceeded, backoff_level, reset_at, replica, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+		ON CONFLICT (auth_id, model) DO UPDATE SET
+			reason = EXCLUDED.reason, status_code = EXCLUDED.status_code, message = EXCLUDED.message,
+			quota_exceeded = EXCLUDED.quota_exceeded, backoff_level = EXCLUDED.backoff_level,
+			reset_at = EXCLUDED.reset_at, replica = EXCLUDED.replica, updated_at = NOW()
+	`, s.fullTableName())
+	if _, err := s.db.ExecContext(ctx, query, c.AuthID, c.Model, c.Reason, c.StatusCode, c.Message, c.QuotaExceeded, c.BackoffLevel, c.ResetAt, c.Replica); err != nil {
+		return fmt.Errorf("postgres cooldown store: put: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the cooldown of a credential for model ("" for the whole
+// credential). It reports whether a row existed.
+func (s *PostgresCooldownStore) Delete(ctx context.Context, authID, model string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE auth_id = $1 AND model = $2`, s.fullTableName()), authID, model)
+	if err != nil {
+		return false, fmt.Errorf("postgres cooldown store: delete: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteAll removes every cooldown of a credential and returns how many there were.
+func (s *PostgresCooldownStore) DeleteAll(ctx context.Context, authID string) (int64, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE auth_id = $1`, s.fullTableName()), authID)
+	if err != nil {
+		return 0, fmt.Errorf("postgres cooldown store: delete: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// Active returns the cooldowns that reset after now, soonest reset first.
+func (s *PostgresCooldownStore) Active(ctx context.Context, now time.Time) ([]Cooldown, error) {
+	query := fmt.Sprintf(`
+		SELECT auth_id, model, reason, status_code, message, quota_exceeded, backoff_level, reset_at, replica, updated_at
+		FROM %s WHERE reset_at > $1 ORDER BY reset_at, auth_id, model
+	`, s.fullTableName())
+	rows, err := s.db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, fmt.Errorf("postgres cooldown store: list: %w", err)
+	}
+	defer rows.Close()
+	var out []Cooldown
+	for rows.Next() {
+		var c Cooldown
+		if err = rows.Scan(&c.AuthID, &c.Model, &c.Reason, &c.StatusCode, &c.Message, &c.QuotaExceeded, &c.BackoffLevel, &c.ResetAt, &c.Replica, &c.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("postgres cooldown store: scan: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres cooldown store: iterate: %w", err)
+	}
+	return out, nil
+}
+
+// Prune deletes cooldowns that reset before cutoff.
+func (s *PostgresCooldownStore) Prune(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE reset_at < $1`, s.fullTableName()), cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("postgres cooldown store: prune: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+func (s *PostgresCooldownStore) fullTableName() string {
+	return qualifiedTableName(s.schema, s.table)
+}
@@ -0,0 +1,255 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPoolTable        = "credential_pools"
+	defaultPoolMemberTable  = "credential_pool_members"
+	defaultPoolBindingTable = "credential_pool_bindings"
+)
+
+// Pool binding kinds.
+const (
+	// BindingAPIKey routes requests made with one client API key; Match holds
+	// the key's SHA-256 so the key itself is never stored.
+	BindingAPIKey = "api_key"
+	// BindingModel routes requests for a model name or glob pattern.
+	BindingModel = "model"
+)
+
+// CredentialPool is a named set of credentials and how to pick among them.
+type CredentialPool struct {
+	Name        string       `json:"name"`
+	Strategy    string       `json:"strategy"`
+	Description string       `json:"description,omitempty"`
+	Members     []PoolMember `json:"members"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// PoolMember is one credential (auth_store id) of a pool.
+type PoolMember struct {
+	AuthID string `json:"auth_id"`
+	// Weight is the member's share under the weighted strategy, at least 1.
+	Weight int `json:"weight"`
+}
+
+// PoolBinding sends the traffic matched by Kind and Match to Pool.
+type PoolBinding struct {
+	Kind  string `json:"kind"`
+	Match string `json:"match"`
+	// Hint is a short, non-reversible hint of a bound API key.
+	Hint      string    `json:"hint,omitempty"`
+	Pool      string    `json:"pool"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PostgresPoolStore keeps credential pools, their members and their bindings
+// in PostgreSQL, so every replica routes the same way.
+type PostgresPoolStore struct {
+	db     *sql.DB
+	schema string
+}
+
+// NewPostgresPoolStore creates a pool store on top of an existing connection pool.
+func NewPostgresPoolStore(db *sql.DB, schema string) (*PostgresPoolStore, error) {
+	if db == nil {
+		return nil, fmt.Errorf("postgres pool store: database is required")
+	}
+	return &PostgresPoolStore{db: db, schema: strings.TrimSpace(schema)}, nil
+}
+
+// EnsureSchema creates the pool, member and binding tables. Members and
+// bindings are removed together with their pool.
+func (s *PostgresPoolStore) EnsureSchema(ctx context.Context) error {
+	pools, members, bindings := s.table(defaultPoolTable), s.table(defaultPoolMemberTable), s.table(defaultPoolBindingTable)
+	statements := []string{
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				name TEXT PRIMARY KEY,
+				strategy TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			)
+		`, pools),
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				pool TEXT NOT NULL REFERENCES %s (name) ON DELETE CASCADE,
+				auth_id TEXT NOT NULL,
+				weight INTEGER NOT NULL DEFAULT 1,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (pool, auth_id)
+			)
+		`, members, pools),
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				kind TEXT NOT NULL,
+				pattern TEXT NOT NULL,
+				hint TEXT NOT NULL DEFAULT '',
+				pool TEXT NOT NULL REFERENCES %s (name) ON DELETE CASCADE,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (kind, pattern)
+			)
+		`, bindings, pools),
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("postgres pool store: create table: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListPools returns every pool with its members, ordered by name.
+func (s *PostgresPoolStore) ListPools(ctx context.Context) ([]CredentialPool, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT name, strategy, description, created_at, updated_at FROM %s ORDER BY name`, s.table(defaultPoolTable)))
+	if err != nil {
+		return nil, fmt.Errorf("postgres pool store: list pools: %w", err)
+	}
+	var pools []CredentialPool
+	index := make(map[string]int)
+	for rows.Next() {
+		var p CredentialPool
+		if err = rows.Scan(&p.Name, &p.Strategy, &p.Description, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("postgres pool store: scan pool: %w", err)
+		}
+		p.Members = []PoolMember{}
+		index[p.Name] = len(pools)
+		pools = append(pools, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres pool store: iterate pools: %w", err)
+	}
+
+	rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`SELECT pool, auth_id, weight FROM %s ORDER BY pool, auth_id`, s.table(defaultPoolMemberTable)))
+	if err != nil {
+		return nil, fmt.Errorf("postgres pool store: list members: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			pool string
+			m    PoolMember
+		)
+		if err = rows.Scan(&pool, &m.AuthID, &m.Weight); err != nil {
+			return nil, fmt.Errorf("postgres pool store: scan member: %w", err)
+		}
+		if i, ok := index[pool]; ok {
+			pools[i].Members = append(pools[i].Members, m)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres pool store: iterate members: %w", err)
+	}
+	return pools, nil
+}
+
+// PutPool creates a pool or updates its strategy and description.
+func (s *PostgresPoolStore) PutPool(ctx context.Context, name, strategy, description string) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (name, strategy, description) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET strategy = EXCLUDED.strategy, description = EXCLUDED.description, updated_at = NOW()
+	`, s.table(defaultPoolTable))
+	if _, err := s.db.ExecContext(ctx, query, name, strategy, description); err != nil {
+		return fmt.Errorf("postgres pool store: put pool: %w", err)
+	}
+	return nil
+}
+
+// DeletePool removes a pool with its members and bindings, or returns ErrNotFound.
+func (s *PostgresPoolStore) DeletePool(ctx context.Context, name string) error {
+	return s.execOne(ctx, "delete pool", fmt.Sprintf(`DELETE FROM %s WHERE name = $1`, s.table(defaultPoolTable)), name)
+}
+
+// PutPoolMember adds a credential to a pool or changes its weight. It returns
+// ErrNotFound when the pool does not exist.
+func (s *PostgresPoolStore) PutPoolMember(ctx context.Context, pool, authID string, weight int) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (pool, auth_id, weight)
+		SELECT name, $2, $3 FROM %s WHERE name = $1
+		ON CONFLICT (pool, auth_id) DO UPDATE SET weight = EXCLUDED.weight
+	`, s.table(defaultPoolMemberTable), s.table(defaultPoolTable))
+	if err := s.execOne(ctx, "put member", query, pool, authID, weight); err != nil {
+		return err
+	}
+	return s.touchPool(ctx, pool)
+}
+
+// DeletePoolMember removes a credential from a pool, or returns ErrNotFound.
+func (s *PostgresPoolStore) DeletePoolMember(ctx context.Context, pool, authID string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE pool = $1 AND auth_id = $2`, s.table(defaultPoolMemberTable))
+	if err := s.execOne(ctx, "delete member", query, pool, authID); err != nil {
+		return err
+	}
+	return s.touchPool(ctx, pool)
+}
+
+// ListPoolBindings returns every binding ordered by kind and match.
+func (s *PostgresPoolStore) ListPoolBindings(ctx context.Context) ([]PoolBinding, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT kind, pattern, hint, pool, created_at FROM %s ORDER BY kind, pattern`, s.table(defaultPoolBindingTable)))
+	if err != nil {
+		return nil, fmt.Errorf("postgres pool store: list bindings: %w", err)
+	}
+	defer rows.Close()
+	var bindings []PoolBinding
+	for rows.Next() {
+		var b PoolBinding
+		if err = rows.Scan(&b.Kind, &b.Match, &b.Hint, &b.Pool, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("postgres pool store: scan binding: %w", err)
+		}
+		bindings = append(bindings, b)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres pool store: iterate bindings: %w", err)
+	}
+	return bindings, nil
+}
+
+// PutPoolBinding binds b.Kind/b.Match to b.Pool, replacing an earlier binding
+// of the same match. It returns ErrNotFound when the pool does not exist.
+func (s *PostgresPoolStore) PutPoolBinding(ctx context.Context, b PoolBinding) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (kind, pattern, hint, pool)
+		SELECT $1, $2, $3, name FROM %s WHERE name = $4
+		ON CONFLICT (kind, pattern) DO UPDATE SET hint = EXCLUDED.hint, pool = EXCLUDED.pool, created_at = NOW()
+	`, s.table(defaultPoolBindingTable), s.table(defaultPoolTable))
+	return s.execOne(ctx, "put binding", query, b.Kind, b.Match, b.Hint, b.Pool)
+}
+
+// DeletePoolBinding removes a binding, or returns ErrNotFound.
+func (s *PostgresPoolStore) DeletePoolBinding(ctx context.Context, kind, match string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE kind = $1 AND pattern = $2`, s.table(defaultPoolBindingTable))
+	return s.execOne(ctx, "delete binding", query, kind, match)
+}
+
+// execOne runs a statement that must affect at least one row.
+func (s *PostgresPoolStore) execOne(ctx context.Context, op, query string, args ...any) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("postgres pool store: %s: %w", op, err)
+	}
+	if n, errRows := res.RowsAffected(); errRows == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresPoolStore) touchPool(ctx context.Context, name string) error {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET updated_at = NOW() WHERE name = $1`, s.table(defaultPoolTable)), name); err != nil {
+		return fmt.Errorf("postgres pool store: touch pool: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresPoolStore) table(name string) string {
+	return qualifiedTableName(s.schema, name)
+}
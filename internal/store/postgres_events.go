@@ -0,0 +1,278 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSubscriptionTable = "event_subscriptions"
+	defaultDeliveryTable     = "event_deliveries"
+	defaultDeliveryLimit     = 50
+	maxDeliveryLimit         = 500
+)
+
+// Event sinks.
+const (
+	SinkWebhook = "webhook"
+	SinkSlack   = "slack"
+	SinkEmail   = "email"
+)
+
+// EventSubscription sends the events matching Events to one sink.
+type EventSubscription struct {
+	Name string `json:"name"`
+	// Sink is "webhook", "slack" or "email".
+	Sink string `json:"sink"`
+	// Target is the URL for webhook and Slack sinks, or a comma-separated
+	// list of recipients for email.
+	Target string `json:"target"`
+	// Secret signs webhook bodies; it is never returned by the admin API.
+	Secret    string    `json:"-"`
+	HasSecret bool      `json:"has_secret"`
+	Events    []string  `json:"events"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EventDelivery is the outcome of sending one event to one subscription.
+type EventDelivery struct {
+	ID           int64  `json:"id"`
+	EventID      string `json:"event_id"`
+	EventType    string `json:"event_type"`
+	Subscription string `json:"subscription"`
+	Sink         string `json:"sink"`
+	// Status is "delivered" or "failed".
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	Replica   string    `json:"replica,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// FinishedAt is when the last attempt ended.
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// EventDeliveryFilter narrows a delivery log listing. Zero values are ignored.
+type EventDeliveryFilter struct {
+	Subscription string
+	EventType    string
+	Status       string
+	BeforeID     int64
+	Limit        int
+}
+
+// PostgresEventStore keeps event subscriptions and the delivery log.
+type PostgresEventStore struct {
+	db     *sql.DB
+	schema string
+}
+
+// NewPostgresEventStore creates an event store on top of an existing connection pool.
+func NewPostgresEventStore(db *sql.DB, schema string) (*PostgresEventStore, error) {
+	if db == nil {
+		return nil, fmt.Errorf("postgres event store: database is required")
+	}
+	return &PostgresEventStore{db: db, schema: strings.TrimSpace(schema)}, nil
+}
+
+// EnsureSchema creates the subscription and delivery tables.
+func (s *PostgresEventStore) EnsureSchema(ctx context.Context) error {
+	statements := []string{
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				name TEXT PRIMARY KEY,
+				sink TEXT NOT NULL,
+				target TEXT NOT NULL,
+				secret TEXT NOT NULL DEFAULT '',
+				events TEXT NOT NULL DEFAULT '*',
+				disabled BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			)
+		`, s.table(defaultSubscriptionTable)),
+		fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				id BIGSERIAL PRIMARY KEY,
+				event_id TEXT NOT NULL,
+				event_type TEXT NOT NULL,
+				subscription TEXT NOT NULL,
+				sink TEXT NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				last_error TEXT NOT NULL DEFAULT '',
+				replica TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				finished_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+			)
+		`, s.table(defaultDeliveryTable)),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (subscription, id DESC)`,
+			quoteIdentifier(defaultDeliveryTable+"_subscription_idx"), s.table(defaultDeliveryTable)),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (created_at)`,
+			quoteIdentifier(defaultDeliveryTable+"_created_at_idx"), s.table(defaultDeliveryTable)),
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("postgres event store: create schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListSubscriptions returns every subscription ordered by name, secrets included.
+func (s *PostgresEventStore) ListSubscriptions(ctx context.Context) ([]EventSubscription, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT name, sink, target, secret, events, disabled, created_at, updated_at
+		FROM %s ORDER BY name
+	`, s.table(defaultSubscriptionTable)))
+	if err != nil {
+		return nil, fmt.Errorf("postgres event store: list subscriptions: %w", err)
+	}
+	defer rows.Close()
+	var out []EventSubscription
+	for rows.Next() {
+		var (
+			sub    EventSubscription
+			events string
+		)
+		if err = rows.Scan(&sub.Name, &sub.Sink, &sub.Target, &sub.Secret, &events, &sub.Disabled, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("postgres event store: scan subscription: %w", err)
+		}
+		sub.HasSecret = sub.Secret != ""
+		sub.Events = splitList(events)
+		out = append(out, sub)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres event store: iterate subscriptions: %w", err)
+	}
+	return out, nil
+}
+
+// PutSubscription creates or replaces a subscription. An empty secret keeps
+// the stored one.
+func (s *PostgresEventStore) PutSubscription(ctx context.Context, sub EventSubscription) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s AS sub (name, sink, target, secret, events, disabled) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO UPDATE SET
+			sink = EXCLUDED.sink, target = EXCLUDED.target,
+			secret = CASE WHEN EXCLUDED.secret = '' THEN sub.secret ELSE EXCLUDED.secret END,
+			events = EXCLUDED.events, disabled = EXCLUDED.disabled, updated_at = NOW()
+	`, s.table(defaultSubscriptionTable))
+	if _, err := s.db.ExecContext(ctx, query, sub.Name, sub.Sink, sub.Target, sub.Secret, strings.Join(sub.Events, ","), sub.Disabled); err != nil {
+		return fmt.Errorf("postgres event store: put subscription: %w", err)
+	}
+	return nil
+}
+
+// DeleteSubscription removes a subscription, or returns ErrNotFound. Its
+// delivery log is kept.
+func (s *PostgresEventStore) DeleteSubscription(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE name = $1`, s.table(defaultSubscriptionTable)), name)
+	if err != nil {
+		return fmt.Errorf("postgres event store: delete subscription: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// InsertDelivery appends d to the delivery log and sets its id.
+func (s *PostgresEventStore) InsertDelivery(ctx context.Context, d *EventDelivery) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (event_id, event_type, subscription, sink, status, attempts, last_error, replica, created_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, s.table(defaultDeliveryTable))
+	err := s.db.QueryRowContext(ctx, query,
+		d.EventID, d.EventType, d.Subscription, d.Sink, d.Status, d.Attempts, d.LastError, d.Replica, d.CreatedAt, d.FinishedAt,
+	).Scan(&d.ID)
+	if err != nil {
+		return fmt.Errorf("postgres event store: insert delivery: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries returns delivery log entries, newest first.
+func (s *PostgresEventStore) ListDeliveries(ctx context.Context, filter EventDeliveryFilter) ([]EventDelivery, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(clause string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+	if filter.Subscription != "" {
+		add("subscription = $%d", filter.Subscription)
+	}
+	if filter.EventType != "" {
+		add("event_type = $%d", filter.EventType)
+	}
+	if filter.Status != "" {
+		add("status = $%d", filter.Status)
+	}
+	if filter.BeforeID > 0 {
+		add("id < $%d", filter.BeforeID)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultDeliveryLimit
+	}
+	if limit > maxDeliveryLimit {
+		limit = maxDeliveryLimit
+	}
+	query := fmt.Sprintf(`
+		SELECT id, event_id, event_type, subscription, sink, status, attempts, last_error, replica, created_at, finished_at
+		FROM %s`, s.table(defaultDeliveryTable))
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d", limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("postgres event store: list deliveries: %w", err)
+	}
+	defer rows.Close()
+	var out []EventDelivery
+	for rows.Next() {
+		var d EventDelivery
+		if err = rows.Scan(&d.ID, &d.EventID, &d.EventType, &d.Subscription, &d.Sink, &d.Status, &d.Attempts, &d.LastError, &d.Replica, &d.CreatedAt, &d.FinishedAt); err != nil {
+			return nil, fmt.Errorf("postgres event store: scan delivery: %w", err)
+		}
+		out = append(out, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres event store: iterate deliveries: %w", err)
+	}
+	return out, nil
+}
+
+// DeleteDeliveriesOlderThan prunes the delivery log and reports how many entries were deleted.
+func (s *PostgresEventStore) DeleteDeliveriesOlderThan(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE created_at < $1`, s.table(defaultDeliveryTable)), cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("postgres event store: delete old deliveries: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+func (s *PostgresEventStore) table(name string) string {
+	return qualifiedTableName(s.schema, name)
+}
+
+// splitList splits a comma-separated list, dropping blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRequestLogTable = "request_log"
+	defaultRequestLogLimit = 50
+	maxRequestLogLimit     = 500
+)
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// RequestLogEntry is a captured request/response pair proxied through HelixRun.
+type RequestLogEntry struct {
+	ID              int64               `json:"id"`
+	CreatedAt       time.Time           `json:"created_at"`
+	Method          string              `json:"method"`
+	Path            string              `json:"path"`
+	Model           string              `json:"model,omitempty"`
+	APIKeyHash      string              `json:"-"`
+	APIKeyHint      string              `json:"api_key,omitempty"`
+	Status          int                 `json:"status"`
+	LatencyMS       int64               `json:"latency_ms"`
+	RemoteAddr      string              `json:"remote_addr,omitempty"`
+	RequestHeaders  map[string][]string `json:"request_headers,omitempty"`
+	RequestBody     string              `json:"request_body,omitempty"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody    string              `json:"response_body,omitempty"`
+	Truncated       bool                `json:"truncated,omitempty"`
+}
+
+// RequestLogFilter narrows a request log search. Zero values are ignored.
+type RequestLogFilter struct {
+	Since      time.Time
+	Until      time.Time
+	Model      string
+	APIKeyHash string
+	APIKeyHint string
+	Status     int
+	// MinStatus matches entries with a status greater than or equal to the value (e.g. 400 for errors).
+	MinStatus int
+	// Query is a case-insensitive substring matched against request and response bodies.
+	Query string
+	// BeforeID pages backwards from the given entry id.
+	BeforeID int64
+	Limit    int
+}
+
+// PostgresRequestLog persists proxied request/response pairs in PostgreSQL.
+type PostgresRequestLog struct {
+	db     *sql.DB
+	schema string
+	table  string
+}
+
+// NewPostgresRequestLog creates a request log on top of an existing connection pool.
+func NewPostgresRequestLog(db *sql.DB, schema string) (*PostgresRequestLog, error) {
+	if db == nil {
+		return nil, fmt.Errorf("postgres request log: database is required")
+	}
+	return &PostgresRequestLog{db: db, schema: strings.TrimSpace(schema), table: defaultRequestLogTable}, nil
+}
+
+// EnsureSchema creates the request log table and its search indexes.
+func (l *PostgresRequestLog) EnsureSchema(ctx context.Context) error {
+	table := l.fullTableName()
+	if _, err := l.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			model TEXT NOT NULL DEFAULT '',
+			api_key_hash TEXT NOT NULL DEFAULT '',
+			api_key_hint TEXT NOT NULL DEFAULT '',
+			status INTEGER NOT NULL,
+			latency_ms BIGINT NOT NULL,
+			remote_addr TEXT NOT NULL DEFAULT '',
+			request_headers JSONB,
+			request_body TEXT NOT NULL DEFAULT '',
+			response_headers JSONB,
+			response_body TEXT NOT NULL DEFAULT '',
+			truncated BOOLEAN NOT NULL DEFAULT FALSE
+		)
+	`, table)); err != nil {
+		return fmt.Errorf("postgres request log: create table: %w", err)
+	}
+	indexes := map[string]string{
+		"created_at_idx": "(created_at DESC)",
+		"key_idx":        "(api_key_hash, created_at DESC)",
+		"model_idx":      "(model, created_at DESC)",
+		"status_idx":     "(status, created_at DESC)",
+	}
+	for suffix, columns := range indexes {
+		name := quoteIdentifier(l.table + "_" + suffix)
+		if _, err := l.db.ExecContext(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s %s", name, table, columns)); err != nil {
+			return fmt.Errorf("postgres request log: create index %s: %w", suffix, err)
+		}
+	}
+	return nil
+}
+
+// Insert stores a new entry.
+func (l *PostgresRequestLog) Insert(ctx context.Context, entry *RequestLogEntry) error {
+	if entry == nil {
+		return nil
+	}
+	reqHeaders, err := json.Marshal(entry.RequestHeaders)
+	if err != nil {
+		return fmt.Errorf("postgres request log: marshal request headers: %w", err)
+	}
+	respHeaders, err := json.Marshal(entry.ResponseHeaders)
+	if err != nil {
+		return fmt.Errorf("postgres request log: marshal response headers: %w", err)
+	}
+	createdAt := entry.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO %s (created_at, method, path, model, api_key_hash, api_key_hint, status, latency_ms,
+			remote_addr, request_headers, request_body, response_headers, response_body, truncated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id
+	`, l.fullTableName())
+	err = l.db.QueryRowContext(ctx, query,
+		createdAt, entry.Method, entry.Path, entry.Model, entry.APIKeyHash, entry.APIKeyHint, entry.Status, entry.LatencyMS,
+		entry.RemoteAddr, json.RawMessage(reqHeaders), entry.RequestBody, json.RawMessage(respHeaders), entry.ResponseBody, entry.Truncated,
+	).Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("postgres request log: insert: %w", err)
+	}
+	return nil
+}
+
+// Search returns entry summaries (without headers and bodies), newest first.
+func (l *PostgresRequestLog) Search(ctx context.Context, filter RequestLogFilter) ([]RequestLogEntry, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(clause string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+	if !filter.Since.IsZero() {
+		add("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		add("created_at < $%d", filter.Until)
+	}
+	if filter.Model != "" {
+		add("model = $%d", filter.Model)
+	}
+	if filter.APIKeyHash != "" {
+		add("api_key_hash = $%d", filter.APIKeyHash)
+	}
+	if filter.APIKeyHint != "" {
+		add("api_key_hint = $%d", filter.APIKeyHint)
+	}
+	if filter.Status != 0 {
+		add("status = $%d", filter.Status)
+	}
+	if filter.MinStatus != 0 {
+		add("status >= $%d", filter.MinStatus)
+	}
+	if filter.Query != "" {
+		args = append(args, "%"+escapeLike(filter.Query)+"%")
+		where = append(where, fmt.Sprintf("(request_body ILIKE $%d OR response_body ILIKE $%d)", len(args), len(args)))
+	}
+	if filter.BeforeID > 0 {
+		add("id < $%d", filter.BeforeID)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultRequestLogLimit
+	}
+	if limit > maxRequestLogLimit {
+		limit = maxRequestLogLimit
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, created_at, method, path, model, api_key_hint, status, latency_ms, remote_addr, truncated
+		FROM %s`, l.fullTableName())
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d", limit)
+
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("postgres request log: search: %w", err)
+	}
+	defer rows.Close()
+	var entries []RequestLogEntry
+	for rows.Next() {
+		var e RequestLogEntry
+		if err = rows.Scan(&e.ID, &e.CreatedAt, &e.Method, &e.Path, &e.Model, &e.APIKeyHint, &e.Status, &e.LatencyMS, &e.RemoteAddr, &e.Truncated); err != nil {
+			return nil, fmt.Errorf("postgres request log: scan: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres request log: iterate: %w", err)
+	}
+	return entries, nil
+}
+
+// Get returns a full entry including headers and bodies.
+func (l *PostgresRequestLog) Get(ctx context.Context, id int64) (*RequestLogEntry, error) {
+	query := fmt.Sprintf(`
+		SELECT id, created_at, method, path, model, api_key_hint, status, latency_ms, remote_addr,
+			request_headers, request_body, response_headers, response_body, truncated
+		FROM %s WHERE id = $1`, l.fullTableName())
+	var (
+		e                       RequestLogEntry
+		reqHeaders, respHeaders []byte
+	)
+	err := l.db.QueryRowContext(ctx, query, id).Scan(
+		&e.ID, &e.CreatedAt, &e.Method, &e.Path, &e.Model, &e.APIKeyHint, &e.Status, &e.LatencyMS, &e.RemoteAddr,
+		&reqHeaders, &e.RequestBody, &respHeaders, &e.ResponseBody, &e.Truncated,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("postgres request log: get: %w", err)
+	}
+	if len(reqHeaders) > 0 {
+		_ = json.Unmarshal(reqHeaders, &e.RequestHeaders)
+	}
+	if len(respHeaders) > 0 {
+		_ = json.Unmarshal(respHeaders, &e.ResponseHeaders)
+	}
+	return &e, nil
+}
+
+// DeleteOlderThan removes entries created before the cutoff and reports how many were deleted.
+func (l *PostgresRequestLog) DeleteOlderThan(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := l.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE created_at < $1", l.fullTableName()), cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("postgres request log: delete old entries: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+func (l *PostgresRequestLog) fullTableName() string {
+	return qualifiedTableName(l.schema, l.table)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultResponseCacheTable = "response_cache"
+	// responseCachePruneEvery controls how often Set opportunistically prunes expired rows.
+	responseCachePruneEvery = 100
+)
+
+// PostgresResponseCache stores cached proxy responses in PostgreSQL so they are
+// shared across HelixRun replicas and survive restarts.
+type PostgresResponseCache struct {
+	db         *sql.DB
+	schema     string
+	table      string
+	maxEntries int
+	writes     atomic.Int64
+}
+
+// NewPostgresResponseCache creates a cache backend on top of an existing connection pool.
+// A non-positive maxEntries disables the row limit.
+func NewPostgresResponseCache(db *sql.DB, schema string, maxEntries int) (*PostgresResponseCache, error) {
+	if db == nil {
+		return nil, fmt.Errorf("postgres response cache: database is required")
+	}
+	return &PostgresResponseCache{
+		db:         db,
+		schema:     strings.TrimSpace(schema),
+		table:      defaultResponseCacheTable,
+		maxEntries: maxEntries,
+	}, nil
+}
+
+// EnsureSchema creates the cache table when it does not exist yet.
+func (c *PostgresResponseCache) EnsureSchema(ctx context.Context) error {
+	table := c.fullTableName()
+	if _, err := c.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			key TEXT PRIMARY KEY,
+			value BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ NOT NULL
+		)
+	`, table)); err != nil {
+		return fmt.Errorf("postgres response cache: create table: %w", err)
+	}
+	index := quoteIdentifier(c.table + "_expires_at_idx")
+	if _, err := c.db.ExecContext(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (expires_at)", index, table)); err != nil {
+		return fmt.Errorf("postgres response cache: create index: %w", err)
+	}
+	return nil
+}
+
+// Get returns a fresh cached value for key.
+func (c *PostgresResponseCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	query := fmt.Sprintf("SELECT value FROM %s WHERE key = $1 AND expires_at > NOW()", c.fullTableName())
+	var value []byte
+	if err := c.db.QueryRowContext(ctx, query, key).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("postgres response cache: get: %w", err)
+	}
+	return value, true, nil
+}
+
+// Set stores value under key until ttl elapses.
+func (c *PostgresResponseCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (key, value, created_at, expires_at)
+		VALUES ($1, $2, NOW(), NOW() + $3 * INTERVAL '1 millisecond')
+		ON CONFLICT (key)
+		DO UPDATE SET value = EXCLUDED.value, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+	`, c.fullTableName())
+	if _, err := c.db.ExecContext(ctx, query, key, value, ttl.Milliseconds()); err != nil {
+		return fmt.Errorf("postgres response cache: set: %w", err)
+	}
+	if c.writes.Add(1)%responseCachePruneEvery == 0 {
+		return c.prune(ctx)
+	}
+	return nil
+}
+
+// Purge removes every cached entry.
+func (c *PostgresResponseCache) Purge(ctx context.Context) error {
+	if _, err := c.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", c.fullTableName())); err != nil {
+		return fmt.Errorf("postgres response cache: purge: %w", err)
+	}
+	return nil
+}
+
+// prune drops expired rows and, when a row limit is configured, the oldest rows beyond it.
+func (c *PostgresResponseCache) prune(ctx context.Context) error {
+	table := c.fullTableName()
+	if _, err := c.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at <= NOW()", table)); err != nil {
+		return fmt.Errorf("postgres response cache: prune expired: %w", err)
+	}
+	if c.maxEntries <= 0 {
+		return nil
+	}
+	query := fmt.Sprintf(`
+		DELETE FROM %s WHERE key IN (
+			SELECT key FROM %s ORDER BY created_at DESC OFFSET $1
+		)
+	`, table, table)
+	if _, err := c.db.ExecContext(ctx, query, c.maxEntries); err != nil {
+		return fmt.Errorf("postgres response cache: prune overflow: %w", err)
+	}
+	return nil
+}
+
+func (c *PostgresResponseCache) fullTableName() string {
+	return qualifiedTableName(c.schema, c.table)
+}
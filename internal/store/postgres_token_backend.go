@@ -0,0 +1,501 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	defaultAuthTable       = "auth_store"
+	defaultMaxOpenConns    = 10
+	defaultConnMaxLifetime = 30 * time.Minute
+	defaultConnMaxIdleTime = 5 * time.Minute
+	defaultApplicationName = "helixrun"
+)
+
+// PostgresBackendConfig configures the Postgres backend and its connection pool.
+type PostgresBackendConfig struct {
+	DSN       string
+	Schema    string
+	AuthTable string
+
+	// MaxOpenConns caps the connection pool shared by every HelixRun table;
+	// default 10.
+	MaxOpenConns int
+	// MinWarmConns is a floor, not a cap: the pool opens connections until at
+	// least this many sit idle, ready for a burst; default 0. It is pgxpool's
+	// MinIdleConns, unlike database/sql's SetMaxIdleConns.
+	MinWarmConns int
+	// ConnMaxLifetime and ConnMaxIdleTime recycle connections; default 30m and
+	// 5m. Idle connections above MinWarmConns are closed after ConnMaxIdleTime.
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// StatementTimeout sets statement_timeout on every connection; zero keeps the server default.
+	StatementTimeout time.Duration
+	// ApplicationName is reported in pg_stat_activity; defaults to "helixrun"
+	// unless the DSN sets application_name.
+	ApplicationName string
+}
+
+// PostgresBackend stores auth documents in a JSONB table. Its pool is shared
+// with the other HelixRun tables through DB.
+type PostgresBackend struct {
+	pool *pgxpool.Pool
+	db   *sql.DB
+	cfg  PostgresBackendConfig
+}
+
+// NewPostgresBackend opens the connection pool and checks that the database is reachable.
+func NewPostgresBackend(ctx context.Context, cfg PostgresBackendConfig) (*PostgresBackend, error) {
+	cfg.DSN = strings.TrimSpace(cfg.DSN)
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("postgres token store: DSN is required")
+	}
+	if strings.TrimSpace(cfg.AuthTable) == "" {
+		cfg.AuthTable = defaultAuthTable
+	}
+	pool, err := openPool(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err = pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("postgres token store: ping database: %w", err)
+	}
+	return &PostgresBackend{pool: pool, db: stdlib.OpenDBFromPool(pool), cfg: cfg}, nil
+}
+
+// openPool applies pool defaults to cfg and creates the pgx connection pool
+// with the configured session parameters. Connections are opened lazily.
+func openPool(ctx context.Context, cfg *PostgresBackendConfig) (*pgxpool.Pool, error) {
+	if cfg.MaxOpenConns <= 0 {
+		cfg.MaxOpenConns = defaultMaxOpenConns
+	}
+	cfg.MinWarmConns = min(max(cfg.MinWarmConns, 0), cfg.MaxOpenConns)
+	if cfg.ConnMaxLifetime <= 0 {
+		cfg.ConnMaxLifetime = defaultConnMaxLifetime
+	}
+	if cfg.ConnMaxIdleTime <= 0 {
+		cfg.ConnMaxIdleTime = defaultConnMaxIdleTime
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: parse DSN: %w", err)
+	}
+	params := poolConfig.ConnConfig.RuntimeParams
+	if cfg.ApplicationName != "" {
+		params["application_name"] = cfg.ApplicationName
+	} else if params["application_name"] == "" {
+		params["application_name"] = defaultApplicationName
+	}
+	cfg.ApplicationName = params["application_name"]
+	if cfg.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+
+	poolConfig.MaxConns = int32(cfg.MaxOpenConns)
+	poolConfig.MinIdleConns = int32(cfg.MinWarmConns)
+	poolConfig.MaxConnLifetime = cfg.ConnMaxLifetime
+	poolConfig.MaxConnIdleTime = cfg.ConnMaxIdleTime
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: open pool: %w", err)
+	}
+	return pool, nil
+}
+
+func (b *PostgresBackend) String() string {
+	return "postgres"
+}
+
+// DB exposes the connection pool through database/sql so other HelixRun tables
+// can share it.
+func (b *PostgresBackend) DB() *sql.DB {
+	return b.db
+}
+
+// Schema returns the configured schema name, or an empty string for the default search path.
+func (b *PostgresBackend) Schema() string {
+	return strings.TrimSpace(b.cfg.Schema)
+}
+
+// Close releases the connection pool.
+func (b *PostgresBackend) Close() error {
+	err := b.db.Close()
+	b.pool.Close()
+	return err
+}
+
+// Ping checks that the database is reachable.
+func (b *PostgresBackend) Ping(ctx context.Context) error {
+	return b.pool.Ping(ctx)
+}
+
+// EnsureSchema creates the required auth table (and schema when provided).
+func (b *PostgresBackend) EnsureSchema(ctx context.Context) error {
+	if schema := b.Schema(); schema != "" {
+		query := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", quoteIdentifier(schema))
+		if _, err := b.pool.Exec(ctx, query); err != nil {
+			return fmt.Errorf("postgres token store: create schema: %w", err)
+		}
+	}
+	authTable := b.fullTableName()
+	if _, err := b.pool.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id TEXT PRIMARY KEY,
+			content JSONB NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`, authTable)); err != nil {
+		return fmt.Errorf("postgres token store: create auth table: %w", err)
+	}
+	// Metadata extracted by ParseAuthMeta on every upsert. A NULL provider
+	// marks rows written before these columns existed.
+	if _, err := b.pool.Exec(ctx, fmt.Sprintf(`
+		ALTER TABLE %s
+			ADD COLUMN IF NOT EXISTS provider TEXT,
+			ADD COLUMN IF NOT EXISTS email TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS label TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS project_id TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ,
+			ADD COLUMN IF NOT EXISTS disabled_by TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS disabled_reason TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ
+	`, authTable)); err != nil {
+		return fmt.Errorf("postgres token store: add metadata columns: %w", err)
+	}
+	// Incremental reconciles select rows changed since the last watermark;
+	// listings filter by provider and expiry or look up an e-mail.
+	indexes := []struct{ suffix, columns string }{
+		{"updated_at", "updated_at"},
+		{"provider_expires_at", "provider, expires_at"},
+		{"expires_at", "expires_at"},
+		{"email", "lower(email)"},
+	}
+	for _, idx := range indexes {
+		name := quoteIdentifier(strings.TrimSpace(b.cfg.AuthTable) + "_" + idx.suffix + "_idx")
+		if _, err := b.pool.Exec(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", name, authTable, idx.columns)); err != nil {
+			return fmt.Errorf("postgres token store: create %s index: %w", idx.suffix, err)
+		}
+	}
+	return b.backfillMeta(ctx)
+}
+
+// backfillMeta extracts the metadata columns of rows written before they existed.
+func (b *PostgresBackend) backfillMeta(ctx context.Context) error {
+	table := b.fullTableName()
+	rows, err := b.pool.Query(ctx, fmt.Sprintf("SELECT id, content FROM %s WHERE provider IS NULL", table))
+	if err != nil {
+		return fmt.Errorf("postgres token store: select rows to backfill: %w", err)
+	}
+	type pending struct {
+		id   string
+		meta AuthMeta
+	}
+	todo, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (pending, error) {
+		var (
+			id      string
+			content []byte
+		)
+		err := row.Scan(&id, &content)
+		return pending{id: id, meta: ParseAuthMeta(content)}, err
+	})
+	if err != nil {
+		return fmt.Errorf("postgres token store: scan rows to backfill: %w", err)
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+	query := fmt.Sprintf(`
+		UPDATE %s SET provider = $2, email = $3, label = $4, project_id = $5, disabled = $6, expires_at = $7,
+			disabled_by = $8, disabled_reason = $9, disabled_at = $10
+		WHERE id = $1
+	`, table)
+	batch := &pgx.Batch{}
+	for _, p := range todo {
+		m := p.meta
+		batch.Queue(query, p.id, m.Provider, m.Email, m.Label, m.ProjectID, m.Disabled, m.ExpiresAt, m.DisabledBy, m.DisabledReason, m.DisabledAt)
+	}
+	if err = b.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("postgres token store: backfill metadata: %w", err)
+	}
+	return nil
+}
+
+// List returns every row ordered by id, with content only for rows updated after since.
+func (b *PostgresBackend) List(ctx context.Context, since time.Time) ([]AuthRecord, error) {
+	query := fmt.Sprintf("SELECT id, CASE WHEN updated_at > $1 THEN content END, created_at, updated_at FROM %s ORDER BY id", b.fullTableName())
+	rows, err := b.pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: list auth records: %w", err)
+	}
+	records, err := pgx.CollectRows(rows, scanAuthRecord)
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: scan auth rows: %w", err)
+	}
+	return records, nil
+}
+
+// Get returns the row stored under id, or ErrNotFound.
+func (b *PostgresBackend) Get(ctx context.Context, id string) (*AuthRecord, error) {
+	query := fmt.Sprintf("SELECT id, content, created_at, updated_at FROM %s WHERE id = $1", b.fullTableName())
+	rows, err := b.pool.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: get auth record: %w", err)
+	}
+	rec, err := pgx.CollectExactlyOneRow(rows, scanAuthRecord)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: get auth record: %w", err)
+	}
+	return &rec, nil
+}
+
+// GetMany returns the rows stored under ids in one query.
+func (b *PostgresBackend) GetMany(ctx context.Context, ids []string) (map[string]AuthRecord, error) {
+	query := fmt.Sprintf("SELECT id, content, created_at, updated_at FROM %s WHERE id = ANY($1)", b.fullTableName())
+	rows, err := b.pool.Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: get auth records: %w", err)
+	}
+	records, err := pgx.CollectRows(rows, scanAuthRecord)
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: scan auth rows: %w", err)
+	}
+	out := make(map[string]AuthRecord, len(records))
+	for _, rec := range records {
+		out[rec.ID] = rec
+	}
+	return out, nil
+}
+
+// authUpsertColumns is the ON CONFLICT assignment shared by Put and PutMany.
+const authUpsertColumns = `content = EXCLUDED.content, provider = EXCLUDED.provider, email = EXCLUDED.email,
+	label = EXCLUDED.label, project_id = EXCLUDED.project_id, disabled = EXCLUDED.disabled,
+	expires_at = EXCLUDED.expires_at, disabled_by = EXCLUDED.disabled_by,
+	disabled_reason = EXCLUDED.disabled_reason, disabled_at = EXCLUDED.disabled_at`
+
+// Put upserts content under id together with its extracted metadata.
+func (b *PostgresBackend) Put(ctx context.Context, id string, content []byte) (time.Time, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (id, content, provider, email, label, project_id, disabled, expires_at,
+			disabled_by, disabled_reason, disabled_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW())
+		ON CONFLICT (id)
+		DO UPDATE SET %s, updated_at = NOW()
+		RETURNING updated_at
+	`, b.fullTableName(), authUpsertColumns)
+	m := ParseAuthMeta(content)
+	var updatedAt time.Time
+	err := b.pool.QueryRow(ctx, query, id, json.RawMessage(content), m.Provider, m.Email, m.Label, m.ProjectID, m.Disabled, m.ExpiresAt,
+		m.DisabledBy, m.DisabledReason, m.DisabledAt).Scan(&updatedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("postgres token store: upsert auth record: %w", err)
+	}
+	return updatedAt, nil
+}
+
+// PutMany upserts records in one transaction. The rows are streamed with COPY
+// into a temporary table that is dropped on commit and upserted in one
+// statement, so bulk imports cost a single round trip instead of one per row.
+func (b *PostgresBackend) PutMany(ctx context.Context, records []AuthRecord) error {
+	tx, err := b.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("postgres token store: begin bulk upsert: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE helixrun_auth_import (
+			id TEXT NOT NULL,
+			content JSONB NOT NULL,
+			provider TEXT NOT NULL,
+			email TEXT NOT NULL,
+			label TEXT NOT NULL,
+			project_id TEXT NOT NULL,
+			disabled BOOLEAN NOT NULL,
+			expires_at TIMESTAMPTZ,
+			disabled_by TEXT NOT NULL,
+			disabled_reason TEXT NOT NULL,
+			disabled_at TIMESTAMPTZ
+		) ON COMMIT DROP
+	`); err != nil {
+		return fmt.Errorf("postgres token store: create import table: %w", err)
+	}
+	rows := make([][]any, len(records))
+	for i, rec := range records {
+		m := ParseAuthMeta(rec.Content)
+		rows[i] = []any{rec.ID, json.RawMessage(rec.Content), m.Provider, m.Email, m.Label, m.ProjectID, m.Disabled, m.ExpiresAt,
+			m.DisabledBy, m.DisabledReason, m.DisabledAt}
+	}
+	columns := []string{"id", "content", "provider", "email", "label", "project_id", "disabled", "expires_at",
+		"disabled_by", "disabled_reason", "disabled_at"}
+	if _, err = tx.CopyFrom(ctx, pgx.Identifier{"helixrun_auth_import"}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("postgres token store: copy auth records: %w", err)
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO %s (id, content, provider, email, label, project_id, disabled, expires_at,
+			disabled_by, disabled_reason, disabled_at, created_at, updated_at)
+		SELECT id, content, provider, email, label, project_id, disabled, expires_at,
+			disabled_by, disabled_reason, disabled_at, NOW(), NOW()
+		FROM helixrun_auth_import
+		ON CONFLICT (id)
+		DO UPDATE SET %s, updated_at = NOW()
+	`, b.fullTableName(), authUpsertColumns)
+	if _, err = tx.Exec(ctx, query); err != nil {
+		return fmt.Errorf("postgres token store: upsert auth records: %w", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("postgres token store: commit bulk upsert: %w", err)
+	}
+	return nil
+}
+
+// ListSummaries filters on the metadata columns.
+func (b *PostgresBackend) ListSummaries(ctx context.Context, filter AuthFilter) ([]AuthSummary, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(clause string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+	if filter.Provider != "" {
+		add("provider = lower($%d)", filter.Provider)
+	}
+	if filter.Email != "" {
+		add("lower(email) = lower($%d)", filter.Email)
+	}
+	if filter.ProjectID != "" {
+		add("project_id = $%d", filter.ProjectID)
+	}
+	if filter.Label != "" {
+		add("label ILIKE $%d", "%"+escapeLike(filter.Label)+"%")
+	}
+	if filter.Disabled != nil {
+		add("disabled = $%d", *filter.Disabled)
+	}
+	if !filter.ExpiresBefore.IsZero() {
+		add("expires_at < $%d", filter.ExpiresBefore)
+	}
+	if !filter.ExpiresAfter.IsZero() {
+		add("expires_at > $%d", filter.ExpiresAfter)
+	}
+	query := fmt.Sprintf(`
+		SELECT id, COALESCE(provider, ''), email, label, project_id, disabled, expires_at,
+			disabled_by, disabled_reason, disabled_at, created_at, updated_at
+		FROM %s`, b.fullTableName())
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	rows, err := b.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: list auth summaries: %w", err)
+	}
+	summaries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (AuthSummary, error) {
+		var s AuthSummary
+		err := row.Scan(&s.ID, &s.Provider, &s.Email, &s.Label, &s.ProjectID, &s.Disabled, &s.ExpiresAt,
+			&s.DisabledBy, &s.DisabledReason, &s.DisabledAt, &s.CreatedAt, &s.UpdatedAt)
+		return s, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("postgres token store: scan auth summaries: %w", err)
+	}
+	return summaries, nil
+}
+
+// Delete removes the row stored under id.
+func (b *PostgresBackend) Delete(ctx context.Context, id string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", b.fullTableName())
+	tag, err := b.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("postgres token store: delete auth record: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanAuthRecord(row pgx.CollectableRow) (AuthRecord, error) {
+	var rec AuthRecord
+	err := row.Scan(&rec.ID, &rec.Content, &rec.CreatedAt, &rec.UpdatedAt)
+	return rec, err
+}
+
+func (b *PostgresBackend) fullTableName() string {
+	return qualifiedTableName(b.cfg.Schema, b.cfg.AuthTable)
+}
+
+// PoolStats combines pgxpool counters with the configured limits.
+type PoolStats struct {
+	ApplicationName      string `json:"application_name"`
+	MaxOpen              int    `json:"max_open"`
+	MinWarm              int    `json:"min_warm"`
+	Open                 int    `json:"open"`
+	InUse                int    `json:"in_use"`
+	Idle                 int    `json:"idle"`
+	Constructing         int    `json:"constructing"`
+	AcquireCount         int64  `json:"acquire_count"`
+	CanceledAcquireCount int64  `json:"canceled_acquire_count"`
+	WaitCount            int64  `json:"wait_count"`
+	WaitDurationMS       int64  `json:"wait_duration_ms"`
+	NewConns             int64  `json:"new_conns"`
+	MaxIdleTimeClosed    int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed    int64  `json:"max_lifetime_closed"`
+}
+
+// PoolStats returns the current pool statistics. WaitCount counts acquires
+// that found no idle connection and had to wait for one.
+func (b *PostgresBackend) PoolStats() PoolStats {
+	st := b.pool.Stat()
+	return PoolStats{
+		ApplicationName:      b.cfg.ApplicationName,
+		MaxOpen:              int(st.MaxConns()),
+		MinWarm:              b.cfg.MinWarmConns,
+		Open:                 int(st.TotalConns()),
+		InUse:                int(st.AcquiredConns()),
+		Idle:                 int(st.IdleConns()),
+		Constructing:         int(st.ConstructingConns()),
+		AcquireCount:         st.AcquireCount(),
+		CanceledAcquireCount: st.CanceledAcquireCount(),
+		WaitCount:            st.EmptyAcquireCount(),
+		WaitDurationMS:       st.EmptyAcquireWaitTime().Milliseconds(),
+		NewConns:             st.NewConnsCount(),
+		MaxIdleTimeClosed:    st.MaxIdleDestroyCount(),
+		MaxLifetimeClosed:    st.MaxLifetimeDestroyCount(),
+	}
+}
+
+// qualifiedTableName quotes table and, when set, prefixes it with the quoted schema.
+func qualifiedTableName(schema, table string) string {
+	if strings.TrimSpace(schema) == "" {
+		return quoteIdentifier(table)
+	}
+	return quoteIdentifier(strings.TrimSpace(schema)) + "." + quoteIdentifier(table)
+}
+
+func quoteIdentifier(identifier string) string {
+	replaced := strings.ReplaceAll(identifier, `"`, `""`)
+	return `"` + replaced + `"`
+}
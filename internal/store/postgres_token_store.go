@@ -1,500 +0,0 @@
-package store
-
-import (
-	"context"
-	"database/sql"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
-	"strings"
-	"sync"
-
-	_ "github.com/jackc/pgx/v5/stdlib"
-	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
-)
-
-const (
-	defaultAuthTable = "auth_store"
-)
-
-// PostgresTokenConfig captures configuration required to initialize a Postgres-backed token store.
-type PostgresTokenConfig struct {
-	DSN       string
-	Schema    string
-	SpoolDir  string
-	AuthTable string
-}
-
-// PostgresTokenStore persists authentication metadata using PostgreSQL as backend
-// while mirroring auth JSON files to a local workspace so CLIProxy's existing
-// file-based logic and watchers keep working.
-type PostgresTokenStore struct {
-	db        *sql.DB
-	cfg       PostgresTokenConfig
-	spoolRoot string
-	authDir   string
-	mu        sync.Mutex
-}
-
-// NewPostgresTokenStore establishes a connection to PostgreSQL and prepares the local auth workspace.
-func NewPostgresTokenStore(ctx context.Context, cfg PostgresTokenConfig) (*PostgresTokenStore, error) {
-	trimmedDSN := strings.TrimSpace(cfg.DSN)
-	if trimmedDSN == "" {
-		return nil, fmt.Errorf("postgres token store: DSN is required")
-	}
-	cfg.DSN = trimmedDSN
-	if strings.TrimSpace(cfg.AuthTable) == "" {
-		cfg.AuthTable = defaultAuthTable
-	}
-
-	spoolRoot := strings.TrimSpace(cfg.SpoolDir)
-	if spoolRoot == "" {
-		if cwd, err := os.Getwd(); err == nil {
-			spoolRoot = filepath.Join(cwd, "pgstore")
-		} else {
-			spoolRoot = filepath.Join(os.TempDir(), "pgstore")
-		}
-	}
-	absSpool, err := filepath.Abs(spoolRoot)
-	if err != nil {
-		return nil, fmt.Errorf("postgres token store: resolve spool directory: %w", err)
-	}
-	authDir := filepath.Join(absSpool, "auths")
-	if err = os.MkdirAll(authDir, 0o700); err != nil {
-		return nil, fmt.Errorf("postgres token store: create auth directory: %w", err)
-	}
-
-	db, err := sql.Open("pgx", cfg.DSN)
-	if err != nil {
-		return nil, fmt.Errorf("postgres token store: open database connection: %w", err)
-	}
-	if err = db.PingContext(ctx); err != nil {
-		_ = db.Close()
-		return nil, fmt.Errorf("postgres token store: ping database: %w", err)
-	}
-
-	return &PostgresTokenStore{
-		db:        db,
-		cfg:       cfg,
-		spoolRoot: absSpool,
-		authDir:   authDir,
-	}, nil
-}
-
-// Close releases the underlying database connection.
-func (s *PostgresTokenStore) Close() error {
-	if s == nil || s.db == nil {
-		return nil
-	}
-	return s.db.Close()
-}
-
-// AuthDir returns the local directory containing mirrored auth files.
-func (s *PostgresTokenStore) AuthDir() string {
-	if s == nil {
-		return ""
-	}
-	return s.authDir
-}
-
-// EnsureSchema creates the required auth table (and schema when provided).
-func (s *PostgresTokenStore) EnsureSchema(ctx context.Context) error {
-	if s == nil || s.db == nil {
-		return fmt.Errorf("postgres token store: not initialized")
-	}
-	if schema := strings.TrimSpace(s.cfg.Schema); schema != "" {
-		query := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", quoteIdentifier(schema))
-		if _, err := s.db.ExecContext(ctx, query); err != nil {
-			return fmt.Errorf("postgres token store: create schema: %w", err)
-		}
-	}
-	authTable := s.fullTableName()
-	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s (
-			id TEXT PRIMARY KEY,
-			content JSONB NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		)
-	`, authTable)); err != nil {
-		return fmt.Errorf("postgres token store: create auth table: %w", err)
-	}
-	return nil
-}
-
-// SyncFromDatabase populates the local auth directory from PostgreSQL data.
-func (s *PostgresTokenStore) SyncFromDatabase(ctx context.Context) error {
-	if s == nil || s.db == nil {
-		return fmt.Errorf("postgres token store: not initialized")
-	}
-	query := fmt.Sprintf("SELECT id, content FROM %s", s.fullTableName())
-	rows, err := s.db.QueryContext(ctx, query)
-	if err != nil {
-		return fmt.Errorf("postgres token store: load auth from database: %w", err)
-	}
-	defer rows.Close()
-
-	if err = os.RemoveAll(s.authDir); err != nil {
-		return fmt.Errorf("postgres token store: reset auth directory: %w", err)
-	}
-	if err = os.MkdirAll(s.authDir, 0o700); err != nil {
-		return fmt.Errorf("postgres token store: recreate auth directory: %w", err)
-	}
-
-	for rows.Next() {
-		var (
-			id      string
-			payload string
-		)
-		if err = rows.Scan(&id, &payload); err != nil {
-			return fmt.Errorf("postgres token store: scan auth row: %w", err)
-		}
-		path, errPath := s.absoluteAuthPath(id)
-		if errPath != nil {
-			// Skip invalid identifiers but keep processing.
-			continue
-		}
-		if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
-			return fmt.Errorf("postgres token store: create auth subdir: %w", err)
-		}
-		if err = os.WriteFile(path, []byte(payload), 0o600); err != nil {
-			return fmt.Errorf("postgres token store: write auth file: %w", err)
-		}
-	}
-	if err = rows.Err(); err != nil {
-		return fmt.Errorf("postgres token store: iterate auth rows: %w", err)
-	}
-	return nil
-}
-
-// Save persists authentication metadata to disk and PostgreSQL.
-func (s *PostgresTokenStore) Save(ctx context.Context, auth *coreauth.Auth) (string, error) {
-	if auth == nil {
-		return "", fmt.Errorf("postgres token store: auth is nil")
-	}
-
-	path, err := s.resolveAuthPath(auth)
-	if err != nil {
-		return "", err
-	}
-	if path == "" {
-		return "", fmt.Errorf("postgres token store: missing file path attribute for %s", auth.ID)
-	}
-
-	if auth.Disabled {
-		if _, statErr := os.Stat(path); errors.Is(statErr, fs.ErrNotExist) {
-			return "", nil
-		}
-	}
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
-		return "", fmt.Errorf("postgres token store: create auth directory: %w", err)
-	}
-
-	switch {
-	case auth.Storage != nil:
-		if err = auth.Storage.SaveTokenToFile(path); err != nil {
-			return "", err
-		}
-	case auth.Metadata != nil:
-		raw, errMarshal := json.Marshal(auth.Metadata)
-		if errMarshal != nil {
-			return "", fmt.Errorf("postgres token store: marshal metadata: %w", errMarshal)
-		}
-		if existing, errRead := os.ReadFile(path); errRead == nil {
-			if jsonEqual(existing, raw) {
-				return path, nil
-			}
-		} else if errRead != nil && !errors.Is(errRead, fs.ErrNotExist) {
-			return "", fmt.Errorf("postgres token store: read existing metadata: %w", errRead)
-		}
-		tmp := path + ".tmp"
-		if errWrite := os.WriteFile(tmp, raw, 0o600); errWrite != nil {
-			return "", fmt.Errorf("postgres token store: write temp auth file: %w", errWrite)
-		}
-		if errRename := os.Rename(tmp, path); errRename != nil {
-			return "", fmt.Errorf("postgres token store: rename auth file: %w", errRename)
-		}
-	default:
-		return "", fmt.Errorf("postgres token store: nothing to persist for %s", auth.ID)
-	}
-
-	if auth.Attributes == nil {
-		auth.Attributes = make(map[string]string)
-	}
-	auth.Attributes["path"] = path
-
-	if strings.TrimSpace(auth.FileName) == "" {
-		auth.FileName = auth.ID
-	}
-
-	relID, err := s.relativeAuthID(path)
-	if err != nil {
-		return "", err
-	}
-	if err = s.upsertAuthRecord(ctx, relID, path); err != nil {
-		return "", err
-	}
-	return path, nil
-}
-
-// List enumerates all auth JSON files under the managed auth directory.
-func (s *PostgresTokenStore) List(ctx context.Context) ([]*coreauth.Auth, error) {
-	if s == nil {
-		return nil, fmt.Errorf("postgres token store: not initialized")
-	}
-	dir := s.authDir
-	if dir == "" {
-		return nil, fmt.Errorf("postgres token store: auth directory not configured")
-	}
-	var entries []*coreauth.Auth
-	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
-		}
-		if d.IsDir() {
-			return nil
-		}
-		if !strings.HasSuffix(strings.ToLower(d.Name()), ".json") {
-			return nil
-		}
-		auth, err := s.readAuthFile(path, dir)
-		if err != nil {
-			return nil
-		}
-		if auth != nil {
-			entries = append(entries, auth)
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-	return entries, nil
-}
-
-// Delete removes the auth file and its record from PostgreSQL.
-func (s *PostgresTokenStore) Delete(ctx context.Context, id string) error {
-	if s == nil {
-		return fmt.Errorf("postgres token store: not initialized")
-	}
-	id = strings.TrimSpace(id)
-	if id == "" {
-		return fmt.Errorf("postgres token store: id is empty")
-	}
-	path, err := s.resolveDeletePath(id)
-	if err != nil {
-		return err
-	}
-	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("postgres token store: delete file: %w", err)
-	}
-	relID, err := s.relativeAuthID(path)
-	if err != nil {
-		return err
-	}
-	return s.deleteAuthRecord(ctx, relID)
-}
-
-// SetBaseDir is accepted by some authenticator helpers; it is a no-op because
-// the Postgres-backed store controls its own workspace.
-func (s *PostgresTokenStore) SetBaseDir(string) {}
-
-func (s *PostgresTokenStore) upsertAuthRecord(ctx context.Context, relID, path string) error {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("postgres token store: read auth file: %w", err)
-	}
-	if len(data) == 0 {
-		return s.deleteAuthRecord(ctx, relID)
-	}
-	jsonPayload := json.RawMessage(data)
-	query := fmt.Sprintf(`
-		INSERT INTO %s (id, content, created_at, updated_at)
-		VALUES ($1, $2, NOW(), NOW())
-		ON CONFLICT (id)
-		DO UPDATE SET content = EXCLUDED.content, updated_at = NOW()
-	`, s.fullTableName())
-	if _, err := s.db.ExecContext(ctx, query, relID, jsonPayload); err != nil {
-		return fmt.Errorf("postgres token store: upsert auth record: %w", err)
-	}
-	return nil
-}
-
-func (s *PostgresTokenStore) deleteAuthRecord(ctx context.Context, relID string) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1", s.fullTableName())
-	if _, err := s.db.ExecContext(ctx, query, relID); err != nil {
-		return fmt.Errorf("postgres token store: delete auth record: %w", err)
-	}
-	return nil
-}
-
-func (s *PostgresTokenStore) resolveAuthPath(auth *coreauth.Auth) (string, error) {
-	if auth == nil {
-		return "", fmt.Errorf("postgres token store: auth is nil")
-	}
-	if auth.Attributes != nil {
-		if p := strings.TrimSpace(auth.Attributes["path"]); p != "" {
-			return p, nil
-		}
-	}
-	if fileName := strings.TrimSpace(auth.FileName); fileName != "" {
-		if filepath.IsAbs(fileName) {
-			return fileName, nil
-		}
-		return filepath.Join(s.authDir, fileName), nil
-	}
-	if auth.ID == "" {
-		return "", fmt.Errorf("postgres token store: missing id")
-	}
-	if filepath.IsAbs(auth.ID) {
-		return auth.ID, nil
-	}
-	return filepath.Join(s.authDir, filepath.FromSlash(auth.ID)), nil
-}
-
-func (s *PostgresTokenStore) resolveDeletePath(id string) (string, error) {
-	if strings.ContainsRune(id, os.PathSeparator) || filepath.IsAbs(id) {
-		return id, nil
-	}
-	return filepath.Join(s.authDir, filepath.FromSlash(id)), nil
-}
-
-func (s *PostgresTokenStore) relativeAuthID(path string) (string, error) {
-	if s == nil {
-		return "", fmt.Errorf("postgres token store: store not initialized")
-	}
-	if !filepath.IsAbs(path) {
-		path = filepath.Join(s.authDir, path)
-	}
-	clean := filepath.Clean(path)
-	rel, err := filepath.Rel(s.authDir, clean)
-	if err != nil {
-		return "", fmt.Errorf("postgres token store: compute relative path: %w", err)
-	}
-	if strings.HasPrefix(rel, "..") {
-		return "", fmt.Errorf("postgres token store: path %s outside managed directory", path)
-	}
-	return filepath.ToSlash(rel), nil
-}
-
-func (s *PostgresTokenStore) absoluteAuthPath(id string) (string, error) {
-	if s == nil {
-		return "", fmt.Errorf("postgres token store: store not initialized")
-	}
-	clean := filepath.Clean(filepath.FromSlash(id))
-	if strings.HasPrefix(clean, "..") {
-		return "", fmt.Errorf("postgres token store: invalid auth identifier %s", id)
-	}
-	path := filepath.Join(s.authDir, clean)
-	rel, err := filepath.Rel(s.authDir, path)
-	if err != nil {
-		return "", err
-	}
-	if strings.HasPrefix(rel, "..") {
-		return "", fmt.Errorf("postgres token store: resolved auth path escapes auth directory")
-	}
-	return path, nil
-}
-
-func (s *PostgresTokenStore) fullTableName() string {
-	name := strings.TrimSpace(s.cfg.AuthTable)
-	if name == "" {
-		name = defaultAuthTable
-	}
-	if strings.TrimSpace(s.cfg.Schema) == "" {
-		return quoteIdentifier(name)
-	}
-	return quoteIdentifier(s.cfg.Schema) + "." + quoteIdentifier(name)
-}
-
-func quoteIdentifier(identifier string) string {
-	replaced := strings.ReplaceAll(identifier, `"`, `""`)
-	return `"` + replaced + `"`
-}
-
-func jsonEqual(a, b []byte) bool {
-	var va, vb any
-	if err := json.Unmarshal(a, &va); err != nil {
-		return false
-	}
-	if err := json.Unmarshal(b, &vb); err != nil {
-		return false
-	}
-	return fmt.Sprintf("%v", va) == fmt.Sprintf("%v", vb)
-}
-
-func (s *PostgresTokenStore) readAuthFile(path, baseDir string) (*coreauth.Auth, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("read file: %w", err)
-	}
-	if len(data) == 0 {
-		return nil, nil
-	}
-	metadata := make(map[string]any)
-	if err = json.Unmarshal(data, &metadata); err != nil {
-		return nil, fmt.Errorf("unmarshal auth json: %w", err)
-	}
-	provider, _ := metadata["type"].(string)
-	if provider == "" {
-		provider = "unknown"
-	}
-	info, err := os.Stat(path)
-	if err != nil {
-		return nil, fmt.Errorf("stat file: %w", err)
-	}
-	id := s.idFor(path, baseDir)
-	auth := &coreauth.Auth{
-		ID:         id,
-		Provider:   provider,
-		FileName:   id,
-		Label:      labelFor(metadata),
-		Status:     coreauth.StatusActive,
-		Attributes: map[string]string{"path": path},
-		Metadata:   metadata,
-		CreatedAt:  info.ModTime(),
-		UpdatedAt:  info.ModTime(),
-	}
-	if email, ok := metadata["email"].(string); ok && email != "" {
-		auth.Attributes["email"] = email
-	}
-	return auth, nil
-}
-
-func (s *PostgresTokenStore) idFor(path, baseDir string) string {
-	if baseDir == "" {
-		return normalizeAuthID(path)
-	}
-	rel, err := filepath.Rel(baseDir, path)
-	if err != nil {
-		return normalizeAuthID(path)
-	}
-	return normalizeAuthID(rel)
-}
-
-func labelFor(metadata map[string]any) string {
-	if metadata == nil {
-		return ""
-	}
-	if v, ok := metadata["label"].(string); ok && strings.TrimSpace(v) != "" {
-		return strings.TrimSpace(v)
-	}
-	if v, ok := metadata["email"].(string); ok && strings.TrimSpace(v) != "" {
-		return strings.TrimSpace(v)
-	}
-	if v, ok := metadata["project_id"].(string); ok && strings.TrimSpace(v) != "" {
-		return strings.TrimSpace(v)
-	}
-	return ""
-}
-
-func normalizeAuthID(id string) string {
-	return filepath.ToSlash(filepath.Clean(id))
-}
@@ -0,0 +1,469 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	// s3FetchConcurrency bounds parallel GETs when List loads content.
+	s3FetchConcurrency = 8
+	s3MaxObjectBytes   = 1 << 20
+)
+
+// S3Config configures the S3-compatible backend.
+type S3Config struct {
+	// Endpoint is the server URL, e.g. http://localhost:9000 for MinIO;
+	// defaults to https://s3.<region>.amazonaws.com.
+	Endpoint string
+	// Region is used for request signing; defaults to us-east-1.
+	Region string
+	Bucket string
+	// Prefix is prepended to every object key, e.g. "helixrun/auths/".
+	Prefix string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// PathStyle addresses the bucket as the first path segment instead of a
+	// subdomain, as most S3-compatible servers expect.
+	PathStyle bool
+
+	HTTPClient *http.Client
+}
+
+// ParseS3URL parses s3://bucket/prefix?endpoint=http://host:9000&region=eu-west-1&path_style=true.
+// Credentials may be given as user info (s3://KEY:SECRET@bucket/prefix).
+// path_style defaults to true when an endpoint is set.
+func ParseS3URL(raw string) (S3Config, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return S3Config{}, fmt.Errorf("s3 token store: parse url: %w", err)
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return S3Config{}, fmt.Errorf("s3 token store: url must look like s3://bucket/prefix")
+	}
+	q := u.Query()
+	cfg := S3Config{
+		Endpoint: q.Get("endpoint"),
+		Region:   q.Get("region"),
+		Bucket:   u.Host,
+		Prefix:   strings.TrimPrefix(u.Path, "/"),
+	}
+	if u.User != nil {
+		cfg.AccessKeyID = u.User.Username()
+		cfg.SecretAccessKey, _ = u.User.Password()
+	}
+	cfg.PathStyle = cfg.Endpoint != ""
+	if raw := q.Get("path_style"); raw != "" {
+		if cfg.PathStyle, err = strconv.ParseBool(raw); err != nil {
+			return S3Config{}, fmt.Errorf("s3 token store: invalid path_style: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// S3Backend stores each auth document as one object under Prefix. It speaks
+// the S3 REST API with Signature V4 directly, so it works against AWS and
+// S3-compatible servers such as MinIO.
+type S3Backend struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Backend validates cfg. No request is made until EnsureSchema or Ping.
+func NewS3Backend(cfg S3Config) (*S3Backend, error) {
+	cfg.Bucket = strings.TrimSpace(cfg.Bucket)
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 token store: bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultS3Region
+	}
+	if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+		cfg.Prefix += "/"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3 token store: invalid endpoint %q", cfg.Endpoint)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &S3Backend{cfg: cfg, endpoint: endpoint, client: client}, nil
+}
+
+func (b *S3Backend) String() string {
+	return "s3://" + b.cfg.Bucket + "/" + b.cfg.Prefix
+}
+
+// Close releases idle connections.
+func (b *S3Backend) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// Ping checks that the bucket is reachable.
+func (b *S3Backend) Ping(ctx context.Context) error {
+	resp, err := b.do(ctx, "ping", http.MethodHead, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// EnsureSchema creates the bucket when it does not exist.
+func (b *S3Backend) EnsureSchema(ctx context.Context) error {
+	err := b.Ping(ctx)
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	var body []byte
+	if b.cfg.Region != defaultS3Region {
+		body = []byte(`<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><LocationConstraint>` +
+			b.cfg.Region + `</LocationConstraint></CreateBucketConfiguration>`)
+	}
+	resp, err := b.do(ctx, "create bucket", http.MethodPut, "", nil, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns every object under Prefix ordered by id. Objects modified
+// after since are downloaded in parallel.
+func (b *S3Backend) List(ctx context.Context, since time.Time) ([]AuthRecord, error) {
+	var records []AuthRecord
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {b.cfg.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := b.do(ctx, "list", http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 token store: decode list: %w", err)
+		}
+		for _, obj := range page.Contents {
+			id := strings.TrimPrefix(obj.Key, b.cfg.Prefix)
+			if id == "" || strings.HasSuffix(id, "/") {
+				continue
+			}
+			records = append(records, AuthRecord{ID: id, CreatedAt: obj.LastModified, UpdatedAt: obj.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, s3FetchConcurrency)
+	)
+	for i := range records {
+		if !records[i].UpdatedAt.After(since) {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func(rec *AuthRecord) {
+			defer func() { <-sem; wg.Done() }()
+			fetched, err := b.Get(ctx, rec.ID)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrNotFound):
+				// Deleted since the listing; reported without content and
+				// dropped by the caller's second pass.
+			case err != nil:
+				if firstErr == nil {
+					firstErr = err
+				}
+			default:
+				rec.Content = fetched.Content
+			}
+		}(&records[i])
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return records, nil
+}
+
+// Get downloads the object stored under id, or returns ErrNotFound.
+func (b *S3Backend) Get(ctx context.Context, id string) (*AuthRecord, error) {
+	resp, err := b.do(ctx, "get "+id, http.MethodGet, b.cfg.Prefix+id, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, s3MaxObjectBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("s3 token store: get %s: %w", id, err)
+	}
+	if len(content) > s3MaxObjectBytes {
+		return nil, fmt.Errorf("s3 token store: get %s: object exceeds %d bytes", id, s3MaxObjectBytes)
+	}
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	modified = modified.UTC()
+	return &AuthRecord{ID: id, Content: content, CreatedAt: modified, UpdatedAt: modified}, nil
+}
+
+// Put uploads content under id and returns the object's Last-Modified time.
+// S3 does not report it on PUT, so the object is read back with a HEAD; the
+// zero time is returned when that fails after a successful upload.
+func (b *S3Backend) Put(ctx context.Context, id string, content []byte) (time.Time, error) {
+	key := b.cfg.Prefix + id
+	resp, err := b.do(ctx, "put "+id, http.MethodPut, key, nil, content)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+	if modified, errParse := http.ParseTime(resp.Header.Get("Last-Modified")); errParse == nil {
+		return modified.UTC(), nil
+	}
+	resp, err = b.do(ctx, "stat "+id, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	resp.Body.Close()
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return modified.UTC(), nil
+}
+
+// Delete removes the object stored under id. S3 deletes are idempotent, so
+// the object is checked first to report ErrNotFound.
+func (b *S3Backend) Delete(ctx context.Context, id string) error {
+	key := b.cfg.Prefix + id
+	resp, err := b.do(ctx, "stat "+id, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	resp, err = b.do(ctx, "delete "+id, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3Error is a non-2xx response.
+type s3Error struct {
+	Op      string
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *s3Error) Error() string {
+	msg := fmt.Sprintf("s3 token store: %s: %d %s", e.Op, e.Status, http.StatusText(e.Status))
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Transient reports throttling and server-side failures.
+func (e *s3Error) Transient() bool {
+	return e.Status >= 500 || e.Status == http.StatusTooManyRequests || e.Code == "SlowDown" || e.Code == "RequestTimeout"
+}
+
+// Is makes 404 responses match ErrNotFound.
+func (e *s3Error) Is(target error) bool {
+	return target == ErrNotFound && e.Status == http.StatusNotFound
+}
+
+// do sends a signed request for key (empty for the bucket itself) and
+// returns the response for 2xx statuses; other statuses become *s3Error.
+func (b *S3Backend) do(ctx context.Context, op, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *b.endpoint
+	path := u.Path
+	if b.cfg.PathStyle {
+		path += "/" + b.cfg.Bucket
+	} else {
+		u.Host = b.cfg.Bucket + "." + u.Host
+	}
+	path += "/" + key
+	u.Path = path
+	u.RawPath = awsURIEncode(path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3 token store: %s: %w", op, err)
+	}
+	req.ContentLength = int64(len(body))
+	if key != "" && method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	b.sign(req, body, time.Now().UTC())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 token store: %s: %w", op, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	apiErr := &s3Error{Op: op, Status: resp.StatusCode}
+	var payload struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if data, errRead := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); errRead == nil && xml.Unmarshal(data, &payload) == nil {
+		apiErr.Code, apiErr.Message = payload.Code, payload.Message
+	}
+	return nil, apiErr
+}
+
+// sign adds AWS Signature V4 headers. Requests are sent unsigned when no
+// access key is configured (for anonymous local stand-ins).
+func (b *S3Backend) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if b.cfg.AccessKeyID == "" {
+		return
+	}
+	if b.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.cfg.SessionToken)
+	}
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if b.cfg.SessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	var headers strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	day := now.Format("20060102")
+	scope := day + "/" + b.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+b.cfg.SecretAccessKey), day)
+	key = hmacSHA256(key, b.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+b.cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery encodes query sorted by key, as both the request and the
+// signature use it.
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything except RFC 3986 unreserved
+// characters; '/' is kept unless encodeSlash is set.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			out.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "%%%02X", c)
+		}
+	}
+	return out.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// Pure Go SQLite driver, registered as "sqlite"; no cgo required.
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMaxParams bounds the number of ids per IN (...) query.
+const sqliteMaxParams = 500
+
+// SQLiteBackend stores auth documents in a single SQLite file. It suits
+// single-node and development setups; timestamps are kept as Unix nanoseconds.
+type SQLiteBackend struct {
+	db   *sql.DB
+	path string
+}
+
+// NewSQLiteBackend opens (and creates) the database file at path.
+func NewSQLiteBackend(ctx context.Context, path string) (*SQLiteBackend, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("sqlite token store: path is required")
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite token store: resolve path: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(absPath), 0o700); err != nil {
+		return nil, fmt.Errorf("sqlite token store: create directory: %w", err)
+	}
+	dsn := "file:" + absPath + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite token store: open %s: %w", absPath, err)
+	}
+	// One writer at a time avoids SQLITE_BUSY between our own connections.
+	db.SetMaxOpenConns(1)
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("sqlite token store: open %s: %w", absPath, err)
+	}
+	return &SQLiteBackend{db: db, path: absPath}, nil
+}
+
+func (b *SQLiteBackend) String() string {
+	return "sqlite:" + b.path
+}
+
+// Close closes the database file.
+func (b *SQLiteBackend) Close() error {
+	return b.db.Close()
+}
+
+// Ping checks that the database file is usable.
+func (b *SQLiteBackend) Ping(ctx context.Context) error {
+	return b.db.PingContext(ctx)
+}
+
+// EnsureSchema creates the auth table.
+func (b *SQLiteBackend) EnsureSchema(ctx context.Context) error {
+	if _, err := b.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS auth_store (
+			id TEXT PRIMARY KEY,
+			content TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("sqlite token store: create auth table: %w", err)
+	}
+	if _, err := b.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS auth_store_updated_at_idx ON auth_store (updated_at)`); err != nil {
+		return fmt.Errorf("sqlite token store: create updated_at index: %w", err)
+	}
+	return nil
+}
+
+// List returns every row ordered by id, with content only for rows updated after since.
+func (b *SQLiteBackend) List(ctx context.Context, since time.Time) ([]AuthRecord, error) {
+	var sinceNS int64
+	if !since.IsZero() {
+		sinceNS = since.UnixNano()
+	}
+	rows, err := b.db.QueryContext(ctx, `
+		SELECT id, CASE WHEN updated_at > ? THEN content END, created_at, updated_at
+		FROM auth_store ORDER BY id
+	`, sinceNS)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite token store: list auth records: %w", err)
+	}
+	return scanSQLiteRecords(rows)
+}
+
+// Get returns the row stored under id, or ErrNotFound.
+func (b *SQLiteBackend) Get(ctx context.Context, id string) (*AuthRecord, error) {
+	rows, err := b.db.QueryContext(ctx, `SELECT id, content, created_at, updated_at FROM auth_store WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite token store: get auth record: %w", err)
+	}
+	records, err := scanSQLiteRecords(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return &records[0], nil
+}
+
+// GetMany returns the rows stored under ids, querying them in chunks.
+func (b *SQLiteBackend) GetMany(ctx context.Context, ids []string) (map[string]AuthRecord, error) {
+	out := make(map[string]AuthRecord, len(ids))
+	for start := 0; start < len(ids); start += sqliteMaxParams {
+		chunk := ids[start:min(start+sqliteMaxParams, len(ids))]
+		args := make([]any, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunk)), ",")
+		rows, err := b.db.QueryContext(ctx, `SELECT id, content, created_at, updated_at FROM auth_store WHERE id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite token store: get auth records: %w", err)
+		}
+		records, err := scanSQLiteRecords(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			out[rec.ID] = rec
+		}
+	}
+	return out, nil
+}
+
+const sqliteUpsert = `
+	INSERT INTO auth_store (id, content, created_at, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (id)
+	DO UPDATE SET content = excluded.content, updated_at = excluded.updated_at
+`
+
+// Put upserts content under id.
+func (b *SQLiteBackend) Put(ctx context.Context, id string, content []byte) (time.Time, error) {
+	now := time.Now().UTC()
+	if _, err := b.db.ExecContext(ctx, sqliteUpsert, id, string(content), now.UnixNano(), now.UnixNano()); err != nil {
+		return time.Time{}, fmt.Errorf("sqlite token store: upsert auth record: %w", err)
+	}
+	return now, nil
+}
+
+// PutMany upserts records in one transaction.
+func (b *SQLiteBackend) PutMany(ctx context.Context, records []AuthRecord) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite token store: begin bulk upsert: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.PrepareContext(ctx, sqliteUpsert)
+	if err != nil {
+		return fmt.Errorf("sqlite token store: prepare bulk upsert: %w", err)
+	}
+	defer stmt.Close()
+	now := time.Now().UTC().UnixNano()
+	for _, rec := range records {
+		if _, err = stmt.ExecContext(ctx, rec.ID, string(rec.Content), now, now); err != nil {
+			return fmt.Errorf("sqlite token store: upsert %s: %w", rec.ID, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite token store: commit bulk upsert: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the row stored under id.
+func (b *SQLiteBackend) Delete(ctx context.Context, id string) error {
+	res, err := b.db.ExecContext(ctx, `DELETE FROM auth_store WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("sqlite token store: delete auth record: %w", err)
+	}
+	if n, errRows := res.RowsAffected(); errRows == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanSQLiteRecords(rows *sql.Rows) ([]AuthRecord, error) {
+	defer rows.Close()
+	var records []AuthRecord
+	for rows.Next() {
+		var (
+			rec                  AuthRecord
+			content              sql.NullString
+			createdNS, updatedNS int64
+		)
+		if err := rows.Scan(&rec.ID, &content, &createdNS, &updatedNS); err != nil {
+			return nil, fmt.Errorf("sqlite token store: scan auth row: %w", err)
+		}
+		if content.Valid {
+			rec.Content = []byte(content.String)
+		}
+		rec.CreatedAt = time.Unix(0, createdNS).UTC()
+		rec.UpdatedAt = time.Unix(0, updatedNS).UTC()
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite token store: iterate auth rows: %w", err)
+	}
+	return records, nil
+}
+
+// sqliteBusy reports SQLITE_BUSY and SQLITE_LOCKED, which clear once the
+// other writer finishes.
+func sqliteBusy(err error) bool {
+	var coded interface{ Code() int }
+	if !errors.As(err, &coded) {
+		return false
+	}
+	switch coded.Code() & 0xff {
+	case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+		return true
+	}
+	return false
+}
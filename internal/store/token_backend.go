@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Backend is where a TokenStore keeps auth documents: a flat table of JSON
+// documents keyed by their slash-separated path relative to the auth
+// directory. TokenStore mirrors it to local files for CLIProxy.
+type Backend interface {
+	// String names the backend for logs and the admin API, e.g. "postgres".
+	String() string
+	// EnsureSchema creates the table, bucket or file the backend needs.
+	EnsureSchema(ctx context.Context) error
+	// List returns every record ordered by id. Content is only loaded for
+	// records updated after since; a zero since loads all of them.
+	List(ctx context.Context, since time.Time) ([]AuthRecord, error)
+	// Get returns the record stored under id, or ErrNotFound.
+	Get(ctx context.Context, id string) (*AuthRecord, error)
+	// Put stores content under id and returns its new update time, or the
+	// zero time when the backend cannot report it.
+	Put(ctx context.Context, id string, content []byte) (time.Time, error)
+	// Delete removes id, returning ErrNotFound when it does not exist.
+	Delete(ctx context.Context, id string) error
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// BatchBackend is a Backend that reads and writes many records in one round
+// trip. TokenStore falls back to one call per record otherwise.
+type BatchBackend interface {
+	Backend
+	// GetMany returns the records stored under ids keyed by id; missing ids are absent.
+	GetMany(ctx context.Context, ids []string) (map[string]AuthRecord, error)
+	// PutMany stores all records atomically. Ids are unique.
+	PutMany(ctx context.Context, records []AuthRecord) error
+}
+
+// transientError is implemented by backend errors that know whether a retry
+// can succeed, such as S3 throttling and 5xx responses.
+type transientError interface {
+	Transient() bool
+}
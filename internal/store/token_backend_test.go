@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// backendSuite checks the Backend contract TokenStore relies on. Every
+// backend runs it: SQLite in a temporary directory, S3 against an in-process
+// stand-in and Postgres when HELIXRUN_TEST_POSTGRES_DSN is set.
+func backendSuite(t *testing.T, b Backend) {
+	t.Helper()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := b.EnsureSchema(ctx); err != nil {
+			t.Fatalf("EnsureSchema (run %d): %v", i+1, err)
+		}
+	}
+	if err := b.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	if _, err := b.Get(ctx, "missing.json"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get missing: err = %v, want ErrNotFound", err)
+	}
+	if err := b.Delete(ctx, "missing.json"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete missing: err = %v, want ErrNotFound", err)
+	}
+	if records, err := b.List(ctx, time.Time{}); err != nil || len(records) != 0 {
+		t.Fatalf("List empty = %v, %v; want no records", records, err)
+	}
+
+	docs := map[string]string{
+		"b.json":     `{"type":"codex","access_token":"b"}`,
+		"a.json":     `{"type":"gemini","email":"a@example.com"}`,
+		"dir/c.json": `{"type":"claude","expired":"2030-01-01T00:00:00Z"}`,
+	}
+	putAt := make(map[string]time.Time)
+	for _, id := range []string{"b.json", "a.json", "dir/c.json"} {
+		updated, err := b.Put(ctx, id, []byte(docs[id]))
+		if err != nil {
+			t.Fatalf("Put %s: %v", id, err)
+		}
+		if updated.IsZero() {
+			t.Fatalf("Put %s returned the zero time; reconcile could never move its watermark", id)
+		}
+		putAt[id] = updated
+	}
+
+	for id, content := range docs {
+		rec, err := b.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get %s: %v", id, err)
+		}
+		if rec.ID != id || !jsonEqual(rec.Content, []byte(content)) {
+			t.Fatalf("Get %s = %s %s, want %s", id, rec.ID, rec.Content, content)
+		}
+		if d := rec.UpdatedAt.Sub(putAt[id]).Abs(); d > time.Second {
+			t.Fatalf("Get %s: updated_at %s is %s away from the time Put reported (%s)", id, rec.UpdatedAt, d, putAt[id])
+		}
+	}
+
+	records, err := b.List(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if got := recordIDs(records); fmt.Sprint(got) != "[a.json b.json dir/c.json]" {
+		t.Fatalf("List ids = %v, want sorted [a.json b.json dir/c.json]", got)
+	}
+	var latest time.Time
+	for _, rec := range records {
+		if !jsonEqual(rec.Content, []byte(docs[rec.ID])) {
+			t.Fatalf("List %s content = %s, want %s", rec.ID, rec.Content, docs[rec.ID])
+		}
+		if rec.UpdatedAt.After(latest) {
+			latest = rec.UpdatedAt
+		}
+	}
+
+	// Records not updated after since are listed without content.
+	records, err = b.List(ctx, latest)
+	if err != nil {
+		t.Fatalf("List since: %v", err)
+	}
+	if len(records) != len(docs) {
+		t.Fatalf("List since returned %d records, want %d", len(records), len(docs))
+	}
+	for _, rec := range records {
+		if rec.Content != nil {
+			t.Fatalf("List since %s: %s loaded content %s", latest, rec.ID, rec.Content)
+		}
+	}
+
+	updated, err := b.Put(ctx, "a.json", []byte(`{"type":"gemini","email":"new@example.com"}`))
+	if err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if updated.Before(putAt["a.json"]) {
+		t.Fatalf("overwrite updated_at %s is before the first write %s", updated, putAt["a.json"])
+	}
+	rec, err := b.Get(ctx, "a.json")
+	if err != nil || !jsonEqual(rec.Content, []byte(`{"type":"gemini","email":"new@example.com"}`)) {
+		t.Fatalf("Get after overwrite = %v, %v", rec, err)
+	}
+
+	if err = b.Delete(ctx, "a.json"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err = b.Get(ctx, "a.json"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get deleted: err = %v, want ErrNotFound", err)
+	}
+	records, err = b.List(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("List after delete: %v", err)
+	}
+	if got := recordIDs(records); fmt.Sprint(got) != "[b.json dir/c.json]" {
+		t.Fatalf("List after delete = %v", got)
+	}
+
+	if batch, ok := b.(BatchBackend); ok {
+		err = batch.PutMany(ctx, []AuthRecord{
+			{ID: "x.json", Content: []byte(`{"type":"x"}`)},
+			{ID: "b.json", Content: []byte(`{"type":"codex","access_token":"b2"}`)},
+		})
+		if err != nil {
+			t.Fatalf("PutMany: %v", err)
+		}
+		got, err := batch.GetMany(ctx, []string{"x.json", "b.json", "missing.json"})
+		if err != nil {
+			t.Fatalf("GetMany: %v", err)
+		}
+		if len(got) != 2 || !jsonEqual(got["b.json"].Content, []byte(`{"type":"codex","access_token":"b2"}`)) {
+			t.Fatalf("GetMany = %v", got)
+		}
+	}
+}
+
+func recordIDs(records []AuthRecord) []string {
+	ids := make([]string, len(records))
+	for i, rec := range records {
+		ids[i] = rec.ID
+	}
+	return ids
+}
+
+func TestSQLiteBackend(t *testing.T) {
+	b, err := NewSQLiteBackend(context.Background(), filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	backendSuite(t, b)
+}
+
+func TestS3Backend(t *testing.T) {
+	fake := newFakeS3(t, "auths", 2)
+	b, err := NewS3Backend(fake.config("helixrun/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	backendSuite(t, b)
+}
+
+func TestPostgresBackend(t *testing.T) {
+	dsn := os.Getenv("HELIXRUN_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("HELIXRUN_TEST_POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+	schema := fmt.Sprintf("helixrun_test_%d", time.Now().UnixNano())
+	b, err := NewPostgresBackend(ctx, PostgresBackendConfig{DSN: dsn, Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = b.DB().ExecContext(ctx, "DROP SCHEMA "+quoteIdentifier(schema)+" CASCADE")
+		_ = b.Close()
+	})
+	backendSuite(t, b)
+}
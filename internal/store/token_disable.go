@@ -0,0 +1,184 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// disabledSuffix parks a disabled credential in the mirror as <id>.disabled.
+// CLIProxy only loads *.json files, so parking a file makes its watcher
+// remove the credential from rotation, and restoring the name brings it back.
+const disabledSuffix = ".disabled"
+
+// SetDisabled takes the credential id out of rotation (disabled=true) or puts
+// it back, without deleting it. The document's "disabled" flag is set, and so
+// are disabled_by, disabled_reason and disabled_at when disabling; enabling
+// clears them. The change is written to the mirror and the backend like any
+// other save.
+func (s *TokenStore) SetDisabled(ctx context.Context, id string, disabled bool, by, reason string) (*AuthSummary, error) {
+	if s == nil || s.backend == nil {
+		return nil, fmt.Errorf("token store: not initialized")
+	}
+	path, err := s.absoluteAuthPath(id)
+	if err != nil {
+		return nil, err
+	}
+	relID, err := s.relativeAuthID(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := s.currentContentLocked(ctx, relID, path)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	content, err = setDisabledFields(content, disabled, strings.TrimSpace(by), strings.TrimSpace(reason), now)
+	if err != nil {
+		return nil, fmt.Errorf("token store: %s: %w", relID, err)
+	}
+	written, err := s.writeMirrorLocked(path, content)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.writeThrough(ctx, outboxUpsert, relID, func(ctx context.Context) error {
+		return s.upsertAuthRecord(ctx, relID, written)
+	}); err != nil {
+		return nil, err
+	}
+	if disabled {
+		log.Printf("token store: %s disabled by %s: %s", relID, orUnknown(by), orUnknown(reason))
+	} else {
+		log.Printf("token store: %s enabled by %s", relID, orUnknown(by))
+	}
+	return &AuthSummary{ID: relID, AuthMeta: ParseAuthMeta(content), UpdatedAt: now}, nil
+}
+
+// currentContentLocked returns the mirrored document (enabled or parked),
+// falling back to the backend when the mirror has no copy.
+func (s *TokenStore) currentContentLocked(ctx context.Context, relID, path string) ([]byte, error) {
+	if existing, ok := existingMirrorPath(path); ok {
+		content, err := os.ReadFile(existing)
+		if err != nil {
+			return nil, fmt.Errorf("token store: read auth file: %w", err)
+		}
+		if len(bytes.TrimSpace(content)) > 0 {
+			return content, nil
+		}
+	}
+	rec, err := s.backend.Get(ctx, relID)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Content, nil
+}
+
+// writeMirrorLocked writes content to path, or parks it at path+disabledSuffix
+// when the document is disabled, and removes the other copy. It returns the
+// path written.
+func (s *TokenStore) writeMirrorLocked(path string, content []byte) (string, error) {
+	target, stale := path, path+disabledSuffix
+	if ParseAuthMeta(content).Disabled {
+		target, stale = stale, target
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return "", fmt.Errorf("token store: create auth directory: %w", err)
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return "", fmt.Errorf("token store: write auth file: %w", err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return "", fmt.Errorf("token store: rename auth file: %w", err)
+	}
+	if err := os.Remove(stale); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("token store: remove auth file: %w", err)
+	}
+	return target, nil
+}
+
+// existingMirrorPath returns the mirrored file for path, enabled or parked.
+func existingMirrorPath(path string) (string, bool) {
+	for _, candidate := range []string{path, path + disabledSuffix} {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// removeMirror deletes the mirrored file for path, enabled or parked.
+func removeMirror(path string) error {
+	for _, candidate := range []string{path, path + disabledSuffix} {
+		if err := os.Remove(candidate); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("token store: delete file: %w", err)
+		}
+	}
+	return nil
+}
+
+// setDisabledFields rewrites the disabled flag of an auth document. Numbers
+// are kept verbatim so millisecond expiry timestamps survive the round trip.
+func setDisabledFields(content []byte, disabled bool, by, reason string, now time.Time) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil || doc == nil {
+		return nil, fmt.Errorf("auth document is not a JSON object")
+	}
+	if disabled {
+		doc["disabled"] = true
+		doc["disabled_at"] = now.Format(time.RFC3339)
+		doc["disabled_by"] = by
+		doc["disabled_reason"] = reason
+	} else {
+		for _, key := range []string{"disabled", "disabled_at", "disabled_by", "disabled_reason"} {
+			delete(doc, key)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// keepDisabledFields copies the disabled flag and its audit fields from the
+// parked document into content, which is returned unchanged when parked is
+// not disabled.
+func keepDisabledFields(content, parked []byte) ([]byte, error) {
+	if !ParseAuthMeta(parked).Disabled {
+		return content, nil
+	}
+	var old map[string]any
+	if err := json.Unmarshal(parked, &old); err != nil {
+		return nil, fmt.Errorf("parked auth document is not a JSON object")
+	}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil || doc == nil {
+		return nil, fmt.Errorf("auth document is not a JSON object")
+	}
+	for _, key := range []string{"disabled", "disabled_at", "disabled_by", "disabled_reason"} {
+		if v, ok := old[key]; ok {
+			doc[key] = v
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func orUnknown(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "(unknown)"
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+)
+
+// newTestTokenStore returns a token store on a SQLite backend in a temporary directory.
+func newTestTokenStore(t *testing.T) *TokenStore {
+	t.Helper()
+	return newTestTokenStoreOn(t, newTestSQLiteBackend(t))
+}
+
+func newTestSQLiteBackend(t *testing.T) *SQLiteBackend {
+	t.Helper()
+	ctx := context.Background()
+	backend, err := NewSQLiteBackend(ctx, filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.EnsureSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+// newTestTokenStoreOn returns a token store on backend that queues transient
+// failures without retrying them first.
+func newTestTokenStoreOn(t *testing.T, backend Backend) *TokenStore {
+	t.Helper()
+	s, err := NewTokenStore(backend, TokenStoreConfig{SpoolDir: filepath.Join(t.TempDir(), "spool"), RetryAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestSaveKeepsDisabledCredentialParked(t *testing.T) {
+	ctx := context.Background()
+	s := newTestTokenStore(t)
+	save := func(token string) {
+		t.Helper()
+		auth := &coreauth.Auth{ID: "codex.json", Metadata: map[string]any{"type": "codex", "access_token": token}}
+		if _, err := s.Save(ctx, auth); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	path := filepath.Join(s.AuthDir(), "codex.json")
+
+	save("a")
+	if _, err := s.SetDisabled(ctx, "codex.json", true, "ops", "quota"); err != nil {
+		t.Fatalf("SetDisabled: %v", err)
+	}
+	// A token refresh by CLIProxy must not bring the credential back.
+	save("b")
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("enabled file exists after save of a disabled credential (err=%v)", err)
+	}
+	parked, err := os.ReadFile(path + disabledSuffix)
+	if err != nil {
+		t.Fatalf("read parked file: %v", err)
+	}
+	meta := ParseAuthMeta(parked)
+	if !meta.Disabled || meta.DisabledBy != "ops" || meta.DisabledReason != "quota" {
+		t.Fatalf("parked meta = %+v, want disabled by ops for quota", meta)
+	}
+	rec, err := s.GetRecord(ctx, "codex.json")
+	if err != nil {
+		t.Fatalf("GetRecord: %v", err)
+	}
+	if !ParseAuthMeta(rec.Content).Disabled {
+		t.Fatalf("backend record lost the disabled flag: %s", rec.Content)
+	}
+	if string(rec.Content) != string(parked) {
+		t.Fatalf("backend record = %s, want %s", rec.Content, parked)
+	}
+
+	if _, err = s.SetDisabled(ctx, "codex.json", false, "ops", ""); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	save("c")
+	if _, err = os.Stat(path); err != nil {
+		t.Fatalf("enabled file missing after enable: %v", err)
+	}
+	if _, err = os.Stat(path + disabledSuffix); !os.IsNotExist(err) {
+		t.Fatalf("parked file still exists after enable (err=%v)", err)
+	}
+}
+
+func TestSaveDoesNotRecreateDeletedCredential(t *testing.T) {
+	ctx := context.Background()
+	s := newTestTokenStore(t)
+	auth := &coreauth.Auth{ID: "codex.json", Metadata: map[string]any{"type": "codex", "access_token": "a"}}
+	if _, err := s.Save(ctx, auth); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := s.Delete(ctx, "codex.json"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// CLIProxy reports the removal by saving the auth disabled.
+	auth.Disabled = true
+	path, err := s.Save(ctx, auth)
+	if err != nil || path != "" {
+		t.Fatalf("Save disabled = %q, %v; want a no-op", path, err)
+	}
+	mirror := filepath.Join(s.AuthDir(), "codex.json")
+	for _, p := range []string{mirror, mirror + disabledSuffix} {
+		if _, err = os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("%s was recreated (err=%v)", p, err)
+		}
+	}
+	if _, err = s.GetRecord(ctx, "codex.json"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("backend record was recreated (err=%v)", err)
+	}
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	healthCheckTimeout         = 5 * time.Second
+)
+
+// BackendHealth is the outcome of the latest health check.
+type BackendHealth struct {
+	Healthy             bool      `json:"healthy"`
+	CheckedAt           time.Time `json:"checked_at"`
+	LatencyMS           float64   `json:"latency_ms"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// HealthListener is told about every transition between healthy and
+// unhealthy; prev is nil for the first check.
+type HealthListener func(h BackendHealth, prev *BackendHealth)
+
+// SetHealthListener installs fn as the health transition listener.
+func (s *TokenStore) SetHealthListener(fn HealthListener) {
+	if s == nil {
+		return
+	}
+	s.onHealth.Store(&fn)
+}
+
+// Health returns the latest health check result, or nil before the first check.
+func (s *TokenStore) Health() *BackendHealth {
+	if s == nil {
+		return nil
+	}
+	return s.health.Load()
+}
+
+// CheckHealth pings the backend once and records the result.
+func (s *TokenStore) CheckHealth(ctx context.Context) *BackendHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := s.backend.Ping(ctx)
+	h := &BackendHealth{
+		Healthy:   err == nil,
+		CheckedAt: time.Now(),
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	prev := s.health.Load()
+	if err != nil {
+		h.LastError = err.Error()
+		h.ConsecutiveFailures = 1
+		if prev != nil {
+			h.ConsecutiveFailures = prev.ConsecutiveFailures + 1
+		}
+	}
+	s.health.Store(h)
+
+	switch {
+	case err != nil && (prev == nil || prev.Healthy):
+		log.Printf("token store: %s unhealthy: %v", s.backend, err)
+	case err == nil && prev != nil && !prev.Healthy:
+		log.Printf("token store: %s healthy again after %d failed check(s)", s.backend, prev.ConsecutiveFailures)
+	default:
+		return h
+	}
+	if fn := s.onHealth.Load(); fn != nil {
+		(*fn)(*h, prev)
+	}
+	return h
+}
+
+// RunHealthCheck pings the backend every HealthCheckInterval until ctx is
+// cancelled. When the backend recovers, queued writes are replayed right away.
+func (s *TokenStore) RunHealthCheck(ctx context.Context) {
+	s.CheckHealth(ctx)
+	ticker := time.NewTicker(s.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			prev := s.health.Load()
+			h := s.CheckHealth(ctx)
+			if h.Healthy && prev != nil && !prev.Healthy {
+				if _, err := s.ReplayOutbox(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("%v", err)
+				}
+			}
+		}
+	}
+}
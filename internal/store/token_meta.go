@@ -0,0 +1,179 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuthMeta is the searchable part of an auth document, extracted on every
+// write so listings can filter without parsing JSON.
+type AuthMeta struct {
+	// Provider is the document's lower-cased "type" field, e.g. "gemini" or "codex".
+	Provider  string `json:"provider"`
+	Email     string `json:"email,omitempty"`
+	Label     string `json:"label,omitempty"`
+	ProjectID string `json:"project_id,omitempty"`
+	Disabled  bool   `json:"disabled"`
+	// DisabledBy, DisabledReason and DisabledAt are recorded by SetDisabled.
+	DisabledBy     string     `json:"disabled_by,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	// ExpiresAt is the access token expiry, when the document records one.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// expiryFields are the expiry keys written by the CLIProxy providers, checked
+// at the top level and inside Gemini's nested "token" object.
+var expiryFields = []string{"expired", "expiry", "expires_at", "expire", "expiry_date"}
+
+// ParseAuthMeta extracts AuthMeta from an auth document. Documents that are
+// not JSON objects yield an empty AuthMeta.
+func ParseAuthMeta(content []byte) AuthMeta {
+	var doc map[string]any
+	if err := json.Unmarshal(content, &doc); err != nil || doc == nil {
+		return AuthMeta{}
+	}
+	meta := AuthMeta{
+		Provider:  strings.ToLower(strings.TrimSpace(stringField(doc, "type"))),
+		Email:     strings.TrimSpace(stringField(doc, "email")),
+		Label:     labelFor(doc),
+		ProjectID: strings.TrimSpace(stringField(doc, "project_id")),
+	}
+	meta.Disabled, _ = doc["disabled"].(bool)
+	if meta.Disabled {
+		meta.DisabledBy = strings.TrimSpace(stringField(doc, "disabled_by"))
+		meta.DisabledReason = strings.TrimSpace(stringField(doc, "disabled_reason"))
+		if at, err := time.Parse(time.RFC3339Nano, stringField(doc, "disabled_at")); err == nil {
+			at = at.UTC()
+			meta.DisabledAt = &at
+		}
+	}
+	if expiry, ok := expiryFrom(doc); ok {
+		meta.ExpiresAt = &expiry
+	} else if token, isMap := doc["token"].(map[string]any); isMap {
+		if expiry, ok = expiryFrom(token); ok {
+			meta.ExpiresAt = &expiry
+		}
+	}
+	return meta
+}
+
+func stringField(doc map[string]any, key string) string {
+	v, _ := doc[key].(string)
+	return v
+}
+
+// expiryFrom reads the first expiry field of doc. Strings are RFC 3339;
+// numbers are Unix seconds, or milliseconds when they are that large.
+func expiryFrom(doc map[string]any) (time.Time, bool) {
+	for _, key := range expiryFields {
+		switch v := doc[key].(type) {
+		case string:
+			v = strings.TrimSpace(v)
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t.UTC(), true
+			}
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+				return unixAuto(n), true
+			}
+		case float64:
+			if v > 0 {
+				return unixAuto(int64(v)), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func unixAuto(n int64) time.Time {
+	if n >= 1e12 {
+		return time.UnixMilli(n).UTC()
+	}
+	return time.Unix(n, 0).UTC()
+}
+
+// AuthSummary is a stored auth document without its content.
+type AuthSummary struct {
+	ID string `json:"id"`
+	AuthMeta
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AuthFilter selects auth documents by their extracted metadata. Empty fields
+// match everything.
+type AuthFilter struct {
+	Provider  string
+	Email     string
+	ProjectID string
+	// Label is a case-insensitive substring of the label.
+	Label    string
+	Disabled *bool
+	// ExpiresBefore and ExpiresAfter only match documents with a known expiry.
+	ExpiresBefore time.Time
+	ExpiresAfter  time.Time
+	// Limit caps the number of results; zero returns all of them.
+	Limit int
+}
+
+// Match reports whether s satisfies the filter. Provider and e-mail compare
+// case-insensitively, like the Postgres query.
+func (f AuthFilter) Match(s AuthSummary) bool {
+	switch {
+	case f.Provider != "" && !strings.EqualFold(s.Provider, f.Provider):
+		return false
+	case f.Email != "" && !strings.EqualFold(s.Email, f.Email):
+		return false
+	case f.ProjectID != "" && s.ProjectID != f.ProjectID:
+		return false
+	case f.Label != "" && !strings.Contains(strings.ToLower(s.Label), strings.ToLower(f.Label)):
+		return false
+	case f.Disabled != nil && s.Disabled != *f.Disabled:
+		return false
+	}
+	if !f.ExpiresBefore.IsZero() && (s.ExpiresAt == nil || !s.ExpiresAt.Before(f.ExpiresBefore)) {
+		return false
+	}
+	if !f.ExpiresAfter.IsZero() && (s.ExpiresAt == nil || !s.ExpiresAt.After(f.ExpiresAfter)) {
+		return false
+	}
+	return true
+}
+
+// SummaryBackend is a Backend that stores AuthMeta alongside each document
+// and filters on it server-side.
+type SummaryBackend interface {
+	Backend
+	// ListSummaries returns the matching documents ordered by id.
+	ListSummaries(ctx context.Context, filter AuthFilter) ([]AuthSummary, error)
+}
+
+// ListSummaries returns the stored auth documents matching filter, ordered by
+// id. Backends without metadata columns are listed in full and filtered here.
+func (s *TokenStore) ListSummaries(ctx context.Context, filter AuthFilter) ([]AuthSummary, error) {
+	if s == nil || s.backend == nil {
+		return nil, nil
+	}
+	if sb, ok := s.backend.(SummaryBackend); ok {
+		return sb.ListSummaries(ctx, filter)
+	}
+	records, err := s.ListRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []AuthSummary
+	for _, rec := range records {
+		summary := AuthSummary{ID: rec.ID, AuthMeta: ParseAuthMeta(rec.Content), CreatedAt: rec.CreatedAt, UpdatedAt: rec.UpdatedAt}
+		if !filter.Match(summary) {
+			continue
+		}
+		out = append(out, summary)
+		if filter.Limit > 0 && len(out) == filter.Limit {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,324 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 2 * time.Second
+
+	// outboxDirName lives in the spool root, next to (not inside) the watched auth directory.
+	outboxDirName = "outbox"
+
+	outboxUpsert = "upsert"
+	outboxDelete = "delete"
+)
+
+// outboxEntry is a write to auth_store that could not be applied yet. Upserts
+// carry no content: the mirrored file is read when the entry is replayed, so
+// the newest local state is what reaches the backend.
+type outboxEntry struct {
+	Op        string    `json:"op"`
+	ID        string    `json:"id"`
+	QueuedAt  time.Time `json:"queued_at"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// OutboxStats describes the queue of pending auth_store writes.
+type OutboxStats struct {
+	Depth          int       `json:"depth"`
+	OldestQueuedAt time.Time `json:"oldest_queued_at,omitempty"`
+	Queued         int64     `json:"queued_total"`
+	Replayed       int64     `json:"replayed_total"`
+	Dropped        int64     `json:"dropped_total"`
+	Retries        int64     `json:"retries_total"`
+}
+
+// OutboxStats returns the current queue depth and lifetime counters.
+func (s *TokenStore) OutboxStats() OutboxStats {
+	stats := OutboxStats{
+		Queued:   s.outboxQueued.Load(),
+		Replayed: s.outboxReplayed.Load(),
+		Dropped:  s.outboxDropped.Load(),
+		Retries:  s.retries.Load(),
+	}
+	entries, err := s.loadOutbox()
+	if err != nil {
+		return stats
+	}
+	stats.Depth = len(entries)
+	if len(entries) > 0 {
+		stats.OldestQueuedAt = entries[0].QueuedAt
+	}
+	return stats
+}
+
+// writeThrough applies a write to auth_store, retrying transient failures with
+// backoff. When the backend stays unreachable the write is queued in the outbox
+// and nil is returned: the auth file is already on disk and the outbox
+// replays it later. Permanent errors are returned unchanged.
+func (s *TokenStore) writeThrough(ctx context.Context, op, id string, write func(context.Context) error) error {
+	err := s.withRetry(ctx, write)
+	if err == nil {
+		// A successful write supersedes anything queued earlier for the same id.
+		s.dequeue(id)
+		return nil
+	}
+	if !isTransient(err) {
+		return err
+	}
+	if errQueue := s.enqueue(op, id, err); errQueue != nil {
+		return errors.Join(err, errQueue)
+	}
+	log.Printf("token store: %s of %s queued for retry: %v", op, id, err)
+	return nil
+}
+
+// withRetry runs fn up to RetryAttempts times with exponential backoff while it
+// fails with a transient error.
+func (s *TokenStore) withRetry(ctx context.Context, fn func(context.Context) error) error {
+	delay := s.cfg.RetryBaseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil || !isTransient(err) || attempt >= s.cfg.RetryAttempts {
+			return err
+		}
+		s.retries.Add(1)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, s.cfg.RetryMaxDelay)
+	}
+}
+
+// ReplayOutbox applies queued writes oldest first. It stops at the first
+// transient failure, leaving the rest queued, and drops entries that fail
+// permanently. It returns the number of entries applied.
+func (s *TokenStore) ReplayOutbox(ctx context.Context) (int, error) {
+	if s == nil || s.backend == nil {
+		return 0, fmt.Errorf("token store: not initialized")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replayOutboxLocked(ctx)
+}
+
+func (s *TokenStore) replayOutboxLocked(ctx context.Context) (int, error) {
+	entries, err := s.loadOutbox()
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	for _, entry := range entries {
+		err = s.replayEntry(ctx, entry)
+		switch {
+		case err == nil:
+			s.dequeue(entry.ID)
+			s.outboxReplayed.Add(1)
+			replayed++
+		case isTransient(err):
+			entry.Attempts++
+			entry.LastError = err.Error()
+			_ = s.writeOutboxEntry(entry)
+			return replayed, fmt.Errorf("token store: replay outbox: %w", err)
+		default:
+			log.Printf("token store: dropping queued %s of %s: %v", entry.Op, entry.ID, err)
+			s.dequeue(entry.ID)
+			s.outboxDropped.Add(1)
+		}
+	}
+	return replayed, nil
+}
+
+func (s *TokenStore) replayEntry(ctx context.Context, entry outboxEntry) error {
+	path, err := s.absoluteAuthPath(entry.ID)
+	if err != nil {
+		return err
+	}
+	if entry.Op == outboxUpsert {
+		if existing, ok := existingMirrorPath(path); ok {
+			return s.upsertAuthRecord(ctx, entry.ID, existing)
+		}
+		// The file is gone since the upsert was queued; the mirror is the source of truth.
+	}
+	return s.deleteAuthRecord(ctx, entry.ID)
+}
+
+// RunOutbox replays queued writes every interval until ctx is cancelled.
+func (s *TokenStore) RunOutbox(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.OutboxStats().Depth == 0 {
+				continue
+			}
+			n, err := s.ReplayOutbox(ctx)
+			if n > 0 {
+				log.Printf("token store: replayed %d queued write(s)", n)
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("%v", err)
+			}
+		}
+	}
+}
+
+func (s *TokenStore) outboxDir() string {
+	return filepath.Join(s.spoolRoot, outboxDirName)
+}
+
+func (s *TokenStore) outboxPath(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.outboxDir(), hex.EncodeToString(sum[:16])+".json")
+}
+
+// enqueue records op for id, replacing any earlier entry for the same id but
+// keeping its queue time so the oldest pending age stays accurate.
+func (s *TokenStore) enqueue(op, id string, cause error) error {
+	entry := outboxEntry{Op: op, ID: id, QueuedAt: time.Now().UTC(), LastError: cause.Error()}
+	if data, err := os.ReadFile(s.outboxPath(id)); err == nil {
+		var prev outboxEntry
+		if json.Unmarshal(data, &prev) == nil && !prev.QueuedAt.IsZero() {
+			entry.QueuedAt = prev.QueuedAt
+			entry.Attempts = prev.Attempts
+		}
+	}
+	entry.Attempts++
+	if err := s.writeOutboxEntry(entry); err != nil {
+		return err
+	}
+	s.outboxQueued.Add(1)
+	return nil
+}
+
+func (s *TokenStore) writeOutboxEntry(entry outboxEntry) error {
+	if err := os.MkdirAll(s.outboxDir(), 0o700); err != nil {
+		return fmt.Errorf("token store: create outbox: %w", err)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("token store: encode outbox entry: %w", err)
+	}
+	path := s.outboxPath(entry.ID)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("token store: write outbox entry: %w", err)
+	}
+	_, errWrite := f.Write(data)
+	// Sync so a queued write survives a crash right after Save returned.
+	errSync := f.Sync()
+	if err = errors.Join(errWrite, errSync, f.Close()); err != nil {
+		return fmt.Errorf("token store: write outbox entry: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("token store: write outbox entry: %w", err)
+	}
+	return nil
+}
+
+func (s *TokenStore) dequeue(id string) {
+	if err := os.Remove(s.outboxPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("token store: remove outbox entry for %s: %v", id, err)
+	}
+}
+
+// loadOutbox returns queued entries oldest first.
+func (s *TokenStore) loadOutbox() ([]outboxEntry, error) {
+	dirEntries, err := os.ReadDir(s.outboxDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("token store: read outbox: %w", err)
+	}
+	entries := make([]outboxEntry, 0, len(dirEntries))
+	for _, d := range dirEntries {
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			continue
+		}
+		data, errRead := os.ReadFile(filepath.Join(s.outboxDir(), d.Name()))
+		if errRead != nil {
+			continue
+		}
+		var entry outboxEntry
+		if errDecode := json.Unmarshal(data, &entry); errDecode != nil || entry.ID == "" {
+			log.Printf("token store: ignoring corrupt outbox entry %s", d.Name())
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].QueuedAt.Before(entries[j].QueuedAt) })
+	return entries, nil
+}
+
+// isTransient reports whether err is worth retrying: connection failures,
+// timeouts, server shutdowns, resource exhaustion, serialization conflicts,
+// a busy SQLite database and throttled or failing S3 requests.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Classes 08 (connection exception) and 53 (insufficient resources),
+		// server shutdown/startup, serialization failures and deadlocks.
+		if strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") {
+			return true
+		}
+		switch pgErr.Code {
+		case "57P01", "57P02", "57P03", "40001", "40P01":
+			return true
+		}
+		return false
+	}
+	if sqliteBusy(err) {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	if pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	var backendErr transientError
+	if errors.As(err, &backendErr) {
+		return backendErr.Transient()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
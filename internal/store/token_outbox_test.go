@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+)
+
+// sqliteCodeError mimics the coded errors returned by the SQLite driver.
+type sqliteCodeError int
+
+func (e sqliteCodeError) Error() string { return fmt.Sprintf("sqlite error %d", int(e)) }
+func (e sqliteCodeError) Code() int     { return int(e) }
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", fmt.Errorf("put: %w", context.Canceled), false},
+		{"deadline", fmt.Errorf("put: %w", context.DeadlineExceeded), true},
+		{"not found", ErrNotFound, false},
+		{"plain error", errors.New("invalid input"), false},
+		{"postgres connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"postgres too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"postgres admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"postgres serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"postgres deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"postgres unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"postgres undefined table", fmt.Errorf("list: %w", &pgconn.PgError{Code: "42P01"}), false},
+		{"sqlite busy", sqliteCodeError(5), true},
+		{"sqlite busy recovery", sqliteCodeError(5 | 1<<8), true},
+		{"sqlite locked", fmt.Errorf("put: %w", sqliteCodeError(6)), true},
+		{"sqlite constraint", sqliteCodeError(19), false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"connection done", sql.ErrConnDone, true},
+		{"eof", io.EOF, true},
+		{"unexpected eof", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{"connection reset", syscall.ECONNRESET, true},
+		{"dns failure", &net.DNSError{Err: "no such host", Name: "db"}, true},
+		{"s3 throttled", &s3Error{Op: "put", Status: 503, Code: "SlowDown"}, true},
+		{"s3 too many requests", &s3Error{Op: "put", Status: 429}, true},
+		{"s3 request timeout", &s3Error{Op: "put", Status: 400, Code: "RequestTimeout"}, true},
+		{"s3 access denied", &s3Error{Op: "put", Status: 403, Code: "AccessDenied"}, false},
+		{"s3 missing key", &s3Error{Op: "get", Status: 404, Code: "NoSuchKey"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Fatalf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// failingBackend wraps a Backend and fails writes of selected ids.
+type failingBackend struct {
+	Backend
+	mu   sync.Mutex
+	fail map[string]error
+}
+
+func (b *failingBackend) setFailure(id string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.fail, id)
+		return
+	}
+	b.fail[id] = err
+}
+
+func (b *failingBackend) failure(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err, ok := b.fail[id]; ok {
+		return err
+	}
+	return b.fail["*"]
+}
+
+func (b *failingBackend) Put(ctx context.Context, id string, content []byte) (time.Time, error) {
+	if err := b.failure(id); err != nil {
+		return time.Time{}, err
+	}
+	return b.Backend.Put(ctx, id, content)
+}
+
+func (b *failingBackend) Delete(ctx context.Context, id string) error {
+	if err := b.failure(id); err != nil {
+		return err
+	}
+	return b.Backend.Delete(ctx, id)
+}
+
+func TestReplayOutbox(t *testing.T) {
+	ctx := context.Background()
+	backend := &failingBackend{Backend: newTestSQLiteBackend(t), fail: make(map[string]error)}
+	s := newTestTokenStoreOn(t, backend)
+	outage := &s3Error{Op: "put", Status: 503}
+
+	// Every write fails transiently, so each one is queued and Save still succeeds.
+	backend.setFailure("*", outage)
+	for _, id := range []string{"a.json", "b.json", "c.json"} {
+		auth := &coreauth.Auth{ID: id, Metadata: map[string]any{"type": "codex", "id": id}}
+		if _, err := s.Save(ctx, auth); err != nil {
+			t.Fatalf("Save %s: %v", id, err)
+		}
+	}
+	if depth := s.OutboxStats().Depth; depth != 3 {
+		t.Fatalf("outbox depth = %d, want 3", depth)
+	}
+
+	// a fails permanently and is dropped; b is still unreachable, so replay
+	// stops there and c stays queued behind it.
+	backend.setFailure("*", nil)
+	backend.setFailure("a.json", errors.New("rejected"))
+	backend.setFailure("b.json", outage)
+	n, err := s.ReplayOutbox(ctx)
+	if err == nil || !isTransient(err) {
+		t.Fatalf("ReplayOutbox err = %v, want the transient failure of b.json", err)
+	}
+	if n != 0 {
+		t.Fatalf("replayed %d entries, want 0", n)
+	}
+	stats := s.OutboxStats()
+	if stats.Depth != 2 || stats.Dropped != 1 || stats.Replayed != 0 {
+		t.Fatalf("stats = %+v, want depth 2 with one dropped", stats)
+	}
+	entries, err := s.loadOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].ID != "b.json" || entries[0].Attempts != 2 || entries[0].LastError == "" {
+		t.Fatalf("head of outbox = %+v, want b.json with a second attempt recorded", entries[0])
+	}
+
+	backend.setFailure("b.json", nil)
+	if n, err = s.ReplayOutbox(ctx); err != nil || n != 2 {
+		t.Fatalf("ReplayOutbox = %d, %v; want 2 replayed", n, err)
+	}
+	if stats = s.OutboxStats(); stats.Depth != 0 || stats.Replayed != 2 {
+		t.Fatalf("stats = %+v, want an empty outbox", stats)
+	}
+	for _, id := range []string{"b.json", "c.json"} {
+		if _, err = backend.Get(ctx, id); err != nil {
+			t.Fatalf("Get %s after replay: %v", id, err)
+		}
+	}
+	if _, err = backend.Get(ctx, "a.json"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("dropped a.json reached the backend (err=%v)", err)
+	}
+}
@@ -0,0 +1,659 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	coreauth "github.com/router-for-me/CLIProxyAPI/v6/sdk/cliproxy/auth"
+)
+
+// TokenStoreConfig configures the local mirror and write path shared by every backend.
+type TokenStoreConfig struct {
+	// SpoolDir holds the mirrored auths/ directory, the outbox and the sync
+	// state; defaults to ./pgstore.
+	SpoolDir string
+	// RetryAttempts bounds how often a transient write failure is retried
+	// before the write is queued in the outbox; defaults to 3.
+	RetryAttempts int
+	// RetryBaseDelay is the first backoff delay, doubled per attempt up to
+	// RetryMaxDelay; defaults to 100ms and 2s.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// HealthCheckInterval is how often RunHealthCheck pings the backend; default 30s.
+	HealthCheckInterval time.Duration
+}
+
+// AuthRecord is a raw row of the auth table.
+type AuthRecord struct {
+	ID        string
+	Content   []byte
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TokenStore persists authentication metadata in a Backend while mirroring
+// auth JSON files to a local workspace so CLIProxy's existing file-based
+// logic and watchers keep working.
+type TokenStore struct {
+	backend   Backend
+	cfg       TokenStoreConfig
+	spoolRoot string
+	authDir   string
+	mu        sync.Mutex
+
+	// lastReconcile is the report of the most recent Reconcile run.
+	lastReconcile atomic.Pointer[ReconcileReport]
+
+	retries        atomic.Int64
+	outboxQueued   atomic.Int64
+	outboxReplayed atomic.Int64
+	outboxDropped  atomic.Int64
+
+	health   atomic.Pointer[BackendHealth]
+	onHealth atomic.Pointer[HealthListener]
+}
+
+// NewTokenStore prepares the local auth workspace for backend. The store
+// takes ownership of backend and closes it in Close.
+func NewTokenStore(backend Backend, cfg TokenStoreConfig) (*TokenStore, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("token store: backend is required")
+	}
+	if cfg.RetryAttempts <= 0 {
+		cfg.RetryAttempts = defaultRetryAttempts
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = defaultRetryBaseDelay
+	}
+	if cfg.RetryMaxDelay < cfg.RetryBaseDelay {
+		cfg.RetryMaxDelay = max(defaultRetryMaxDelay, cfg.RetryBaseDelay)
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = defaultHealthCheckInterval
+	}
+
+	spoolRoot := strings.TrimSpace(cfg.SpoolDir)
+	if spoolRoot == "" {
+		if cwd, err := os.Getwd(); err == nil {
+			spoolRoot = filepath.Join(cwd, "pgstore")
+		} else {
+			spoolRoot = filepath.Join(os.TempDir(), "pgstore")
+		}
+	}
+	absSpool, err := filepath.Abs(spoolRoot)
+	if err != nil {
+		return nil, fmt.Errorf("token store: resolve spool directory: %w", err)
+	}
+	authDir := filepath.Join(absSpool, "auths")
+	if err = os.MkdirAll(authDir, 0o700); err != nil {
+		return nil, fmt.Errorf("token store: create auth directory: %w", err)
+	}
+
+	return &TokenStore{
+		backend:   backend,
+		cfg:       cfg,
+		spoolRoot: absSpool,
+		authDir:   authDir,
+	}, nil
+}
+
+// Close releases the backend.
+func (s *TokenStore) Close() error {
+	if s == nil || s.backend == nil {
+		return nil
+	}
+	return s.backend.Close()
+}
+
+// Backend returns the backend the store writes to.
+func (s *TokenStore) Backend() Backend {
+	if s == nil {
+		return nil
+	}
+	return s.backend
+}
+
+// DB exposes the Postgres connection pool so other HelixRun tables can share
+// it. It returns nil for other backends.
+func (s *TokenStore) DB() *sql.DB {
+	if pg := s.postgres(); pg != nil {
+		return pg.DB()
+	}
+	return nil
+}
+
+// Schema returns the Postgres schema name, or an empty string for the
+// default search path and for other backends.
+func (s *TokenStore) Schema() string {
+	if pg := s.postgres(); pg != nil {
+		return pg.Schema()
+	}
+	return ""
+}
+
+// PoolStats returns the Postgres connection pool statistics, or nil for other backends.
+func (s *TokenStore) PoolStats() *PoolStats {
+	if pg := s.postgres(); pg != nil {
+		stats := pg.PoolStats()
+		return &stats
+	}
+	return nil
+}
+
+func (s *TokenStore) postgres() *PostgresBackend {
+	if s == nil {
+		return nil
+	}
+	pg, _ := s.backend.(*PostgresBackend)
+	return pg
+}
+
+// AuthDir returns the local directory containing mirrored auth files.
+func (s *TokenStore) AuthDir() string {
+	if s == nil {
+		return ""
+	}
+	return s.authDir
+}
+
+// EnsureSchema creates whatever the backend needs to store auth records.
+func (s *TokenStore) EnsureSchema(ctx context.Context) error {
+	if s == nil || s.backend == nil {
+		return fmt.Errorf("token store: not initialized")
+	}
+	return s.backend.EnsureSchema(ctx)
+}
+
+// Save persists authentication metadata to disk and the backend.
+func (s *TokenStore) Save(ctx context.Context, auth *coreauth.Auth) (string, error) {
+	if auth == nil {
+		return "", fmt.Errorf("token store: auth is nil")
+	}
+
+	path, err := s.resolveAuthPath(auth)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("token store: missing file path attribute for %s", auth.ID)
+	}
+
+	// CLIProxy removes an auth by saving it disabled; a credential that is gone
+	// from the mirror (neither file nor parked copy) must not be recreated.
+	if auth.Disabled {
+		_, errFile := os.Stat(path)
+		_, errParked := os.Stat(path + disabledSuffix)
+		if errors.Is(errFile, fs.ErrNotExist) && errors.Is(errParked, fs.ErrNotExist) {
+			return "", nil
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var raw []byte
+	switch {
+	case auth.Storage != nil:
+		tmp := path + ".tmp"
+		if err = os.MkdirAll(filepath.Dir(tmp), 0o700); err != nil {
+			return "", fmt.Errorf("token store: create auth directory: %w", err)
+		}
+		if err = auth.Storage.SaveTokenToFile(tmp); err != nil {
+			return "", err
+		}
+		raw, err = os.ReadFile(tmp)
+		_ = os.Remove(tmp)
+		if err != nil {
+			return "", fmt.Errorf("token store: read saved token: %w", err)
+		}
+	case auth.Metadata != nil:
+		if raw, err = json.Marshal(auth.Metadata); err != nil {
+			return "", fmt.Errorf("token store: marshal metadata: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("token store: nothing to persist for %s", auth.ID)
+	}
+	// CLIProxy saves refreshed tokens without HelixRun's disabled flag; a
+	// credential parked through SetDisabled must stay parked.
+	if parked, errRead := os.ReadFile(path + disabledSuffix); errRead == nil {
+		if raw, err = keepDisabledFields(raw, parked); err != nil {
+			return "", fmt.Errorf("token store: %s: %w", auth.ID, err)
+		}
+	} else if !errors.Is(errRead, fs.ErrNotExist) {
+		return "", fmt.Errorf("token store: read disabled auth file: %w", errRead)
+	}
+	target := path
+	if ParseAuthMeta(raw).Disabled {
+		target = path + disabledSuffix
+	}
+	if existing, errRead := os.ReadFile(target); errRead == nil && jsonEqual(existing, raw) {
+		return path, nil
+	} else if errRead != nil && !errors.Is(errRead, fs.ErrNotExist) {
+		return "", fmt.Errorf("token store: read existing metadata: %w", errRead)
+	}
+	written, err := s.writeMirrorLocked(path, raw)
+	if err != nil {
+		return "", err
+	}
+
+	if auth.Attributes == nil {
+		auth.Attributes = make(map[string]string)
+	}
+	auth.Attributes["path"] = path
+
+	if strings.TrimSpace(auth.FileName) == "" {
+		auth.FileName = auth.ID
+	}
+
+	relID, err := s.relativeAuthID(path)
+	if err != nil {
+		return "", err
+	}
+	if err = s.writeThrough(ctx, outboxUpsert, relID, func(ctx context.Context) error {
+		return s.upsertAuthRecord(ctx, relID, written)
+	}); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// List enumerates all auth JSON files under the managed auth directory.
+func (s *TokenStore) List(ctx context.Context) ([]*coreauth.Auth, error) {
+	if s == nil {
+		return nil, fmt.Errorf("token store: not initialized")
+	}
+	dir := s.authDir
+	if dir == "" {
+		return nil, fmt.Errorf("token store: auth directory not configured")
+	}
+	var entries []*coreauth.Auth
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !strings.HasSuffix(strings.ToLower(d.Name()), ".json") {
+			return nil
+		}
+		auth, err := s.readAuthFile(path, dir)
+		if err != nil {
+			return nil
+		}
+		if auth != nil {
+			entries = append(entries, auth)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Delete removes the auth file and its record from the backend.
+func (s *TokenStore) Delete(ctx context.Context, id string) error {
+	if s == nil {
+		return fmt.Errorf("token store: not initialized")
+	}
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return fmt.Errorf("token store: id is empty")
+	}
+	path, err := s.resolveDeletePath(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err = removeMirror(path); err != nil {
+		return err
+	}
+	relID, err := s.relativeAuthID(path)
+	if err != nil {
+		return err
+	}
+	return s.writeThrough(ctx, outboxDelete, relID, func(ctx context.Context) error {
+		return s.deleteAuthRecord(ctx, relID)
+	})
+}
+
+// ListRecords returns every record of the backend ordered by id.
+func (s *TokenStore) ListRecords(ctx context.Context) ([]AuthRecord, error) {
+	if s == nil || s.backend == nil {
+		return nil, fmt.Errorf("token store: not initialized")
+	}
+	return s.backend.List(ctx, time.Time{})
+}
+
+// GetRecord returns the record stored under id, or ErrNotFound.
+func (s *TokenStore) GetRecord(ctx context.Context, id string) (*AuthRecord, error) {
+	if s == nil || s.backend == nil {
+		return nil, fmt.Errorf("token store: not initialized")
+	}
+	return s.backend.Get(ctx, normalizeAuthID(id))
+}
+
+// GetRecords returns the records stored under ids, keyed by id. Missing ids
+// are absent from the map.
+func (s *TokenStore) GetRecords(ctx context.Context, ids []string) (map[string]AuthRecord, error) {
+	if s == nil || s.backend == nil {
+		return nil, fmt.Errorf("token store: not initialized")
+	}
+	normalized := make([]string, len(ids))
+	for i, id := range ids {
+		normalized[i] = normalizeAuthID(id)
+	}
+	if batch, ok := s.backend.(BatchBackend); ok {
+		return batch.GetMany(ctx, normalized)
+	}
+	out := make(map[string]AuthRecord, len(normalized))
+	for _, id := range normalized {
+		rec, err := s.backend.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[id] = *rec
+	}
+	return out, nil
+}
+
+// PutRecord writes raw auth JSON under id to the local mirror and the backend.
+func (s *TokenStore) PutRecord(ctx context.Context, id string, content []byte) error {
+	if s == nil || s.backend == nil {
+		return fmt.Errorf("token store: not initialized")
+	}
+	if !json.Valid(content) {
+		return fmt.Errorf("token store: %s is not valid JSON", id)
+	}
+	path, err := s.absoluteAuthPath(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	written, err := s.writeMirrorLocked(path, content)
+	if err != nil {
+		return err
+	}
+	relID, err := s.relativeAuthID(path)
+	if err != nil {
+		return err
+	}
+	if err = s.withRetry(ctx, func(ctx context.Context) error {
+		return s.upsertAuthRecord(ctx, relID, written)
+	}); err != nil {
+		return err
+	}
+	s.dequeue(relID)
+	return nil
+}
+
+// PutRecords writes many auth documents to the local mirror and the backend.
+// A BatchBackend stores them in one round trip (Postgres streams them with
+// COPY); other backends get one write per document. When the same id appears
+// more than once, the last document wins.
+func (s *TokenStore) PutRecords(ctx context.Context, records []AuthRecord) error {
+	if s == nil || s.backend == nil {
+		return fmt.Errorf("token store: not initialized")
+	}
+	byID := make(map[string]int, len(records))
+	var batch []AuthRecord
+	for _, rec := range records {
+		if !json.Valid(rec.Content) {
+			return fmt.Errorf("token store: %s is not valid JSON", rec.ID)
+		}
+		path, err := s.absoluteAuthPath(rec.ID)
+		if err != nil {
+			return err
+		}
+		relID, err := s.relativeAuthID(path)
+		if err != nil {
+			return err
+		}
+		rec.ID = relID
+		if i, ok := byID[relID]; ok {
+			batch[i] = rec
+			continue
+		}
+		byID[relID] = len(batch)
+		batch = append(batch, rec)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range batch {
+		path := filepath.Join(s.authDir, filepath.FromSlash(rec.ID))
+		if _, err := s.writeMirrorLocked(path, rec.Content); err != nil {
+			return err
+		}
+	}
+	if err := s.withRetry(ctx, func(ctx context.Context) error {
+		return s.putAuthRecords(ctx, batch)
+	}); err != nil {
+		return err
+	}
+	for _, rec := range batch {
+		s.dequeue(rec.ID)
+	}
+	return nil
+}
+
+// DeleteRecord removes the record stored under id and its mirrored file. It
+// returns ErrNotFound when no such record exists.
+func (s *TokenStore) DeleteRecord(ctx context.Context, id string) error {
+	if s == nil || s.backend == nil {
+		return fmt.Errorf("token store: not initialized")
+	}
+	path, err := s.absoluteAuthPath(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err = removeMirror(path); err != nil {
+		return err
+	}
+	return s.backend.Delete(ctx, normalizeAuthID(id))
+}
+
+// SetBaseDir is accepted by some authenticator helpers; it is a no-op because
+// the store controls its own workspace.
+func (s *TokenStore) SetBaseDir(string) {}
+
+func (s *TokenStore) upsertAuthRecord(ctx context.Context, relID, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("token store: read auth file: %w", err)
+	}
+	if len(data) == 0 {
+		return s.deleteAuthRecord(ctx, relID)
+	}
+	_, err = s.backend.Put(ctx, relID, data)
+	return err
+}
+
+func (s *TokenStore) putAuthRecords(ctx context.Context, records []AuthRecord) error {
+	if batch, ok := s.backend.(BatchBackend); ok {
+		return batch.PutMany(ctx, records)
+	}
+	for _, rec := range records {
+		if _, err := s.backend.Put(ctx, rec.ID, rec.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteAuthRecord removes relID from the backend; a missing record is not an error.
+func (s *TokenStore) deleteAuthRecord(ctx context.Context, relID string) error {
+	if err := s.backend.Delete(ctx, relID); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *TokenStore) resolveAuthPath(auth *coreauth.Auth) (string, error) {
+	if auth == nil {
+		return "", fmt.Errorf("token store: auth is nil")
+	}
+	if auth.Attributes != nil {
+		if p := strings.TrimSpace(auth.Attributes["path"]); p != "" {
+			return p, nil
+		}
+	}
+	if fileName := strings.TrimSpace(auth.FileName); fileName != "" {
+		if filepath.IsAbs(fileName) {
+			return fileName, nil
+		}
+		return filepath.Join(s.authDir, fileName), nil
+	}
+	if auth.ID == "" {
+		return "", fmt.Errorf("token store: missing id")
+	}
+	if filepath.IsAbs(auth.ID) {
+		return auth.ID, nil
+	}
+	return filepath.Join(s.authDir, filepath.FromSlash(auth.ID)), nil
+}
+
+func (s *TokenStore) resolveDeletePath(id string) (string, error) {
+	if strings.ContainsRune(id, os.PathSeparator) || filepath.IsAbs(id) {
+		return id, nil
+	}
+	return filepath.Join(s.authDir, filepath.FromSlash(id)), nil
+}
+
+func (s *TokenStore) relativeAuthID(path string) (string, error) {
+	if s == nil {
+		return "", fmt.Errorf("token store: store not initialized")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.authDir, path)
+	}
+	clean := filepath.Clean(path)
+	rel, err := filepath.Rel(s.authDir, clean)
+	if err != nil {
+		return "", fmt.Errorf("token store: compute relative path: %w", err)
+	}
+	if strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("token store: path %s outside managed directory", path)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (s *TokenStore) absoluteAuthPath(id string) (string, error) {
+	if s == nil {
+		return "", fmt.Errorf("token store: store not initialized")
+	}
+	clean := filepath.Clean(filepath.FromSlash(id))
+	if strings.HasPrefix(clean, "..") {
+		return "", fmt.Errorf("token store: invalid auth identifier %s", id)
+	}
+	path := filepath.Join(s.authDir, clean)
+	rel, err := filepath.Rel(s.authDir, path)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("token store: resolved auth path escapes auth directory")
+	}
+	return path, nil
+}
+
+func jsonEqual(a, b []byte) bool {
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return false
+	}
+	return fmt.Sprintf("%v", va) == fmt.Sprintf("%v", vb)
+}
+
+func (s *TokenStore) readAuthFile(path, baseDir string) (*coreauth.Auth, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	metadata := make(map[string]any)
+	if err = json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("unmarshal auth json: %w", err)
+	}
+	provider, _ := metadata["type"].(string)
+	if provider == "" {
+		provider = "unknown"
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat file: %w", err)
+	}
+	id := s.idFor(path, baseDir)
+	auth := &coreauth.Auth{
+		ID:         id,
+		Provider:   provider,
+		FileName:   id,
+		Label:      labelFor(metadata),
+		Status:     coreauth.StatusActive,
+		Attributes: map[string]string{"path": path},
+		Metadata:   metadata,
+		CreatedAt:  info.ModTime(),
+		UpdatedAt:  info.ModTime(),
+	}
+	if email, ok := metadata["email"].(string); ok && email != "" {
+		auth.Attributes["email"] = email
+	}
+	return auth, nil
+}
+
+func (s *TokenStore) idFor(path, baseDir string) string {
+	if baseDir == "" {
+		return normalizeAuthID(path)
+	}
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		return normalizeAuthID(path)
+	}
+	return normalizeAuthID(rel)
+}
+
+func labelFor(metadata map[string]any) string {
+	if metadata == nil {
+		return ""
+	}
+	if v, ok := metadata["label"].(string); ok && strings.TrimSpace(v) != "" {
+		return strings.TrimSpace(v)
+	}
+	if v, ok := metadata["email"].(string); ok && strings.TrimSpace(v) != "" {
+		return strings.TrimSpace(v)
+	}
+	if v, ok := metadata["project_id"].(string); ok && strings.TrimSpace(v) != "" {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+func normalizeAuthID(id string) string {
+	return filepath.ToSlash(filepath.Clean(id))
+}
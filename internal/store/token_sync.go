@@ -0,0 +1,480 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// authSyncStateFile lives in the spool root, next to (not inside) the watched auth directory.
+const authSyncStateFile = "auth-sync-state.json"
+
+// watermarkOverlap is subtracted from the watermark when selecting changed
+// rows, so rows written by transactions that committed late are not missed.
+const watermarkOverlap = time.Minute
+
+// ReconcileConflict describes an id that changed on both sides since the last reconcile.
+type ReconcileConflict struct {
+	ID         string `json:"id"`
+	Reason     string `json:"reason"`
+	Resolution string `json:"resolution"`
+}
+
+// ReconcileReport summarises one Reconcile run.
+type ReconcileReport struct {
+	StartedAt     time.Time           `json:"started_at"`
+	DurationMS    int64               `json:"duration_ms"`
+	Full          bool                `json:"full"`
+	Fetched       int                 `json:"fetched"`
+	InSync        int                 `json:"in_sync"`
+	Pushed        []string            `json:"pushed,omitempty"`
+	Pulled        []string            `json:"pulled,omitempty"`
+	DeletedLocal  []string            `json:"deleted_local,omitempty"`
+	DeletedRemote []string            `json:"deleted_remote,omitempty"`
+	Conflicts     []ReconcileConflict `json:"conflicts,omitempty"`
+	Errors        []string            `json:"errors,omitempty"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// Changed reports whether the run modified either side or found problems.
+func (r *ReconcileReport) Changed() bool {
+	return len(r.Pushed)+len(r.Pulled)+len(r.DeletedLocal)+len(r.DeletedRemote)+len(r.Conflicts)+len(r.Errors) > 0 || r.Error != ""
+}
+
+// String renders the counts for log lines.
+func (r *ReconcileReport) String() string {
+	return fmt.Sprintf("%d fetched, %d in sync, %d pushed, %d pulled, %d deleted locally, %d deleted remotely, %d conflict(s), %d error(s)",
+		r.Fetched, r.InSync, len(r.Pushed), len(r.Pulled), len(r.DeletedLocal), len(r.DeletedRemote), len(r.Conflicts), len(r.Errors))
+}
+
+// authSyncEntry is the state of one id as of the last reconcile, used as the
+// common base to tell which side changed.
+type authSyncEntry struct {
+	Hash      string    `json:"hash"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// authSyncState is persisted between runs. Watermark is the newest
+// updated_at seen in auth_store (database clock, so replica clock skew does
+// not matter).
+type authSyncState struct {
+	Watermark time.Time                `json:"watermark"`
+	Entries   map[string]authSyncEntry `json:"entries"`
+}
+
+type localAuthFile struct {
+	path    string
+	content []byte
+	hash    string
+	modTime time.Time
+}
+
+// remoteAuthRow is one auth_store row. content is nil for rows that did not
+// change since the last run; hash is then taken from the base state.
+type remoteAuthRow struct {
+	content   []byte
+	hash      string
+	updatedAt time.Time
+}
+
+// Reconcile brings the local mirror and the auth table in step without
+// discarding either side. Each id is compared by content hash against the
+// state recorded by the previous run:
+//
+//   - changed or created only locally (e.g. an upsert that failed): pushed up
+//   - changed or created only in the backend: pulled down
+//   - deleted on one side and unchanged on the other: deleted on the other
+//   - changed on both sides: the newer copy (file mtime vs updated_at) wins
+//     and the id is reported as a conflict; a deletion never beats an edit
+//
+// Without previous state (first run), local-only files are pushed and
+// remote-only rows are pulled.
+//
+// Only the content of rows changed since the last run is read from the backend
+// (see loadRemoteAuth), so a run over thousands of unchanged credentials
+// transfers ids and timestamps only.
+func (s *TokenStore) Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	return s.reconcile(ctx, false)
+}
+
+// ReconcileFull is Reconcile with every row's content read from the backend, for
+// rows that were edited without bumping updated_at.
+func (s *TokenStore) ReconcileFull(ctx context.Context) (*ReconcileReport, error) {
+	return s.reconcile(ctx, true)
+}
+
+func (s *TokenStore) reconcile(ctx context.Context, full bool) (*ReconcileReport, error) {
+	if s == nil || s.backend == nil {
+		return nil, fmt.Errorf("token store: not initialized")
+	}
+	report := &ReconcileReport{StartedAt: time.Now(), Full: full}
+	defer func() {
+		report.DurationMS = time.Since(report.StartedAt).Milliseconds()
+		s.lastReconcile.Store(report)
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Apply queued writes first so they are not mistaken for remote deletions.
+	if _, err := s.replayOutboxLocked(ctx); err != nil {
+		report.Error = err.Error()
+		return report, err
+	}
+	prev := s.loadSyncState()
+	if full {
+		prev.Watermark = time.Time{}
+	}
+	base := prev.Entries
+	remote, err := s.loadRemoteAuth(ctx, prev, report)
+	if err != nil {
+		report.Error = err.Error()
+		return report, err
+	}
+	local, err := s.loadLocalAuth()
+	if err != nil {
+		report.Error = err.Error()
+		return report, err
+	}
+
+	ids := make(map[string]struct{}, len(remote)+len(local)+len(base))
+	for id := range remote {
+		ids[id] = struct{}{}
+	}
+	for id := range local {
+		ids[id] = struct{}{}
+	}
+	for id := range base {
+		ids[id] = struct{}{}
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	state := authSyncState{Watermark: prev.Watermark, Entries: make(map[string]authSyncEntry, len(sorted))}
+	for _, id := range sorted {
+		entry, keep, errID := s.reconcileOne(ctx, id, local[id], remote[id], base, report)
+		if errID != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", id, errID))
+			// Keep the previous base so the next run retries the same decision.
+			if b, ok := base[id]; ok {
+				state.Entries[id] = b
+			}
+			continue
+		}
+		if keep {
+			state.Entries[id] = entry
+		}
+	}
+	for _, entry := range state.Entries {
+		if entry.UpdatedAt.After(state.Watermark) {
+			state.Watermark = entry.UpdatedAt
+		}
+	}
+	if err = s.saveSyncState(state); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	return report, nil
+}
+
+// reconcileOne applies the decision for a single id and returns its new base state.
+func (s *TokenStore) reconcileOne(ctx context.Context, id string, l *localAuthFile, r *remoteAuthRow, base map[string]authSyncEntry, report *ReconcileReport) (authSyncEntry, bool, error) {
+	b, hasBase := base[id]
+	switch {
+	case l == nil && r == nil:
+		return authSyncEntry{}, false, nil
+
+	case l != nil && r != nil && l.hash == r.hash:
+		report.InSync++
+		return authSyncEntry{Hash: r.hash, UpdatedAt: r.updatedAt}, true, nil
+
+	case l != nil && r == nil:
+		if !hasBase {
+			return s.pushAuth(ctx, id, l, report)
+		}
+		if l.hash == b.Hash {
+			report.DeletedLocal = append(report.DeletedLocal, id)
+			return authSyncEntry{}, false, s.removeLocalAuth(l.path)
+		}
+		report.Conflicts = append(report.Conflicts, ReconcileConflict{ID: id, Reason: "deleted in backend, modified locally", Resolution: "pushed local copy"})
+		return s.pushAuth(ctx, id, l, report)
+
+	case l == nil && r != nil:
+		if !hasBase {
+			return s.pullAuth(id, r, report)
+		}
+		if r.hash == b.Hash {
+			report.DeletedRemote = append(report.DeletedRemote, id)
+			return authSyncEntry{}, false, s.deleteAuthRecord(ctx, id)
+		}
+		report.Conflicts = append(report.Conflicts, ReconcileConflict{ID: id, Reason: "deleted locally, modified in backend", Resolution: "pulled backend copy"})
+		return s.pullAuth(id, r, report)
+	}
+
+	// Both sides exist with different content.
+	switch {
+	case hasBase && l.hash == b.Hash:
+		return s.pullAuth(id, r, report)
+	case hasBase && r.hash == b.Hash:
+		return s.pushAuth(ctx, id, l, report)
+	}
+	reason := "modified locally and in backend"
+	if !hasBase {
+		reason = "differs and no previous sync state"
+	}
+	if l.modTime.After(r.updatedAt) {
+		report.Conflicts = append(report.Conflicts, ReconcileConflict{ID: id, Reason: reason, Resolution: "pushed newer local copy"})
+		return s.pushAuth(ctx, id, l, report)
+	}
+	report.Conflicts = append(report.Conflicts, ReconcileConflict{ID: id, Reason: reason, Resolution: "pulled newer backend copy"})
+	return s.pullAuth(id, r, report)
+}
+
+func (s *TokenStore) pushAuth(ctx context.Context, id string, l *localAuthFile, report *ReconcileReport) (authSyncEntry, bool, error) {
+	if !json.Valid(l.content) {
+		return authSyncEntry{}, false, fmt.Errorf("local file is not valid JSON")
+	}
+	updatedAt, err := s.backend.Put(ctx, id, l.content)
+	if err != nil {
+		return authSyncEntry{}, false, fmt.Errorf("push: %w", err)
+	}
+	report.Pushed = append(report.Pushed, id)
+	return authSyncEntry{Hash: l.hash, UpdatedAt: updatedAt}, true, nil
+}
+
+func (s *TokenStore) pullAuth(id string, r *remoteAuthRow, report *ReconcileReport) (authSyncEntry, bool, error) {
+	path, err := s.absoluteAuthPath(id)
+	if err != nil {
+		return authSyncEntry{}, false, err
+	}
+	if _, err = s.writeMirrorLocked(path, r.content); err != nil {
+		return authSyncEntry{}, false, fmt.Errorf("pull: %w", err)
+	}
+	report.Pulled = append(report.Pulled, id)
+	return authSyncEntry{Hash: r.hash, UpdatedAt: r.updatedAt}, true, nil
+}
+
+func (s *TokenStore) removeLocalAuth(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete local file: %w", err)
+	}
+	return nil
+}
+
+// loadRemoteAuth reads the backend. Content is listed only for records
+// updated after the watermark (minus watermarkOverlap); records that are
+// older but not in the base state, or whose update time differs from it, are
+// fetched in a second pass. Everything else is unchanged and keeps its base hash.
+func (s *TokenStore) loadRemoteAuth(ctx context.Context, prev authSyncState, report *ReconcileReport) (map[string]*remoteAuthRow, error) {
+	since := prev.Watermark
+	if !since.IsZero() {
+		since = since.Add(-watermarkOverlap)
+	}
+	records, err := s.backend.List(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("token store: load auth from %s: %w", s.backend, err)
+	}
+	out := make(map[string]*remoteAuthRow, len(records))
+	var missing []string
+	for _, rec := range records {
+		if _, errPath := s.absoluteAuthPath(rec.ID); errPath != nil {
+			// Skip invalid identifiers but keep processing.
+			continue
+		}
+		key := normalizeAuthID(rec.ID)
+		row := &remoteAuthRow{updatedAt: rec.UpdatedAt}
+		switch b, ok := prev.Entries[key]; {
+		case rec.Content != nil:
+			row.content = rec.Content
+			row.hash = authContentHash(row.content)
+			report.Fetched++
+		case ok && b.UpdatedAt.Equal(rec.UpdatedAt):
+			row.hash = b.Hash
+		default:
+			missing = append(missing, key)
+		}
+		out[key] = row
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	fetched, err := s.GetRecords(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range missing {
+		rec, ok := fetched[id]
+		if !ok {
+			// Deleted between the two passes.
+			delete(out, id)
+			continue
+		}
+		// Keep the listed update time: some backends (S3) report it with a
+		// different precision on single reads.
+		row := out[id]
+		row.content, row.hash = rec.Content, authContentHash(rec.Content)
+		report.Fetched++
+	}
+	return out, nil
+}
+
+// loadLocalAuth reads the mirror, including parked (disabled) credentials.
+// If a crash left both copies of an id behind, the newer one counts.
+func (s *TokenStore) loadLocalAuth() (map[string]*localAuthFile, error) {
+	out := make(map[string]*localAuthFile)
+	err := filepath.WalkDir(s.authDir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		name := strings.ToLower(d.Name())
+		if d.IsDir() || !(strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".json"+disabledSuffix)) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// Empty files are treated as absent, as in List.
+		if len(bytes.TrimSpace(content)) == 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		id, err := s.relativeAuthID(strings.TrimSuffix(path, disabledSuffix))
+		if err != nil {
+			return err
+		}
+		if prev, ok := out[id]; ok && prev.modTime.After(info.ModTime()) {
+			return nil
+		}
+		out[id] = &localAuthFile{path: path, content: content, hash: authContentHash(content), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("token store: scan auth directory: %w", err)
+	}
+	return out, nil
+}
+
+func (s *TokenStore) syncStatePath() string {
+	return filepath.Join(s.spoolRoot, authSyncStateFile)
+}
+
+// loadSyncState returns the previous state; a missing or unreadable file
+// means no base and no watermark. The pre-watermark format (a plain map of
+// entries) is still accepted.
+func (s *TokenStore) loadSyncState() authSyncState {
+	state := authSyncState{Entries: make(map[string]authSyncEntry)}
+	data, err := os.ReadFile(s.syncStatePath())
+	if err != nil {
+		return state
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err == nil {
+		if _, ok := fields["entries"]; ok {
+			err = json.Unmarshal(data, &state)
+		} else {
+			err = json.Unmarshal(data, &state.Entries)
+		}
+	}
+	if err != nil {
+		log.Printf("token store: ignoring corrupt %s: %v", authSyncStateFile, err)
+		return authSyncState{Entries: make(map[string]authSyncEntry)}
+	}
+	if state.Entries == nil {
+		state.Entries = make(map[string]authSyncEntry)
+	}
+	return state
+}
+
+func (s *TokenStore) saveSyncState(state authSyncState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("token store: encode sync state: %w", err)
+	}
+	path := s.syncStatePath()
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("token store: write sync state: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("token store: write sync state: %w", err)
+	}
+	return nil
+}
+
+// LastReconcile returns the report of the most recent Reconcile, or nil.
+func (s *TokenStore) LastReconcile() *ReconcileReport {
+	if s == nil {
+		return nil
+	}
+	return s.lastReconcile.Load()
+}
+
+// RunReconcile reconciles every interval until ctx is cancelled and logs runs
+// that changed something.
+func (s *TokenStore) RunReconcile(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.Reconcile(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("auth reconcile failed: %v", err)
+				}
+				continue
+			}
+			LogReconcile(report)
+		}
+	}
+}
+
+// LogReconcile logs a report when it changed something.
+func LogReconcile(report *ReconcileReport) {
+	if report == nil || !report.Changed() {
+		return
+	}
+	log.Printf("auth reconcile: %s", report)
+	for _, c := range report.Conflicts {
+		log.Printf("auth reconcile: conflict on %s (%s): %s", c.ID, c.Reason, c.Resolution)
+	}
+	for _, e := range report.Errors {
+		log.Printf("auth reconcile: %s", e)
+	}
+}
+
+// authContentHash hashes the canonical JSON form so a file and its JSONB copy
+// (which reorders keys and whitespace) compare equal. Invalid JSON is hashed as is.
+func authContentHash(content []byte) string {
+	canonical := content
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err == nil {
+		if encoded, errEncode := json.Marshal(v); errEncode == nil {
+			canonical = encoded
+		}
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
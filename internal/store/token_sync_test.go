@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReconcileMatrix(t *testing.T) {
+	const (
+		base    = `{"type":"codex","v":"base"}`
+		local   = `{"type":"codex","v":"local"}`
+		remote  = `{"type":"codex","v":"remote"}`
+		absent  = ""
+		pushed  = "pushed"
+		pulled  = "pulled"
+		delLoc  = "deleted_local"
+		delRem  = "deleted_remote"
+		inSync  = "in_sync"
+		noSync  = ""
+		older   = -time.Hour
+		younger = time.Hour
+	)
+	tests := []struct {
+		name string
+		// base is the content both sides agreed on at the previous run; absent
+		// means the id has never been reconciled.
+		base          string
+		local, remote string
+		// localAge shifts the local file's mtime relative to the backend row.
+		localAge   time.Duration
+		action     string
+		conflict   bool
+		wantLocal  string
+		wantRemote string
+	}{
+		{"created locally", absent, local, absent, 0, pushed, false, local, local},
+		{"created in backend", absent, absent, remote, 0, pulled, false, remote, remote},
+		{"in sync", base, base, base, 0, inSync, false, base, base},
+		{"modified locally", base, local, base, older, pushed, false, local, local},
+		{"modified in backend", base, base, remote, younger, pulled, false, remote, remote},
+		{"deleted in backend", base, base, absent, 0, delLoc, false, absent, absent},
+		{"deleted locally", base, absent, base, 0, delRem, false, absent, absent},
+		{"deleted in backend, modified locally", base, local, absent, 0, pushed, true, local, local},
+		{"deleted locally, modified in backend", base, absent, remote, 0, pulled, true, remote, remote},
+		{"modified on both, local newer", base, local, remote, younger, pushed, true, local, local},
+		{"modified on both, backend newer", base, local, remote, older, pulled, true, remote, remote},
+		{"differs without base, local newer", absent, local, remote, younger, pushed, true, local, local},
+		{"differs without base, backend newer", absent, local, remote, older, pulled, true, remote, remote},
+		{"gone on both sides", base, absent, absent, 0, noSync, false, absent, absent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestTokenStore(t)
+			const id = "codex.json"
+			path := filepath.Join(s.AuthDir(), id)
+
+			if tt.base != absent {
+				writeLocal(t, path, tt.base)
+				if _, err := s.backend.Put(ctx, id, []byte(tt.base)); err != nil {
+					t.Fatal(err)
+				}
+				if report, err := s.Reconcile(ctx); err != nil || report.InSync != 1 {
+					t.Fatalf("baseline Reconcile = %+v, %v", report, err)
+				}
+			}
+			switch {
+			case tt.local == absent:
+				_ = os.Remove(path)
+			case tt.local != tt.base:
+				writeLocal(t, path, tt.local)
+			}
+			switch {
+			case tt.remote == absent:
+				_ = s.backend.Delete(ctx, id)
+			case tt.remote != tt.base:
+				if _, err := s.backend.Put(ctx, id, []byte(tt.remote)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.local != absent && tt.localAge != 0 {
+				mtime := time.Now().Add(tt.localAge)
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			report, err := s.Reconcile(ctx)
+			if err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+			if len(report.Errors) > 0 {
+				t.Fatalf("Reconcile errors: %v", report.Errors)
+			}
+			actions := map[string]bool{
+				pushed: slices.Contains(report.Pushed, id),
+				pulled: slices.Contains(report.Pulled, id),
+				delLoc: slices.Contains(report.DeletedLocal, id),
+				delRem: slices.Contains(report.DeletedRemote, id),
+				inSync: report.InSync == 1,
+			}
+			for action, done := range actions {
+				if done != (action == tt.action) {
+					t.Fatalf("report %s: %s = %v, want action %q", report, action, done, tt.action)
+				}
+			}
+			if got := len(report.Conflicts) == 1; got != tt.conflict {
+				t.Fatalf("conflicts = %+v, want conflict %v", report.Conflicts, tt.conflict)
+			}
+
+			data, err := os.ReadFile(path)
+			switch {
+			case tt.wantLocal == absent && !errors.Is(err, os.ErrNotExist):
+				t.Fatalf("local file = %s, %v; want it deleted", data, err)
+			case tt.wantLocal != absent && (err != nil || !jsonEqual(data, []byte(tt.wantLocal))):
+				t.Fatalf("local file = %s, %v; want %s", data, err, tt.wantLocal)
+			}
+			rec, err := s.backend.Get(ctx, id)
+			switch {
+			case tt.wantRemote == absent && !errors.Is(err, ErrNotFound):
+				t.Fatalf("backend record = %v, %v; want it deleted", rec, err)
+			case tt.wantRemote != absent && (err != nil || !jsonEqual(rec.Content, []byte(tt.wantRemote))):
+				t.Fatalf("backend record = %v, %v; want %s", rec, err, tt.wantRemote)
+			}
+
+			// The decision is recorded: a second run finds both sides in step.
+			report, err = s.Reconcile(ctx)
+			if err != nil || report.Changed() {
+				t.Fatalf("second Reconcile = %s, %v; want no changes", report, err)
+			}
+		})
+	}
+}
+
+func writeLocal(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}